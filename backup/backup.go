@@ -0,0 +1,278 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+const (
+	// DefaultKeep 未配置保留策略时每个文件保留的版本数
+	DefaultKeep = 10
+
+	// idFormat 版本ID的时间格式
+	idFormat = "20060102-150405.000000000"
+	// deletedSuffix 因删除而保存的版本的后缀
+	deletedSuffix = ".deleted"
+)
+
+// Version 文件的一个历史版本
+type Version struct {
+	Path    string    `json:"path"`
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+	Deleted bool      `json:"deleted"` // 文件被删除前保存的版本
+}
+
+// Store 历史版本存储
+// 被覆盖或删除的文件保存在 <root>/.xsync/versions/<相对路径>/<版本ID>
+type Store struct {
+	root   string
+	dir    string
+	keep   int
+	maxAge time.Duration
+	mutex  sync.Mutex
+}
+
+// NewStore 创建历史版本存储，keep和maxAge都为0时每个文件保留DefaultKeep个版本
+func NewStore(root string, keep int, maxAge time.Duration) *Store {
+	if keep <= 0 && maxAge <= 0 {
+		keep = DefaultKeep
+	}
+	return &Store{
+		root:   root,
+		dir:    filepath.Join(root, watcher.MetaDir, "versions"),
+		keep:   keep,
+		maxAge: maxAge,
+	}
+}
+
+// Save 保存文件的当前内容为历史版本（文件不存在或不是普通文件时忽略）
+func (s *Store) Save(relPath string, deleted bool) error {
+	relPath, err := protocol.CleanPath(relPath)
+	if err != nil {
+		return err
+	}
+
+	src := filepath.Join(s.root, filepath.FromSlash(relPath))
+	info, err := os.Lstat(src)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := time.Now().Format(idFormat)
+	if deleted {
+		id += deletedSuffix
+	}
+	dst := filepath.Join(s.versionDir(relPath), id)
+	if err := copyFile(src, dst, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("保存历史版本失败 %s: %v", relPath, err)
+	}
+
+	s.prune(relPath)
+	return nil
+}
+
+// List 列出文件的所有历史版本（新版本在前）
+func (s *Store) List(relPath string) ([]Version, error) {
+	relPath, err := protocol.CleanPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list(relPath)
+}
+
+// Paths 列出所有保存了历史版本的文件
+func (s *Store) Paths() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var paths []string
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !isVersionID(info.Name()) {
+			return nil
+		}
+		relPath, err := filepath.Rel(s.dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if len(paths) == 0 || paths[len(paths)-1] != relPath {
+			paths = append(paths, relPath)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// Read 读取历史版本的内容
+func (s *Store) Read(relPath, id string) ([]byte, error) {
+	relPath, err := protocol.CleanPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	if !isVersionID(id) {
+		return nil, fmt.Errorf("无效的版本ID: %s", id)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(s.versionDir(relPath), id))
+	if err != nil {
+		return nil, fmt.Errorf("版本不存在: %s %s", relPath, id)
+	}
+	return content, nil
+}
+
+// Restore 将文件恢复为指定的历史版本（恢复前先保存当前内容）
+func (s *Store) Restore(relPath, id string) error {
+	relPath, err := protocol.CleanPath(relPath)
+	if err != nil {
+		return err
+	}
+	if !isVersionID(id) {
+		return fmt.Errorf("无效的版本ID: %s", id)
+	}
+
+	src := filepath.Join(s.versionDir(relPath), id)
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("版本不存在: %s %s", relPath, id)
+	}
+
+	// 先取出要恢复的版本，保存当前内容时的清理可能删除该版本
+	staged := filepath.Join(s.dir, "."+id+".restore")
+	if err := copyFile(src, staged, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("读取历史版本失败 %s: %v", relPath, err)
+	}
+	defer os.Remove(staged)
+
+	if err := s.Save(relPath, false); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(s.root, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := os.Rename(staged, dst); err != nil {
+		return fmt.Errorf("恢复文件失败 %s: %v", relPath, err)
+	}
+
+	log.Printf("文件已恢复到历史版本: %s (%s)", relPath, id)
+	return nil
+}
+
+// list 列出文件的历史版本（调用时需持有锁）
+func (s *Store) list(relPath string) ([]Version, error) {
+	entries, err := ioutil.ReadDir(s.versionDir(relPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []Version
+	for _, entry := range entries {
+		if entry.IsDir() || !isVersionID(entry.Name()) {
+			continue
+		}
+		t, _ := time.ParseInLocation(idFormat, strings.TrimSuffix(entry.Name(), deletedSuffix), time.Local)
+		versions = append(versions, Version{
+			Path:    relPath,
+			ID:      entry.Name(),
+			Time:    t,
+			Size:    entry.Size(),
+			Deleted: strings.HasSuffix(entry.Name(), deletedSuffix),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Time.After(versions[j].Time)
+	})
+	return versions, nil
+}
+
+// prune 按保留策略清理文件的旧版本（调用时需持有锁）
+func (s *Store) prune(relPath string) {
+	versions, err := s.list(relPath)
+	if err != nil {
+		return
+	}
+
+	for i, version := range versions {
+		expired := s.maxAge > 0 && time.Since(version.Time) > s.maxAge
+		if (s.keep > 0 && i >= s.keep) || expired {
+			os.Remove(filepath.Join(s.versionDir(relPath), version.ID))
+		}
+	}
+
+	// 清理空的版本目录
+	for dir := s.versionDir(relPath); dir != s.dir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
+// versionDir 获取文件的版本目录
+func (s *Store) versionDir(relPath string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(relPath))
+}
+
+// isVersionID 判断文件名是否为版本ID
+func isVersionID(name string) bool {
+	_, err := time.Parse(idFormat, strings.TrimSuffix(name, deletedSuffix))
+	return err == nil
+}
+
+// copyFile 复制文件内容（先写临时文件再重命名）
+func copyFile(src, dst string, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmpPath := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".xsync-tmp")
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
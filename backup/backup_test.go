@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name   string
+		keep   int
+		maxAge time.Duration
+		ages   []time.Duration // 已有版本距今的时间
+		want   []time.Duration // 清理后保留的版本（新版本在前）
+	}{
+		{"默认保留数", 0, 0, []time.Duration{time.Hour, 2 * time.Hour}, []time.Duration{time.Hour, 2 * time.Hour}},
+		{"按数量保留", 2, 0, []time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour}, []time.Duration{time.Hour, 2 * time.Hour}},
+		{"按时间保留", 0, 90 * time.Minute, []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour}, []time.Duration{time.Hour}},
+		{"两者都满足才保留", 1, 90 * time.Minute, []time.Duration{time.Hour, 80 * time.Minute}, []time.Duration{time.Hour}},
+		{"全部过期", 0, time.Minute, []time.Duration{time.Hour, 2 * time.Hour}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			s := NewStore(root, tt.keep, tt.maxAge)
+
+			now := time.Now()
+			ids := make(map[string]time.Duration)
+			for _, age := range tt.ages {
+				id := now.Add(-age).Format(idFormat)
+				ids[id] = age
+				writeVersion(t, s, "dir/a.txt", id)
+			}
+
+			s.mutex.Lock()
+			s.prune("dir/a.txt")
+			s.mutex.Unlock()
+
+			versions, err := s.List("dir/a.txt")
+			if err != nil {
+				t.Fatalf("列出历史版本失败: %v", err)
+			}
+			var got []time.Duration
+			for _, version := range versions {
+				got = append(got, ids[version.ID])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("保留的版本 = %v, 期望 %v", got, tt.want)
+			}
+
+			// 版本全部清理后删除空的版本目录
+			_, err = os.Stat(filepath.Join(s.dir, "dir"))
+			if empty := len(tt.want) == 0; empty != os.IsNotExist(err) {
+				t.Errorf("版本目录是否删除 = %v, 期望 %v", os.IsNotExist(err), empty)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsDeleted(t *testing.T) {
+	root := t.TempDir()
+	s := NewStore(root, 2, 0)
+	path := filepath.Join(root, "a.txt")
+
+	for i, content := range []string{"v1", "v2", "v3"} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save("a.txt", i == 2); err != nil {
+			t.Fatalf("保存历史版本失败: %v", err)
+		}
+	}
+
+	versions, err := s.List("a.txt")
+	if err != nil {
+		t.Fatalf("列出历史版本失败: %v", err)
+	}
+	if len(versions) != 2 || !versions[0].Deleted || versions[1].Deleted {
+		t.Fatalf("历史版本 = %+v", versions)
+	}
+	content, err := s.Read("a.txt", versions[1].ID)
+	if err != nil || string(content) != "v2" {
+		t.Errorf("读取历史版本 = %q, %v, 期望 v2", content, err)
+	}
+}
+
+// writeVersion 直接写入一个历史版本文件
+func writeVersion(t *testing.T, s *Store, relPath, id string) {
+	t.Helper()
+	dir := s.versionDir(relPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, id), []byte(id), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
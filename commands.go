@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"xsync/config"
+	"xsync/control"
+	"xsync/slave"
+	"xsync/snapshot"
+)
+
+// runCommand 执行子命令
+func runCommand(args []string) error {
+	switch args[0] {
+	case "versions":
+		return runVersions(args[1:])
+	case "snapshot":
+		return runSnapshot(args[1:])
+	case "config":
+		return runConfig(args[1:])
+	case "status", "stats", "resync", "push", "verify", "ls", "pause", "resume", "reload":
+		return runControl(args[0], args[1:])
+	case "events":
+		return runEvents(args[1:])
+	default:
+		return fmt.Errorf("未知命令: %s (使用 -h 查看帮助)", args[0])
+	}
+}
+
+// loadSlaveConfig 加载配置并检查是否为Slave节点
+func loadSlaveConfig() (*config.Config, error) {
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	if *groupName != "" {
+		group := cfg.FindGroup(*groupName)
+		if group == nil {
+			return nil, fmt.Errorf("未找到同步组: %s", *groupName)
+		}
+		cfg = cfg.GroupConfig(group)
+	} else if !cfg.HasDefaultGroup() {
+		return nil, fmt.Errorf("配置中只有同步组，请使用 -g 指定同步组")
+	}
+	if !cfg.IsSlave() {
+		return nil, fmt.Errorf("该命令只能用于Slave节点")
+	}
+	return cfg, nil
+}
+
+// runConfig 检查配置或输出生效的配置
+func runConfig(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("用法: config check | config print")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+
+	switch args[0] {
+	case "check":
+		errors, warnings := 0, 0
+		for _, problem := range cfg.Check() {
+			if problem.Warning {
+				warnings++
+				fmt.Printf("[警告] %s\n", problem.Message)
+			} else {
+				errors++
+				fmt.Printf("[错误] %s\n", problem.Message)
+			}
+		}
+		fmt.Printf("%s: %d 个错误, %d 个警告\n", *configPath, errors, warnings)
+		if errors > 0 {
+			return fmt.Errorf("配置检查未通过")
+		}
+		return nil
+
+	case "print":
+		if *groupName != "" {
+			group := cfg.FindGroup(*groupName)
+			if group == nil {
+				return fmt.Errorf("未找到同步组: %s", *groupName)
+			}
+			cfg = cfg.GroupConfig(group)
+		} else {
+			cfg = cfg.Effective()
+		}
+		data, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			return fmt.Errorf("输出配置失败: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
+
+	default:
+		return fmt.Errorf("未知的config子命令: %s", args[0])
+	}
+}
+
+// runVersions 列出或恢复Slave上文件的历史版本
+func runVersions(args []string) error {
+	cfg, err := loadSlaveConfig()
+	if err != nil {
+		return err
+	}
+	store := slave.NewBackupStore(cfg)
+	if store == nil {
+		return fmt.Errorf("未启用版本保留(versioning)")
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("用法: versions list [路径] | versions restore <路径> <ID>")
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) == 1 {
+			paths, err := store.Paths()
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				fmt.Println(path)
+			}
+			return nil
+		}
+
+		versions, err := store.List(args[1])
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			fmt.Printf("%s 没有历史版本\n", args[1])
+			return nil
+		}
+		for _, v := range versions {
+			note := ""
+			if v.Deleted {
+				note = " (删除前)"
+			}
+			fmt.Printf("%s  %s  %d bytes%s\n", v.ID, v.Time.Format("2006-01-02 15:04:05"), v.Size, note)
+		}
+		return nil
+
+	case "restore":
+		if len(args) != 3 {
+			return fmt.Errorf("用法: versions restore <路径> <ID>")
+		}
+		if err := store.Restore(args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("已恢复 %s 到版本 %s\n", args[1], args[2])
+		if cfg.DriftPolicy != "" {
+			fmt.Printf("注意: 运行中的节点会按drift_policy处理此次恢复，可改用Web接口 /api/versions/restore\n")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("未知的versions子命令: %s", args[0])
+	}
+}
+
+// runSnapshot 列出、创建、比较或恢复Slave同步目录的快照
+func runSnapshot(args []string) error {
+	cfg, err := loadSlaveConfig()
+	if err != nil {
+		return err
+	}
+	store := snapshot.NewStore(cfg.SyncPath)
+
+	if len(args) == 0 {
+		return fmt.Errorf("用法: snapshot list | create | diff <快照> [快照] | restore <快照>")
+	}
+
+	switch args[0] {
+	case "list":
+		summaries, err := store.List()
+		if err != nil {
+			return err
+		}
+		if len(summaries) == 0 {
+			fmt.Println("没有快照")
+			return nil
+		}
+		for _, summary := range summaries {
+			fmt.Printf("%s  %s  %d 个文件  %d bytes\n", summary.ID, summary.Time.Format("2006-01-02 15:04:05"), summary.Files, summary.Size)
+		}
+		return nil
+
+	case "create":
+		manifest, err := store.Take()
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			fmt.Println("同步目录与最近一个快照相同，未创建新快照")
+			return nil
+		}
+		if _, err := store.Prune(slave.SnapshotRetention(cfg)); err != nil {
+			return err
+		}
+		fmt.Printf("已创建快照 %s: %d 个文件\n", manifest.ID, len(manifest.Files))
+		return nil
+
+	case "diff":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("用法: snapshot diff <快照> [快照]")
+		}
+		to := ""
+		if len(args) == 3 {
+			to = args[2]
+		}
+		changes, err := slave.DiffSnapshots(store, args[1], to)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Println("没有差异")
+			return nil
+		}
+		for _, change := range changes {
+			fmt.Printf("%-9s %s\n", change.Op, change.Path)
+		}
+		return nil
+
+	case "restore":
+		if len(args) != 2 {
+			return fmt.Errorf("用法: snapshot restore <快照>")
+		}
+		manifest, err := store.Find(args[1])
+		if err != nil {
+			return err
+		}
+		backups := slave.NewBackupStore(cfg)
+		changed, err := store.Restore(manifest, func(relPath string, content []byte, deleted bool) {
+			if backups != nil {
+				backups.Save(relPath, deleted)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已恢复到快照 %s: 修改 %d 个文件\n", manifest.ID, changed)
+		if cfg.DriftPolicy != "" || cfg.Bidirectional {
+			fmt.Printf("注意: 运行中的节点会把此次恢复当作本地变更处理，可改用Web接口 /api/snapshots/restore\n")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("未知的snapshot子命令: %s", args[0])
+	}
+}
+
+// runControl 通过本地控制接口在运行中的节点上执行命令
+func runControl(command string, args []string) error {
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+
+	// 本地路径转换为绝对路径，节点的工作目录可能与当前目录不同
+	switch command {
+	case "push", "pause", "resume":
+		for i, arg := range args {
+			if args[i], err = filepath.Abs(arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	timeout := time.Minute
+	if command == "verify" {
+		timeout = 6 * time.Minute
+	}
+	data, err := control.Call(cfg.ControlSocket, &control.Request{Command: command, Args: args, Group: *groupName}, timeout)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "status":
+		var status control.Status
+		if err := json.Unmarshal(data, &status); err != nil {
+			return fmt.Errorf("解析结果失败: %v", err)
+		}
+		printStatus(&status)
+		return nil
+
+	case "stats":
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "  "); err != nil {
+			return fmt.Errorf("解析结果失败: %v", err)
+		}
+		fmt.Println(out.String())
+		return nil
+
+	case "verify":
+		var result control.VerifyResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("解析结果失败: %v", err)
+		}
+		printVerify(&result)
+		if !result.InSync() {
+			return fmt.Errorf("%s 上的文件与Master不一致", result.Slave)
+		}
+		return nil
+
+	case "ls":
+		var result control.ListResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("解析结果失败: %v", err)
+		}
+		for _, entry := range result.Entries {
+			name, size := entry.Name, fmt.Sprintf("%d", entry.Size)
+			if entry.Dir {
+				name, size = name+"/", "-"
+			}
+			fmt.Printf("%12s  %s  %s\n", size, entry.ModTime.Format("2006-01-02 15:04:05"), name)
+		}
+		return nil
+
+	case "pause", "resume":
+		var result map[string]interface{}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("解析结果失败: %v", err)
+		}
+		if paths, ok := result["paused"].([]interface{}); ok {
+			if len(paths) == 0 {
+				fmt.Println("没有新暂停的监控路径")
+			}
+			for _, path := range paths {
+				fmt.Printf("已暂停: %v\n", path)
+			}
+		}
+		if resumed, ok := result["resumed"].(map[string]interface{}); ok {
+			if len(resumed) == 0 {
+				fmt.Println("没有暂停的监控路径")
+			}
+			for path, count := range resumed {
+				fmt.Printf("已恢复: %s，发送暂停期间的 %v 项变更\n", path, count)
+			}
+		}
+		return nil
+
+	default:
+		var message string
+		if err := json.Unmarshal(data, &message); err != nil {
+			return fmt.Errorf("解析结果失败: %v", err)
+		}
+		fmt.Println(message)
+		return nil
+	}
+}
+
+// runEvents 实时输出节点的事件，直到按Ctrl+C或节点关闭
+func runEvents(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("用法: events")
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *configPath, err)
+	}
+
+	return control.Stream(cfg.ControlSocket, *groupName, func(event *control.Event) error {
+		fmt.Println(event.String())
+		return nil
+	})
+}
+
+// printStatus 输出节点状态：Master按Slave列出队列、延迟和错误
+func printStatus(status *control.Status) {
+	fmt.Printf("节点: %s (%s)\n", status.NodeID, status.Role)
+	for _, path := range status.Paused {
+		fmt.Printf("已暂停: %s\n", path)
+	}
+
+	if len(status.Slaves) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SLAVE\tNODE\tQUEUED\tSYNC_QUEUED\tACTIVE\tLAG\tSENT\tFAILED\tDRIFTS\tHOOK_FAILURES\tFULL_SYNC\tLAST_SEEN")
+		for _, slave := range status.Slaves {
+			nodeID, fullSync, lastSeen := slave.NodeID, slave.FullSync, "-"
+			if nodeID == "" {
+				nodeID = "-"
+			}
+			if fullSync == "" {
+				fullSync = "-"
+			}
+			if !slave.LastSeen.IsZero() {
+				lastSeen = time.Since(slave.LastSeen).Round(time.Second).String() + "前"
+			}
+			lag := (time.Duration(slave.LagSec * float64(time.Second))).Round(time.Second)
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+				slave.Addr, nodeID, slave.Queued, slave.SyncQueued, slave.Active, lag,
+				slave.Sent, slave.Failed, slave.Drifts, slave.HookFailures, fullSync, lastSeen)
+		}
+		w.Flush()
+	}
+
+	fmt.Println()
+	keys := make([]string, 0, len(status.Stats))
+	for key := range status.Stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s: %v\n", key, status.Stats[key])
+	}
+}
+
+// printVerify 输出各目标中缺少、内容不同和多余的文件
+func printVerify(result *control.VerifyResult) {
+	for _, diff := range result.Targets {
+		name := diff.Target
+		if name == "" {
+			name = "sync_path"
+		}
+		if diff.Error != "" {
+			fmt.Printf("目标 %s: 比较失败: %s\n", name, diff.Error)
+			continue
+		}
+		fmt.Printf("目标 %s: %d 个文件, 缺少 %d, 不同 %d, 多余 %d\n",
+			name, diff.Files, len(diff.Missing), len(diff.Differ), len(diff.Extra))
+		for _, path := range diff.Missing {
+			fmt.Printf("  缺少  %s\n", path)
+		}
+		for _, path := range diff.Differ {
+			fmt.Printf("  不同  %s\n", path)
+		}
+		for _, path := range diff.Extra {
+			fmt.Printf("  多余  %s\n", path)
+		}
+	}
+	if result.InSync() {
+		fmt.Printf("%s 与Master一致\n", result.Slave)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package config
+
+import "syscall"
+
+// access 按access(2)检查当前用户对路径的访问权限
+func access(path string, mode uint32) error {
+	return syscall.Access(path, mode)
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// access Windows平台没有access(2)，通过实际打开路径检查访问权限：
+// 目录可写时尝试在其中创建临时文件，文件可写时以写方式打开，可读时以读方式打开，忽略执行权限
+func access(path string, mode uint32) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if mode&accessRead != 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+
+	if mode&accessWrite != 0 {
+		if info.IsDir() {
+			f, err := ioutil.TempFile(path, ".xsync-check-")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			os.Remove(f.Name())
+		} else {
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			f.Close()
+		}
+	}
+	return nil
+}
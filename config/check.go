@@ -0,0 +1,297 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// 访问权限检查的模式（access(2)），Windows平台见access_windows.go
+const (
+	accessRead  = 0x4
+	accessWrite = 0x2
+	accessExec  = 0x1
+)
+
+// Problem 深度检查发现的一个问题
+type Problem struct {
+	Warning bool // 只是提醒，不影响检查结果
+	Message string
+}
+
+// checker 收集深度检查发现的问题
+type checker struct {
+	prefix   string // 同步组的问题带上组名
+	problems []Problem
+}
+
+// errorf 记录一个错误
+func (ck *checker) errorf(format string, args ...interface{}) {
+	ck.problems = append(ck.problems, Problem{Message: ck.prefix + fmt.Sprintf(format, args...)})
+}
+
+// warnf 记录一个提醒
+func (ck *checker) warnf(format string, args ...interface{}) {
+	ck.problems = append(ck.problems, Problem{Warning: true, Message: ck.prefix + fmt.Sprintf(format, args...)})
+}
+
+// Check 深度检查配置能否在本机运行：目录是否存在且可读写、端口是否空闲、地址能否解析、密钥是否过于简单
+// 配置需先通过Validate；只检查不修改任何文件，返回发现的所有问题
+func (c *Config) Check() []Problem {
+	ck := &checker{}
+
+	// 同步组共用顶层的UDP端口和控制接口
+	ck.checkUDPPort(c.UDPPort)
+	ck.checkControlSocket(c)
+	if c.HasDefaultGroup() {
+		ck.checkNode(c)
+	}
+	for i := range c.Groups {
+		group := &c.Groups[i]
+		ck.prefix = "同步组 " + group.Name + ": "
+		ck.checkNode(c.GroupConfig(group))
+	}
+	return ck.problems
+}
+
+// checkNode 检查一个节点（顶层配置或同步组）的配置
+func (ck *checker) checkNode(cfg *Config) {
+	ck.checkKey(cfg.Key)
+
+	if cfg.WebServer != nil && cfg.WebServer.Enabled {
+		ck.checkTCPPort(cfg.WebServer.Port)
+		ck.checkDir("web_server.upload_dir", cfg.WebServer.UploadDir, true, true)
+	}
+
+	if cfg.IsMaster() {
+		ck.checkMaster(cfg)
+	} else {
+		ck.checkSlave(cfg)
+	}
+}
+
+// checkMaster 检查Master的监控目录、Slave地址和主备配置
+func (ck *checker) checkMaster(cfg *Config) {
+	for _, monitorPath := range cfg.MonitorPaths {
+		name := "监控路径 " + monitorPath.Path
+		// 监控目录不存在时Master只记录日志并跳过该路径
+		if !ck.checkDir(name, monitorPath.Path, false, false) {
+			continue
+		}
+		// 双向同步需写入Slave的修改
+		if monitorPath.Bidirectional {
+			if err := access(monitorPath.Path, accessWrite); err != nil {
+				ck.errorf("%s 不可写，无法应用双向同步的修改: %v", name, err)
+			}
+		}
+		for _, addr := range monitorPath.Slaves {
+			ck.checkAddr(name+" 的Slave", addr)
+		}
+		if len(monitorPath.Slaves) == 0 {
+			ck.warnf("%s 没有配置slaves", name)
+		}
+	}
+
+	if cfg.HAPeer != "" {
+		ck.checkAddr("ha_peer", cfg.HAPeer)
+		ck.checkFile("ha_state_file", cfg.HAStateFile)
+	}
+	ck.checkFile("state_dir", cfg.StateDir)
+}
+
+// checkSlave 检查Slave的同步目录、Master地址、中继下游和钩子
+func (ck *checker) checkSlave(cfg *Config) {
+	ck.checkDir("sync_path", cfg.SyncPath, true, true)
+	for name, root := range cfg.Targets {
+		ck.checkDir("目标 "+name, root, true, true)
+	}
+
+	if cfg.MasterAddr != "" {
+		ck.checkAddr("master_addr", cfg.MasterAddr)
+	}
+	for _, addr := range cfg.MasterAddrs {
+		ck.checkAddr("master_addrs", addr)
+	}
+	for _, addr := range cfg.RelaySlaves {
+		ck.checkAddr("relay_slaves", addr)
+	}
+
+	for _, h := range cfg.Hooks {
+		if h.URL == "" {
+			continue
+		}
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ck.errorf("钩子 %s 的url无效: %s", h.Name, h.URL)
+		}
+	}
+}
+
+// checkKey 检查密钥是否为示例密钥或过于简单
+func (ck *checker) checkKey(key string) {
+	if key == "12345678901234567890123456789012" {
+		ck.warnf("key使用了示例密钥，请更换为随机生成的密钥（如 openssl rand -hex 16）")
+		return
+	}
+	distinct := make(map[rune]bool)
+	for _, r := range key {
+		distinct[r] = true
+	}
+	if len(distinct) < 8 {
+		ck.warnf("key只包含 %d 种字符，过于简单", len(distinct))
+	}
+}
+
+// checkDir 检查目录存在、可读，writable时还需可写；create为true时目录不存在只检查能否创建
+// 返回目录是否存在且可读
+func (ck *checker) checkDir(name, path string, writable, create bool) bool {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if !create {
+			ck.errorf("%s 不存在", name)
+			return false
+		}
+		parent := existingParent(path)
+		if err := access(parent, accessWrite|accessExec); err != nil {
+			ck.errorf("%s 不存在且无法创建（%s 不可写）: %s", name, parent, path)
+			return false
+		}
+		ck.warnf("%s 不存在，启动时自动创建: %s", name, path)
+		return false
+	}
+	if err != nil {
+		ck.errorf("%s 无法访问: %v", name, err)
+		return false
+	}
+	if !info.IsDir() {
+		ck.errorf("%s 不是目录: %s", name, path)
+		return false
+	}
+	if err := access(path, accessRead|accessExec); err != nil {
+		ck.errorf("%s 不可读: %s: %v", name, path, err)
+		return false
+	}
+	if writable {
+		if err := access(path, accessWrite); err != nil {
+			ck.errorf("%s 不可写: %s: %v", name, path, err)
+		}
+	}
+	return true
+}
+
+// checkFile 检查文件可写，文件不存在时检查所在目录可写
+func (ck *checker) checkFile(name, path string) {
+	if _, err := os.Stat(path); err == nil {
+		if err := access(path, accessWrite); err != nil {
+			ck.errorf("%s 不可写: %s: %v", name, path, err)
+		}
+		return
+	}
+	parent := existingParent(path)
+	if err := access(parent, accessWrite|accessExec); err != nil {
+		ck.errorf("%s 无法创建（%s 不可写）: %s", name, parent, path)
+	}
+}
+
+// checkAddr 检查地址格式正确且主机名能够解析
+func (ck *checker) checkAddr(name, addr string) {
+	if _, err := net.ResolveUDPAddr("udp", addr); err != nil {
+		ck.errorf("%s 无法解析: %s: %v", name, addr, err)
+	}
+}
+
+// checkUDPPort 检查UDP端口空闲
+func (ck *checker) checkUDPPort(port int) {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		ck.errorf("udp_port %d 已被占用（节点正在运行时可忽略）: %v", port, err)
+		return
+	}
+	conn.Close()
+}
+
+// checkControlSocket 检查控制套接字所在目录可写、属组存在，以及权限是否允许其他用户访问
+func (ck *checker) checkControlSocket(c *Config) {
+	dir := filepath.Dir(c.ControlSocket)
+	if _, err := os.Stat(dir); err == nil {
+		if err := access(dir, accessWrite|accessExec); err != nil {
+			ck.errorf("control_socket 所在目录不可写: %s: %v", dir, err)
+		}
+	} else if err := access(existingParent(dir), accessWrite|accessExec); err != nil {
+		ck.errorf("control_socket 所在目录不存在且无法创建: %s", dir)
+	}
+	if c.ControlSocketGroup != "" {
+		if _, err := user.LookupGroup(c.ControlSocketGroup); err != nil {
+			ck.errorf("control_socket_group 不存在: %v", err)
+		}
+		// 默认路径按用户区分，其他用户执行命令时找不到
+		if c.ControlSocket == DefaultControlSocket(c.UDPPort) {
+			ck.warnf("设置了control_socket_group，请同时配置control_socket，默认路径 %s 按用户区分", c.ControlSocket)
+		}
+	}
+	if mode, err := c.ControlSocketPerm(); err == nil && mode&0002 != 0 {
+		ck.warnf("control_socket_mode %s 允许所有用户访问控制接口（可暂停同步、重新加载配置）", c.ControlSocketMode)
+	}
+}
+
+// checkTCPPort 检查Web服务的TCP端口空闲
+func (ck *checker) checkTCPPort(port int) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		ck.errorf("web_server.port %d 已被占用（节点正在运行时可忽略）: %v", port, err)
+		return
+	}
+	ln.Close()
+}
+
+// existingParent 获取路径最近的已存在的上级目录
+func existingParent(path string) string {
+	dir := filepath.Clean(path)
+	for {
+		parent := filepath.Dir(dir)
+		if _, err := os.Stat(parent); err == nil || parent == dir {
+			return parent
+		}
+		dir = parent
+	}
+}
+
+// Redacted 获取隐藏密钥和密码后的配置副本，用于输出
+func (c *Config) Redacted() *Config {
+	cfg := *c
+	cfg.Key = redact(cfg.Key)
+	if cfg.WebServer != nil {
+		web := *cfg.WebServer
+		web.Password = redact(web.Password)
+		cfg.WebServer = &web
+	}
+	if len(cfg.Groups) > 0 {
+		cfg.Groups = make([]SyncGroup, len(c.Groups))
+		for i := range c.Groups {
+			cfg.Groups[i] = SyncGroup{Name: c.Groups[i].Name, Config: *c.Groups[i].Config.Redacted()}
+		}
+	}
+	return &cfg
+}
+
+// Effective 获取同步组展开为完整配置（含继承的配置项和默认值）后的配置副本
+func (c *Config) Effective() *Config {
+	cfg := *c
+	if len(cfg.Groups) > 0 {
+		cfg.Groups = make([]SyncGroup, len(c.Groups))
+		for i := range c.Groups {
+			cfg.Groups[i] = SyncGroup{Name: c.Groups[i].Name, Config: *c.GroupConfig(&c.Groups[i])}
+		}
+	}
+	return &cfg
+}
+
+// redact 隐藏非空的敏感配置项
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "******"
+}
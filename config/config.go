@@ -0,0 +1,363 @@
+// Package config xsync的配置定义、加载、默认值和验证
+// main、master、slave和webserver共用同一套配置类型
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"xsync/backup"
+	"xsync/hook"
+	"xsync/replica"
+	"xsync/watcher"
+)
+
+// Config 主配置结构
+type Config struct {
+	NodeID       string        `yaml:"node_id"`
+	Role         string        `yaml:"role"` // "master" or "slave"
+	Key          string        `yaml:"key"`  // AES-256密钥
+	UDPPort      int           `yaml:"udp_port"`
+	MonitorPaths []MonitorPath `yaml:"monitor_paths"` // Master专用
+	MasterAddr   string        `yaml:"master_addr"`   // Slave专用
+	SyncPath     string        `yaml:"sync_path"`     // Slave专用
+	WebServer    *WebConfig    `yaml:"web_server"`    // Web服务配置（Slave上额外提供历史版本接口）
+
+	SendWorkers  int `yaml:"send_workers"`   // Master专用：每个Slave同时发送的数据包数，默认4
+	SendBufferMB int `yaml:"send_buffer_mb"` // Master专用：等待发送的文件内容占用的内存上限（MB），默认256
+
+	HAPeer      string   `yaml:"ha_peer"`       // Master专用：高可用对端Master的地址，为空不启用主备
+	HAStandby   bool     `yaml:"ha_standby"`    // Master专用：作为备用Master，对端在线时不主动接管
+	HATimeout   Duration `yaml:"ha_timeout"`    // Master专用：超过该时间未收到对端心跳则接管，默认15s
+	HAStateFile string   `yaml:"ha_state_file"` // Master专用：保存任期的文件，默认xsync-ha.json
+
+	StateDir string `yaml:"state_dir"` // Master专用：保存全量同步进度等运行状态的目录，默认xsync-state
+
+	MasterAddrs []string `yaml:"master_addrs"` // Slave专用：主备Master的地址列表，跟随任期最新的Master
+
+	Bidirectional  bool   `yaml:"bidirectional"`   // Slave专用：将本地修改同步回Master
+	ConflictPolicy string `yaml:"conflict_policy"` // Slave专用：冲突处理策略 newest/master/keep_both，默认newest
+	DriftPolicy    string `yaml:"drift_policy"`    // Slave专用：本地变更处理 revert/quarantine/alert，为空不检测
+
+	Mirror          bool `yaml:"mirror"`            // Slave专用：全量同步后删除Master上不存在的文件
+	MirrorTrash     bool `yaml:"mirror_trash"`      // Slave专用：多余文件移入.xsync/trash而不是直接删除
+	MirrorMaxDelete int  `yaml:"mirror_max_delete"` // Slave专用：删除比例超过该百分比时中止清理，默认50
+
+	Versioning   bool `yaml:"versioning"`    // Slave专用：覆盖或删除文件前保存历史版本到.xsync/versions
+	VersionsKeep int  `yaml:"versions_keep"` // Slave专用：每个文件保留的版本数，与versions_days都为0时默认10
+	VersionsDays int  `yaml:"versions_days"` // Slave专用：历史版本保留天数，0表示不按时间清理
+
+	SnapshotInterval   Minutes `yaml:"snapshot_interval"`    // Slave专用：定期快照间隔（纯数字按分钟计算），0表示不定期创建
+	SnapshotKeepLast   int     `yaml:"snapshot_keep_last"`   // Slave专用：保留最近N个快照
+	SnapshotKeepHourly int     `yaml:"snapshot_keep_hourly"` // Slave专用：保留最近N小时每小时的最后一个快照
+	SnapshotKeepDaily  int     `yaml:"snapshot_keep_daily"`  // Slave专用：保留最近N天每天的最后一个快照（三项都为0时保留最近24个和7天）
+
+	Hooks []hook.Config `yaml:"hooks"` // Slave专用：文件写入后按路径触发的命令或HTTP回调
+
+	BatchTimeout  Duration `yaml:"batch_timeout"`   // Slave专用：批次未收齐的最长等待时间，超时丢弃并重新全量同步，默认120s
+	BatchSwap     bool     `yaml:"batch_swap"`      // Slave专用：批次提交时生成新的发布目录，通过切换sync_path符号链接原子替换
+	BatchSwapKeep int      `yaml:"batch_swap_keep"` // Slave专用：保留的发布目录数量（含当前），默认3
+
+	RelaySlaves         []string `yaml:"relay_slaves"`          // Slave专用：作为中继，把应用的变更转发给这些下游Slave（下游的master_addr指向本节点）
+	RelayReportInterval Duration `yaml:"relay_report_interval"` // Slave专用：向上游报告下游状态的间隔，默认30s
+
+	Targets map[string]string `yaml:"targets"` // Slave专用：允许写入的目标（名称 -> 本地目录），Master的monitor_paths通过target选择写入的目录
+
+	Groups []SyncGroup `yaml:"groups"` // 同步组：共用本节点端口、各自使用独立密钥和路径的同步配置
+
+	ControlSocket      string `yaml:"control_socket"`       // 本地控制接口的Unix套接字路径，xsync status等命令通过它访问运行中的节点，默认root为/run/xsync/xsync-<udp_port>.sock，其他用户为$XDG_RUNTIME_DIR/xsync/xsync-<udp_port>.sock
+	ControlSocketMode  string `yaml:"control_socket_mode"`  // 控制套接字的权限（八进制），默认0600只允许运行节点的用户访问
+	ControlSocketGroup string `yaml:"control_socket_group"` // 控制套接字的属组，配合0660允许该组的用户使用控制命令
+
+	Include []string `yaml:"include,omitempty"` // 合并的其他配置文件（相对当前文件，支持通配符），本文件的配置优先
+}
+
+// SyncGroup 同步组配置
+// 字段与顶层配置相同，未配置的node_id/role/key/udp_port/master_addr继承顶层配置；两端同名的同步组之间互相同步
+type SyncGroup struct {
+	Name   string `yaml:"name"`
+	Config `yaml:",inline"`
+}
+
+// WebConfig Web服务配置
+type WebConfig struct {
+	Enabled   bool   `yaml:"enabled"`    // 是否启用Web服务
+	Port      int    `yaml:"port"`       // Web服务端口，默认8081
+	Username  string `yaml:"username"`   // Basic Auth用户名
+	Password  string `yaml:"password"`   // Basic Auth密码
+	UploadDir string `yaml:"upload_dir"` // 上传目录，默认uploads
+}
+
+// MonitorPath Master监控路径配置
+type MonitorPath struct {
+	Path    string   `yaml:"path"`
+	Slaves  []string `yaml:"slaves"`
+	Include []string `yaml:"include"`  // 包含规则（gitignore语法），为空时包含所有文件
+	Exclude []string `yaml:"exclude"`  // 排除规则（gitignore语法），可在目录中用.xsyncignore补充
+	MinSize int64    `yaml:"min_size"` // 最小文件大小（字节）
+	MaxSize int64    `yaml:"max_size"` // 最大文件大小（字节）
+	MaxAge  Duration `yaml:"max_age"`  // 只同步该时长内修改过的文件（纯数字按秒计算）
+
+	WatchMode    string   `yaml:"watch_mode"`    // 监控方式: auto/fsnotify/poll，默认auto
+	PollInterval Duration `yaml:"poll_interval"` // 轮询间隔，默认10s
+	PollHash     bool     `yaml:"poll_hash"`     // 轮询时比较文件内容哈希
+
+	DebounceMs       Millis `yaml:"debounce_ms"`        // 防抖动时间（纯数字按毫秒计算），默认5s
+	MaxDelayMs       Millis `yaml:"max_delay_ms"`       // 持续写入的文件最长延迟，0表示不限制
+	StableChecks     int    `yaml:"stable_checks"`      // 发送前大小和修改时间需连续N次采样不变，默认1
+	StableIntervalMs Millis `yaml:"stable_interval_ms"` // 稳定性采样间隔，默认1s
+
+	Bidirectional  bool   `yaml:"bidirectional"`   // 双向同步：接收Slave的修改并转发给其他Slave
+	ConflictPolicy string `yaml:"conflict_policy"` // 冲突处理策略: newest/master/keep_both，默认newest
+
+	PreSend []hook.PreSendConfig `yaml:"pre_send"` // 发送前钩子：按顺序检查变更的文件，可拒绝或改写内容
+
+	Batch        bool   `yaml:"batch"`          // 批量同步：一组变更发送完成后由Slave一起应用
+	BatchQuietMs Millis `yaml:"batch_quiet_ms"` // 最后一个事件后等待多久再发送整批，默认3s
+	BatchMarker  string `yaml:"batch_marker"`   // 标记文件（相对路径），存在时表示发布未完成，继续等待
+	BatchMaxMs   Millis `yaml:"batch_max_ms"`   // 批次最长等待时间，默认10m
+
+	Target string `yaml:"target"` // 目标名称：Slave写入targets中同名的目录，为空时写入sync_path
+}
+
+// 默认值
+const (
+	DefaultSendWorkers     = 4
+	DefaultSendBufferMB    = 256
+	DefaultHAStateFile     = "xsync-ha.json"
+	DefaultStateDir        = "xsync-state"
+	DefaultWebPort         = 8081
+	DefaultUploadDir       = "uploads"
+	DefaultMirrorMaxDelete = 50
+	DefaultBatchSwapKeep   = 3
+	DefaultStableChecks    = 1
+
+	DefaultControlSocketMode = "0600"
+)
+
+// 默认时长
+var (
+	DefaultHATimeout           = Duration(15 * time.Second)
+	DefaultBatchTimeout        = Duration(120 * time.Second)
+	DefaultRelayReportInterval = Duration(30 * time.Second)
+	DefaultDebounce            = Millis(5 * time.Second)
+	DefaultPollInterval        = Duration(10 * time.Second)
+	DefaultStableInterval      = Millis(time.Second)
+	DefaultBatchQuiet          = Millis(3 * time.Second)
+	DefaultBatchMax            = Millis(600 * time.Second)
+)
+
+// DefaultControlSocket 获取控制接口套接字的默认路径，按UDP端口区分同一台机器上的多个节点
+// root使用/run/xsync，其他用户使用$XDG_RUNTIME_DIR/xsync，都不可用时使用临时目录下该用户的xsync-<uid>目录
+func DefaultControlSocket(udpPort int) string {
+	name := fmt.Sprintf("xsync-%d.sock", udpPort)
+	if os.Geteuid() == 0 {
+		return filepath.Join("/run/xsync", name)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "xsync", name)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("xsync-%d", os.Geteuid()), name)
+}
+
+// ControlSocketPerm 解析控制套接字的权限
+func (c *Config) ControlSocketPerm() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.ControlSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("control_socket_mode必须是八进制的权限（如0600、0660），当前为%q", c.ControlSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// IsMaster 判断是否为Master节点
+func (c *Config) IsMaster() bool {
+	return c.Role == "master"
+}
+
+// IsSlave 判断是否为Slave节点
+func (c *Config) IsSlave() bool {
+	return c.Role == "slave"
+}
+
+// GroupConfig 获取同步组的完整配置，未配置的node_id/role/key/udp_port/master_addr继承顶层配置
+func (c *Config) GroupConfig(group *SyncGroup) *Config {
+	cfg := group.Config
+	cfg.Groups = nil
+	if cfg.NodeID == "" {
+		cfg.NodeID = c.NodeID
+	}
+	if cfg.Role == "" {
+		cfg.Role = c.Role
+	}
+	if cfg.Key == "" {
+		cfg.Key = c.Key
+	}
+	cfg.UDPPort = c.UDPPort
+	cfg.ControlSocket, cfg.ControlSocketMode, cfg.ControlSocketGroup = c.ControlSocket, c.ControlSocketMode, c.ControlSocketGroup
+	if cfg.MasterAddr == "" && len(cfg.MasterAddrs) == 0 {
+		cfg.MasterAddr, cfg.MasterAddrs = c.MasterAddr, c.MasterAddrs
+	}
+	// 每个同步组的Master任期独立保存
+	if cfg.HAStateFile == "" {
+		cfg.HAStateFile = "xsync-ha-" + group.Name + ".json"
+	}
+	if cfg.StateDir == "" {
+		cfg.StateDir = DefaultStateDir + "-" + group.Name
+	}
+	cfg.SetDefaults()
+	return &cfg
+}
+
+// FindGroup 按名称查找同步组
+func (c *Config) FindGroup(name string) *SyncGroup {
+	for i := range c.Groups {
+		if c.Groups[i].Name == name {
+			return &c.Groups[i]
+		}
+	}
+	return nil
+}
+
+// HasDefaultGroup 判断顶层配置本身是否包含同步配置（Master的monitor_paths或Slave的sync_path）
+// 没有配置groups时总是返回true
+func (c *Config) HasDefaultGroup() bool {
+	if len(c.Groups) == 0 {
+		return true
+	}
+	if c.IsMaster() {
+		return len(c.MonitorPaths) > 0
+	}
+	return c.SyncPath != ""
+}
+
+// SetDefaults 为未配置的项填充默认值，负数等无效值保留给Validate报错
+// 同步组的默认值在GroupConfig中填充
+func (c *Config) SetDefaults() {
+	if c.ControlSocket == "" {
+		c.ControlSocket = DefaultControlSocket(c.UDPPort)
+	}
+	if c.ControlSocketMode == "" {
+		c.ControlSocketMode = DefaultControlSocketMode
+	}
+	if c.WebServer != nil && c.WebServer.Enabled {
+		if c.WebServer.Port == 0 {
+			c.WebServer.Port = DefaultWebPort
+		}
+		if c.WebServer.UploadDir == "" {
+			c.WebServer.UploadDir = DefaultUploadDir
+		}
+	}
+
+	switch {
+	case c.IsMaster():
+		if c.SendWorkers == 0 {
+			c.SendWorkers = DefaultSendWorkers
+		}
+		if c.SendBufferMB == 0 {
+			c.SendBufferMB = DefaultSendBufferMB
+		}
+		if c.StateDir == "" {
+			c.StateDir = DefaultStateDir
+		}
+		if c.HAPeer != "" {
+			if c.HATimeout == 0 {
+				c.HATimeout = DefaultHATimeout
+			}
+			if c.HAStateFile == "" {
+				c.HAStateFile = DefaultHAStateFile
+			}
+		}
+		for i := range c.MonitorPaths {
+			c.MonitorPaths[i].SetDefaults()
+		}
+
+	case c.IsSlave():
+		if c.Bidirectional && c.ConflictPolicy == "" {
+			c.ConflictPolicy = replica.PolicyNewest
+		}
+		if c.Mirror && c.MirrorMaxDelete == 0 {
+			c.MirrorMaxDelete = DefaultMirrorMaxDelete
+		}
+		if c.Versioning && c.VersionsKeep == 0 && c.VersionsDays == 0 {
+			c.VersionsKeep = backup.DefaultKeep
+		}
+		if c.SnapshotKeepLast == 0 && c.SnapshotKeepHourly == 0 && c.SnapshotKeepDaily == 0 {
+			c.SnapshotKeepLast, c.SnapshotKeepDaily = 24, 7
+		}
+		if c.BatchTimeout == 0 {
+			c.BatchTimeout = DefaultBatchTimeout
+		}
+		if c.BatchSwap && c.BatchSwapKeep == 0 {
+			c.BatchSwapKeep = DefaultBatchSwapKeep
+		}
+		if len(c.RelaySlaves) > 0 && c.RelayReportInterval == 0 {
+			c.RelayReportInterval = DefaultRelayReportInterval
+		}
+	}
+}
+
+// SetDefaults 为监控路径未配置的项填充默认值
+func (p *MonitorPath) SetDefaults() {
+	if p.WatchMode == "" {
+		p.WatchMode = watcher.BackendAuto
+	}
+	if p.PollInterval == 0 {
+		p.PollInterval = DefaultPollInterval
+	}
+	if p.DebounceMs == 0 {
+		p.DebounceMs = DefaultDebounce
+	}
+	if p.StableChecks == 0 {
+		p.StableChecks = DefaultStableChecks
+	}
+	if p.StableIntervalMs == 0 {
+		p.StableIntervalMs = DefaultStableInterval
+	}
+	if p.Bidirectional && p.ConflictPolicy == "" {
+		p.ConflictPolicy = replica.PolicyNewest
+	}
+	if p.Batch {
+		if p.BatchQuietMs == 0 {
+			p.BatchQuietMs = DefaultBatchQuiet
+		}
+		if p.BatchMaxMs == 0 {
+			p.BatchMaxMs = DefaultBatchMax
+		}
+	}
+}
+
+// FilterConfig 获取监控路径的过滤规则配置
+func (p MonitorPath) FilterConfig() watcher.FilterConfig {
+	return watcher.FilterConfig{
+		Include: p.Include,
+		Exclude: p.Exclude,
+		MinSize: p.MinSize,
+		MaxSize: p.MaxSize,
+		MaxAge:  p.MaxAge.Duration(),
+	}
+}
+
+// WatcherOptions 获取监控路径的文件监控器选项
+func (p MonitorPath) WatcherOptions(filter *watcher.Filter) watcher.Options {
+	return watcher.Options{
+		DebounceMs:     int(p.DebounceMs.Duration().Milliseconds()),
+		Filter:         filter,
+		Backend:        p.WatchMode,
+		PollInterval:   p.PollInterval.Duration(),
+		PollHash:       p.PollHash,
+		MaxDelay:       p.MaxDelayMs.Duration(),
+		StableChecks:   p.StableChecks,
+		StableInterval: p.StableIntervalMs.Duration(),
+	}
+}
+
+// Equal 判断两个Web服务配置是否相同（都为nil时相同）
+func (w *WebConfig) Equal(other *WebConfig) bool {
+	if w == nil || other == nil {
+		return w == other
+	}
+	return *w == *other
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration 时长配置，可写为带单位的字符串（如"30s"、"1m30s"），纯数字按秒计算
+type Duration time.Duration
+
+// Millis 时长配置，纯数字按毫秒计算（用于*_ms配置项，兼容原有写法）
+type Millis time.Duration
+
+// Minutes 时长配置，纯数字按分钟计算
+type Minutes time.Duration
+
+// parseDuration 解析时长：纯数字按unit计算，否则按time.ParseDuration解析
+func parseDuration(value string, unit time.Duration, unitName string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时长: %q（示例: 500ms、30s、5m、1h30m，纯数字按%s计算）", value, unitName)
+	}
+	return d, nil
+}
+
+// decodeDuration 从YAML节点解析时长，错误信息带上行号
+func decodeDuration(node *yaml.Node, unit time.Duration, unitName string) (time.Duration, error) {
+	if node.Kind != yaml.ScalarNode {
+		return 0, fmt.Errorf("line %d: 时长必须是数字或字符串", node.Line)
+	}
+	d, err := parseDuration(node.Value, unit, unitName)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: %v", node.Line, err)
+	}
+	return d, nil
+}
+
+// Duration 获取time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String 获取时长的字符串形式
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// UnmarshalYAML 解析YAML中的时长
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := decodeDuration(node, time.Second, "秒")
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalText 解析环境变量中的时长
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := parseDuration(string(text), time.Second, "秒")
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalYAML 输出带单位的时长
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// Duration 获取time.Duration
+func (d Millis) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String 获取时长的字符串形式
+func (d Millis) String() string {
+	return time.Duration(d).String()
+}
+
+// UnmarshalYAML 解析YAML中的时长
+func (d *Millis) UnmarshalYAML(node *yaml.Node) error {
+	v, err := decodeDuration(node, time.Millisecond, "毫秒")
+	if err != nil {
+		return err
+	}
+	*d = Millis(v)
+	return nil
+}
+
+// UnmarshalText 解析环境变量中的时长
+func (d *Millis) UnmarshalText(text []byte) error {
+	v, err := parseDuration(string(text), time.Millisecond, "毫秒")
+	if err != nil {
+		return err
+	}
+	*d = Millis(v)
+	return nil
+}
+
+// MarshalYAML 输出带单位的时长
+func (d Millis) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// Duration 获取time.Duration
+func (d Minutes) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String 获取时长的字符串形式
+func (d Minutes) String() string {
+	return time.Duration(d).String()
+}
+
+// UnmarshalYAML 解析YAML中的时长
+func (d *Minutes) UnmarshalYAML(node *yaml.Node) error {
+	v, err := decodeDuration(node, time.Minute, "分钟")
+	if err != nil {
+		return err
+	}
+	*d = Minutes(v)
+	return nil
+}
+
+// UnmarshalText 解析环境变量中的时长
+func (d *Minutes) UnmarshalText(text []byte) error {
+	v, err := parseDuration(string(text), time.Minute, "分钟")
+	if err != nil {
+		return err
+	}
+	*d = Minutes(v)
+	return nil
+}
+
+// MarshalYAML 输出带单位的时长
+func (d Minutes) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
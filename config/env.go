@@ -0,0 +1,167 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 环境变量覆盖配置项时使用的前缀
+const EnvPrefix = "XSYNC_"
+
+// applyEnv 用XSYNC_*环境变量覆盖配置项
+// 变量名为配置项路径的大写形式，例如XSYNC_UDP_PORT、XSYNC_WEB_SERVER_PORT；
+// 列表中的元素按下标覆盖已有元素，例如XSYNC_MONITOR_PATHS_0_PATH、XSYNC_GROUPS_1_KEY；
+// 字符串列表用逗号分隔，映射写为k1=v1,k2=v2
+func applyEnv(cfg *Config) error {
+	env := make(map[string]string)
+	for _, item := range os.Environ() {
+		if i := strings.Index(item, "="); i > 0 && strings.HasPrefix(item[:i], EnvPrefix) {
+			env[item[:i]] = item[i+1:]
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return applyEnvStruct(reflect.ValueOf(cfg).Elem(), EnvPrefix, env)
+}
+
+// applyEnvStruct 按字段的YAML名称覆盖结构体中的字段
+func applyEnvStruct(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := yamlName(field)
+		if inline {
+			if err := applyEnvStruct(v.Field(i), prefix, env); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if err := applyEnvValue(v.Field(i), prefix+strings.ToUpper(name), env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnvValue 用名为envName的环境变量（或以其为前缀的变量）覆盖一个字段
+func applyEnvValue(v reflect.Value, envName string, env map[string]string) error {
+	if isEnvScalar(v.Type()) {
+		value, ok := env[envName]
+		if !ok {
+			return nil
+		}
+		if err := setEnvScalar(v, value); err != nil {
+			return fmt.Errorf("环境变量 %s: %v", envName, err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		// 只有存在相关的环境变量时才创建，避免凭空启用web_server等可选配置
+		if v.IsNil() {
+			if !hasEnvPrefix(env, envName+"_") {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return applyEnvValue(v.Elem(), envName, env)
+	case reflect.Struct:
+		return applyEnvStruct(v, envName+"_", env)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := applyEnvValue(v.Index(i), envName+"_"+strconv.Itoa(i), env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isEnvScalar 判断类型是否可以直接用一个环境变量的值设置
+func isEnvScalar(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// setEnvScalar 解析环境变量的值并设置字段
+func setEnvScalar(v reflect.Value, value string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("无效的布尔值: %q（可选 true/false）", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无效的整数: %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无效的整数: %q", value)
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item))
+			}
+		}
+		v.Set(list)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			i := strings.Index(item, "=")
+			if i <= 0 {
+				return fmt.Errorf("无效的映射项: %q（格式为 k1=v1,k2=v2）", item)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(item[:i])), reflect.ValueOf(strings.TrimSpace(item[i+1:])))
+		}
+		v.Set(m)
+	}
+	return nil
+}
+
+// hasEnvPrefix 判断是否存在以prefix开头的环境变量
+func hasEnvPrefix(env map[string]string, prefix string) bool {
+	for name := range env {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load 加载配置文件：合并include的文件，应用XSYNC_*环境变量覆盖，填充默认值并验证
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Read 读取配置文件并合并include的文件、应用环境变量覆盖，不填充默认值也不验证
+func Read(path string) (*Config, error) {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if err := readFile(path, nil, merged); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := merged.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", explainError(err))
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+	cfg.Include = nil
+	return &cfg, nil
+}
+
+// readFile 读取一个配置文件并合并到merged：先合并它include的文件，再合并它自身的配置（优先级更高）
+// stack为正在读取的文件链，用于检测循环引用
+func readFile(path string, stack []string, merged *yaml.Node) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	for _, p := range stack {
+		if p == absPath {
+			return fmt.Errorf("配置文件循环引用: %s", strings.Join(append(stack, absPath), " -> "))
+		}
+	}
+	stack = append(stack, absPath)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if len(stack) > 1 {
+			return fmt.Errorf("读取配置文件失败: %v（由 %s 引用）", err, stack[len(stack)-2])
+		}
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	// 每个文件单独严格解析，未知配置项和类型错误带上文件名和行号
+	var check Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&check); err != nil && err != io.EOF {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, explainError(err))
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, explainError(err))
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("解析配置文件 %s 失败: 第%d行: 顶层必须是键值映射", path, root.Line)
+	}
+
+	for _, pattern := range check.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		files, err := includeFiles(pattern)
+		if err != nil {
+			return fmt.Errorf("配置文件 %s 的include: %v", path, err)
+		}
+		for _, file := range files {
+			if err := readFile(file, stack, merged); err != nil {
+				return err
+			}
+		}
+	}
+
+	mergeNode(merged, withoutKey(root, "include"))
+	return nil
+}
+
+// includeFiles 获取include匹配的文件：含通配符时按文件名排序且允许没有匹配，否则文件必须存在
+func includeFiles(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("无效的通配符 %s: %v", pattern, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// withoutKey 获取去掉指定键的映射节点
+func withoutKey(node *yaml.Node, key string) *yaml.Node {
+	result := *node
+	result.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != key {
+			result.Content = append(result.Content, node.Content[i], node.Content[i+1])
+		}
+	}
+	return &result
+}
+
+// mergeNode 把overlay合并到base：映射逐项合并，列表和其他值整体替换
+func mergeNode(base, overlay *yaml.Node) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if base.Content[j].Value != key.Value {
+				continue
+			}
+			if base.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				mergeNode(base.Content[j+1], value)
+			} else {
+				base.Content[j+1] = value
+			}
+			found = true
+			break
+		}
+		if !found {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+}
+
+var (
+	unknownFieldRe = regexp.MustCompile(`field (\S+) not found in type (\S+)`)
+	typeRe         = regexp.MustCompile("cannot unmarshal !!(\\w+)(?: `(.*)`)? into (\\S+)")
+	lineRe         = regexp.MustCompile(`line (\d+):`)
+)
+
+// explainError 将YAML解析错误转换为更易读的提示：未知配置项给出相近的配置项名称
+func explainError(err error) error {
+	var messages []string
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	for i, msg := range messages {
+		if m := unknownFieldRe.FindStringSubmatch(msg); m != nil {
+			hint := "未知的配置项 " + m[1]
+			if suggestion := suggestKey(m[1]); suggestion != "" {
+				hint += "（是否为 " + suggestion + "？）"
+			}
+			msg = strings.Replace(msg, m[0], hint, 1)
+		} else if m := typeRe.FindStringSubmatch(msg); m != nil {
+			msg = strings.Replace(msg, m[0], fmt.Sprintf("类型不正确，需要%s，实际为%s", typeName(m[3]), yamlKindName(m[1], m[2])), 1)
+		}
+		messages[i] = lineRe.ReplaceAllString(msg, "第${1}行:")
+	}
+	return fmt.Errorf("%s", strings.Join(messages, "; "))
+}
+
+// typeName 获取Go类型对应的配置值类型说明
+func typeName(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return "列表"
+	case strings.HasPrefix(goType, "map["), strings.HasPrefix(goType, "config."), strings.HasPrefix(goType, "hook."):
+		return "键值映射"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "整数"
+	case goType == "bool":
+		return "true或false"
+	case goType == "string":
+		return "字符串"
+	}
+	return goType
+}
+
+// yamlKindName 获取YAML值类型的说明
+func yamlKindName(tag, value string) string {
+	switch tag {
+	case "seq":
+		return "列表"
+	case "map":
+		return "键值映射"
+	}
+	return value
+}
+
+// suggestKey 在所有配置项中查找与name最相近的名称，差距过大时返回空
+func suggestKey(name string) string {
+	limit := len(name) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	best, bestDistance := "", limit+1
+	for _, key := range knownKeys() {
+		if d := editDistance(name, key); d < bestDistance {
+			best, bestDistance = key, d
+		}
+	}
+	return best
+}
+
+// knownKeys 获取配置结构中出现的所有配置项名称
+func knownKeys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t.String()] {
+			return
+		}
+		seen[t.String()] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _ := yamlName(field)
+			if name == "-" {
+				continue
+			}
+			if name != "" && !seen["key:"+name] {
+				seen["key:"+name] = true
+				keys = append(keys, name)
+			}
+			walk(field.Type)
+		}
+	}
+	walk(reflect.TypeOf(Config{}))
+	return keys
+}
+
+// yamlName 获取字段的YAML名称，inline字段返回空名称和true
+func yamlName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("yaml")
+	name := strings.Split(tag, ",")[0]
+	inline := strings.Contains(tag, ",inline")
+	if inline {
+		return "", true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
+
+// editDistance 计算两个字符串的编辑距离
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// writeConfig 在目录下写入配置文件，返回文件路径
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		unit    time.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30", time.Second, 30 * time.Second, false},
+		{" 500 ", time.Millisecond, 500 * time.Millisecond, false},
+		{"2", time.Minute, 2 * time.Minute, false},
+		{"1m30s", time.Second, 90 * time.Second, false},
+		{"250ms", time.Minute, 250 * time.Millisecond, false},
+		{"-5", time.Second, -5 * time.Second, false},
+		{"5x", time.Second, 0, true},
+		{"", time.Second, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value, tt.unit, "秒")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) 错误 = %v, 期望错误 %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, 期望 %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDurationYAML(t *testing.T) {
+	var v struct {
+		D Duration `yaml:"d"`
+		M Millis   `yaml:"m"`
+		N Minutes  `yaml:"x"`
+	}
+	if err := yaml.Unmarshal([]byte("d: 10\nm: 1500\nx: 3\n"), &v); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if v.D.Duration() != 10*time.Second || v.M.Duration() != 1500*time.Millisecond || v.N.Duration() != 3*time.Minute {
+		t.Errorf("解析结果 = %v %v %v", v.D, v.M, v.N)
+	}
+
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	if want := "d: 10s\nm: 1.5s\nx: 3m0s\n"; string(out) != want {
+		t.Errorf("序列化结果 = %q, 期望 %q", out, want)
+	}
+
+	for _, doc := range []string{"d: abc\n", "d: [1]\n"} {
+		err := yaml.Unmarshal([]byte(doc), &v)
+		if err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("解析 %q 应返回带行号的错误, 实际为 %v", doc, err)
+		}
+	}
+}
+
+func TestLoadInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yaml", `
+udp_port: 9000
+key: `+testKey+`
+web_server:
+  enabled: true
+  port: 8000
+monitor_paths:
+  - path: /base
+    slaves: ["10.0.0.1:9000"]
+`)
+	writeConfig(t, filepath.Join(dir), "z-extra.yaml", "send_workers: 8\n")
+	path := writeConfig(t, dir, "main.yaml", `
+include: [base.yaml, "z-*.yaml"]
+node_id: m1
+role: master
+web_server:
+  port: 8080
+monitor_paths:
+  - path: /data
+    slaves: ["10.0.0.2:9000"]
+    debounce_ms: 200
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.UDPPort != 9000 || cfg.Key != testKey || cfg.SendWorkers != 8 {
+		t.Errorf("include的配置未生效: udp_port=%d send_workers=%d", cfg.UDPPort, cfg.SendWorkers)
+	}
+	if !cfg.WebServer.Enabled || cfg.WebServer.Port != 8080 {
+		t.Errorf("映射应逐项合并: %+v", cfg.WebServer)
+	}
+	if len(cfg.MonitorPaths) != 1 || cfg.MonitorPaths[0].Path != "/data" {
+		t.Errorf("列表应整体替换: %+v", cfg.MonitorPaths)
+	}
+	if d := cfg.MonitorPaths[0].DebounceMs.Duration(); d != 200*time.Millisecond {
+		t.Errorf("debounce_ms = %v, 期望 200ms", d)
+	}
+	if cfg.Include != nil {
+		t.Errorf("include应在合并后清空: %v", cfg.Include)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{"未知配置项", map[string]string{"main.yaml": "node_id: a\nudp_prot: 1\n"}, "udp_port"},
+		{"类型错误", map[string]string{"main.yaml": "udp_port: abc\n"}, "main.yaml"},
+		{"循环引用", map[string]string{"main.yaml": "include: [b.yaml]\n", "b.yaml": "include: [main.yaml]\n"}, "循环引用"},
+		{"引用的文件不存在", map[string]string{"main.yaml": "include: [missing.yaml]\n"}, "由"},
+		{"顶层不是映射", map[string]string{"main.yaml": "- a\n"}, "需要键值映射"},
+		{"验证失败", map[string]string{"main.yaml": "node_id: a\nrole: other\n"}, "role"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeConfig(t, dir, name, content)
+			}
+			_, err := Load(filepath.Join(dir, "main.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load 错误 = %v, 期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvOverride(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "main.yaml", `
+node_id: m1
+role: master
+udp_port: 9000
+monitor_paths:
+  - path: /data
+    slaves: ["10.0.0.2:9000"]
+`)
+
+	t.Setenv("XSYNC_KEY", testKey)
+	t.Setenv("XSYNC_UDP_PORT", "9100")
+	t.Setenv("XSYNC_HA_TIMEOUT", "20")
+	t.Setenv("XSYNC_MONITOR_PATHS_0_SLAVES", "a:1, b:2,")
+	t.Setenv("XSYNC_MONITOR_PATHS_0_DEBOUNCE_MS", "1s")
+	t.Setenv("XSYNC_MONITOR_PATHS_1_PATH", "/ignored")
+	t.Setenv("XSYNC_WEB_SERVER_ENABLED", "true")
+
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	if cfg.Key != testKey || cfg.UDPPort != 9100 || cfg.HATimeout.Duration() != 20*time.Second {
+		t.Errorf("标量覆盖未生效: key=%q udp_port=%d ha_timeout=%v", cfg.Key, cfg.UDPPort, cfg.HATimeout)
+	}
+	if len(cfg.MonitorPaths) != 1 {
+		t.Fatalf("不应为不存在的列表元素创建配置: %+v", cfg.MonitorPaths)
+	}
+	if want := []string{"a:1", "b:2"}; !reflect.DeepEqual(cfg.MonitorPaths[0].Slaves, want) {
+		t.Errorf("slaves = %q, 期望 %q", cfg.MonitorPaths[0].Slaves, want)
+	}
+	if d := cfg.MonitorPaths[0].DebounceMs.Duration(); d != time.Second {
+		t.Errorf("debounce_ms = %v, 期望 1s", d)
+	}
+	if cfg.WebServer == nil || !cfg.WebServer.Enabled {
+		t.Errorf("存在相关环境变量时应创建web_server: %+v", cfg.WebServer)
+	}
+}
+
+func TestEnvOverrideErrors(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"XSYNC_UDP_PORT", "abc"},
+		{"XSYNC_BIDIRECTIONAL", "yes please"},
+		{"XSYNC_HA_TIMEOUT", "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, t.TempDir(), "main.yaml", "node_id: a\n")
+			t.Setenv(tt.name, tt.value)
+			_, err := Read(path)
+			if err == nil || !strings.Contains(err.Error(), tt.name) {
+				t.Errorf("Read 错误 = %v, 期望包含 %s", err, tt.name)
+			}
+		})
+	}
+}
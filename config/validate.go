@@ -0,0 +1,367 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"xsync/protocol"
+	"xsync/replica"
+	"xsync/watcher"
+)
+
+// Validate 验证配置有效性
+func (c *Config) Validate() error {
+	if c.NodeID == "" {
+		return fmt.Errorf("node_id不能为空")
+	}
+
+	if c.Role != "master" && c.Role != "slave" {
+		return fmt.Errorf("role必须是master或slave，当前为%q", c.Role)
+	}
+
+	if len(c.Key) != 32 {
+		return fmt.Errorf("key必须是32字节的AES-256密钥，当前为%d字节（可通过环境变量XSYNC_KEY设置）", len(c.Key))
+	}
+
+	if c.UDPPort <= 0 || c.UDPPort > 65535 {
+		return fmt.Errorf("udp_port必须在1-65535范围内，当前为%d", c.UDPPort)
+	}
+
+	if _, err := c.ControlSocketPerm(); err != nil {
+		return err
+	}
+
+	if c.WebServer != nil && c.WebServer.Enabled {
+		if c.WebServer.Port < 0 || c.WebServer.Port > 65535 {
+			return fmt.Errorf("web_server.port必须在1-65535范围内，当前为%d", c.WebServer.Port)
+		}
+		if (c.WebServer.Username == "") != (c.WebServer.Password == "") {
+			return fmt.Errorf("web_server的username和password必须同时配置，只配置一项时不会启用认证")
+		}
+	}
+
+	if len(c.Groups) > 0 {
+		if err := c.validateGroups(); err != nil {
+			return err
+		}
+		// 只配置同步组时顶层不需要monitor_paths/sync_path等同步配置
+		if !c.HasDefaultGroup() {
+			return nil
+		}
+	}
+
+	if c.Role == "master" {
+		if len(c.MonitorPaths) == 0 {
+			return fmt.Errorf("Master节点必须配置monitor_paths")
+		}
+		if c.SendWorkers < 0 || c.SendBufferMB < 0 {
+			return fmt.Errorf("send_workers/send_buffer_mb不能为负数")
+		}
+		if c.HATimeout < 0 {
+			return fmt.Errorf("ha_timeout不能为负数: %s", c.HATimeout)
+		}
+		// 心跳间隔为超时的1/3，过短的超时会因网络抖动频繁切换
+		if c.HAPeer != "" && c.HATimeout.Duration() < 3*time.Second {
+			return fmt.Errorf("ha_timeout过短: %s（至少3s，纯数字按秒计算）", c.HATimeout)
+		}
+		if c.HAPeer == "" && c.HAStandby {
+			return fmt.Errorf("ha_standby需要配置ha_peer")
+		}
+		for _, monitorPath := range c.MonitorPaths {
+			if err := monitorPath.Validate(); err != nil {
+				return err
+			}
+			for _, slaveAddr := range monitorPath.Slaves {
+				if c.HAPeer != "" && slaveAddr == c.HAPeer {
+					return fmt.Errorf("监控路径 %s: ha_peer不能同时作为Slave", monitorPath.Path)
+				}
+			}
+		}
+	} else {
+		if c.MasterAddr == "" && len(c.MasterAddrs) == 0 {
+			return fmt.Errorf("Slave节点必须配置master_addr或master_addrs")
+		}
+		for _, addr := range c.MasterAddrs {
+			if addr == "" {
+				return fmt.Errorf("master_addrs中的地址不能为空")
+			}
+		}
+		if c.SyncPath == "" {
+			return fmt.Errorf("Slave节点必须配置sync_path")
+		}
+		if err := replica.ValidatePolicy(c.ConflictPolicy); err != nil {
+			return err
+		}
+		if err := validateDriftPolicy(c.DriftPolicy); err != nil {
+			return err
+		}
+		if c.Bidirectional && c.DriftPolicy != "" {
+			return fmt.Errorf("bidirectional与drift_policy不能同时启用")
+		}
+		if c.Bidirectional && c.Mirror {
+			return fmt.Errorf("bidirectional与mirror不能同时启用")
+		}
+		if c.MirrorMaxDelete < 0 || c.MirrorMaxDelete > 100 {
+			return fmt.Errorf("mirror_max_delete必须在0-100范围内")
+		}
+		if c.VersionsKeep < 0 || c.VersionsDays < 0 {
+			return fmt.Errorf("versions_keep/versions_days不能为负数")
+		}
+		if c.SnapshotInterval < 0 || c.SnapshotKeepLast < 0 || c.SnapshotKeepHourly < 0 || c.SnapshotKeepDaily < 0 {
+			return fmt.Errorf("snapshot_interval/snapshot_keep_last/snapshot_keep_hourly/snapshot_keep_daily不能为负数")
+		}
+		if c.BatchTimeout < 0 || c.BatchSwapKeep < 0 {
+			return fmt.Errorf("batch_timeout/batch_swap_keep不能为负数")
+		}
+		if c.BatchSwap && (c.Bidirectional || c.DriftPolicy != "") {
+			return fmt.Errorf("batch_swap不能与bidirectional或drift_policy同时启用")
+		}
+		if c.RelayReportInterval < 0 {
+			return fmt.Errorf("relay_report_interval不能为负数")
+		}
+		if len(c.RelaySlaves) > 0 && c.Bidirectional {
+			return fmt.Errorf("relay_slaves不能与bidirectional同时启用")
+		}
+		if len(c.RelaySlaves) > 0 && len(c.Targets) > 0 {
+			return fmt.Errorf("relay_slaves不能与targets同时配置")
+		}
+		if err := c.validateTargets(); err != nil {
+			return err
+		}
+		relays := make(map[string]bool, len(c.RelaySlaves))
+		for _, addr := range c.RelaySlaves {
+			if addr == "" || addr == c.MasterAddr || containsString(c.MasterAddrs, addr) {
+				return fmt.Errorf("relay_slaves中的地址无效: %q", addr)
+			}
+			if relays[addr] {
+				return fmt.Errorf("relay_slaves中的地址重复: %s", addr)
+			}
+			relays[addr] = true
+		}
+		names := make(map[string]bool, len(c.Hooks))
+		for i := range c.Hooks {
+			if err := c.Hooks[i].Validate(); err != nil {
+				return err
+			}
+			if names[c.Hooks[i].Name] {
+				return fmt.Errorf("钩子名称重复: %s", c.Hooks[i].Name)
+			}
+			names[c.Hooks[i].Name] = true
+		}
+	}
+
+	return nil
+}
+
+// validateGroups 验证同步组配置
+func (c *Config) validateGroups() error {
+	names := make(map[string]bool, len(c.Groups))
+	syncPaths := make(map[string]string)
+	stateFiles := make(map[string]string)
+	stateDirs := make(map[string]string)
+	webPorts := make(map[int]string)
+
+	// 顶层配置的路径、状态文件和Web端口也不能与同步组冲突
+	add := func(name string, cfg *Config) error {
+		if cfg.IsSlave() && cfg.SyncPath != "" {
+			path := filepath.Clean(cfg.SyncPath)
+			if other, ok := syncPaths[path]; ok {
+				return fmt.Errorf("%s与%s使用了相同的sync_path: %s", name, other, cfg.SyncPath)
+			}
+			syncPaths[path] = name
+		}
+		if cfg.IsMaster() && cfg.HAPeer != "" {
+			path := filepath.Clean(cfg.HAStateFile)
+			if other, ok := stateFiles[path]; ok {
+				return fmt.Errorf("%s与%s使用了相同的ha_state_file: %s", name, other, cfg.HAStateFile)
+			}
+			stateFiles[path] = name
+		}
+		if cfg.IsMaster() {
+			path := filepath.Clean(cfg.StateDir)
+			if other, ok := stateDirs[path]; ok {
+				return fmt.Errorf("%s与%s使用了相同的state_dir: %s", name, other, cfg.StateDir)
+			}
+			stateDirs[path] = name
+		}
+		if cfg.WebServer != nil && cfg.WebServer.Enabled {
+			port := cfg.WebServer.Port
+			if other, ok := webPorts[port]; ok {
+				return fmt.Errorf("%s与%s使用了相同的Web服务端口: %d", name, other, port)
+			}
+			webPorts[port] = name
+		}
+		return nil
+	}
+	if c.HasDefaultGroup() {
+		if err := add("顶层配置", c); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Groups {
+		group := &c.Groups[i]
+		if !validName(group.Name) {
+			return fmt.Errorf("同步组名称无效: %q（只能包含字母、数字、-、_和.，最长64字节）", group.Name)
+		}
+		if names[group.Name] {
+			return fmt.Errorf("同步组名称重复: %s", group.Name)
+		}
+		names[group.Name] = true
+
+		if len(group.Groups) > 0 {
+			return fmt.Errorf("同步组 %s: 不能嵌套配置groups", group.Name)
+		}
+		if len(group.Include) > 0 {
+			return fmt.Errorf("同步组 %s: include只能在顶层配置", group.Name)
+		}
+		if (group.ControlSocket != "" && group.ControlSocket != c.ControlSocket) ||
+			(group.ControlSocketMode != "" && group.ControlSocketMode != c.ControlSocketMode) ||
+			(group.ControlSocketGroup != "" && group.ControlSocketGroup != c.ControlSocketGroup) {
+			return fmt.Errorf("同步组 %s: control_socket*必须与顶层配置相同（同步组共用一个控制接口）", group.Name)
+		}
+		if group.UDPPort != 0 && group.UDPPort != c.UDPPort {
+			return fmt.Errorf("同步组 %s: udp_port必须与顶层配置相同（同步组共用一个端口）", group.Name)
+		}
+
+		cfg := c.GroupConfig(group)
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("同步组 %s: %v", group.Name, err)
+		}
+		if err := add("同步组 "+group.Name, cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validName 检查同步组和目标的名称：用于数据包帧头和状态文件名
+func validName(name string) bool {
+	if name == "" || len(name) > 64 || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTargets 验证Slave的目标目录：名称有效，目录之间以及与sync_path之间不能重叠
+func (c *Config) validateTargets() error {
+	roots := map[string]string{"sync_path": filepath.Clean(c.SyncPath)}
+	for name, root := range c.Targets {
+		if !validName(name) {
+			return fmt.Errorf("targets中的名称无效: %q", name)
+		}
+		if root == "" {
+			return fmt.Errorf("目标 %s 的目录不能为空", name)
+		}
+		roots["目标 "+name] = filepath.Clean(root)
+	}
+
+	// 重叠的目录会被另一方的镜像清理误删文件
+	for a, rootA := range roots {
+		for b, rootB := range roots {
+			if a != b && (rootA == rootB || strings.HasPrefix(rootA, rootB+string(filepath.Separator))) {
+				return fmt.Errorf("%s的目录 %s 与%s的目录 %s 重叠", a, rootA, b, rootB)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate 验证监控路径配置
+func (p *MonitorPath) Validate() error {
+	if p.Path == "" {
+		return fmt.Errorf("monitor_paths中的path不能为空")
+	}
+
+	for _, pattern := range append(append([]string{}, p.Include...), p.Exclude...) {
+		if err := watcher.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("监控路径 %s: %v", p.Path, err)
+		}
+	}
+
+	if p.MinSize < 0 || p.MaxSize < 0 || p.MaxAge < 0 {
+		return fmt.Errorf("监控路径 %s: min_size/max_size/max_age不能为负数", p.Path)
+	}
+	if p.MaxSize > 0 && p.MinSize > p.MaxSize {
+		return fmt.Errorf("监控路径 %s: min_size不能大于max_size", p.Path)
+	}
+
+	switch p.WatchMode {
+	case "", watcher.BackendAuto, watcher.BackendFsnotify, watcher.BackendPoll:
+	default:
+		return fmt.Errorf("监控路径 %s: watch_mode必须是auto、fsnotify或poll", p.Path)
+	}
+	if p.PollInterval < 0 {
+		return fmt.Errorf("监控路径 %s: poll_interval不能为负数", p.Path)
+	}
+	if p.DebounceMs < 0 || p.MaxDelayMs < 0 || p.StableChecks < 0 || p.StableIntervalMs < 0 {
+		return fmt.Errorf("监控路径 %s: debounce_ms/max_delay_ms/stable_checks/stable_interval_ms不能为负数", p.Path)
+	}
+	if p.MaxDelayMs > 0 && p.DebounceMs > p.MaxDelayMs {
+		return fmt.Errorf("监控路径 %s: debounce_ms(%s)不能大于max_delay_ms(%s)", p.Path, p.DebounceMs, p.MaxDelayMs)
+	}
+	if p.Batch && p.BatchMaxMs > 0 && p.BatchQuietMs > p.BatchMaxMs {
+		return fmt.Errorf("监控路径 %s: batch_quiet_ms(%s)不能大于batch_max_ms(%s)", p.Path, p.BatchQuietMs, p.BatchMaxMs)
+	}
+	if err := replica.ValidatePolicy(p.ConflictPolicy); err != nil {
+		return fmt.Errorf("监控路径 %s: %v", p.Path, err)
+	}
+
+	if p.Target != "" {
+		if !validName(p.Target) {
+			return fmt.Errorf("监控路径 %s: target名称无效: %q", p.Path, p.Target)
+		}
+		if p.Bidirectional {
+			return fmt.Errorf("监控路径 %s: target不能与bidirectional同时启用（Slave只监控sync_path的本地修改）", p.Path)
+		}
+	}
+
+	if p.BatchQuietMs < 0 || p.BatchMaxMs < 0 {
+		return fmt.Errorf("监控路径 %s: batch_quiet_ms/batch_max_ms不能为负数", p.Path)
+	}
+	if p.BatchMarker != "" {
+		if _, err := protocol.CleanPath(p.BatchMarker); err != nil {
+			return fmt.Errorf("监控路径 %s: batch_marker: %v", p.Path, err)
+		}
+	}
+
+	names := make(map[string]bool, len(p.PreSend))
+	for i := range p.PreSend {
+		if err := p.PreSend[i].Validate(); err != nil {
+			return fmt.Errorf("监控路径 %s: %v", p.Path, err)
+		}
+		if names[p.PreSend[i].Name] {
+			return fmt.Errorf("监控路径 %s: 发送前钩子名称重复: %s", p.Path, p.PreSend[i].Name)
+		}
+		names[p.PreSend[i].Name] = true
+	}
+
+	return nil
+}
+
+// containsString 判断列表中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDriftPolicy 检查偏差处理策略是否有效（空表示不检测）
+func validateDriftPolicy(policy string) error {
+	switch policy {
+	case "", protocol.DriftRevert, protocol.DriftQuarantine, protocol.DriftAlert:
+		return nil
+	}
+	return fmt.Errorf("无效的drift_policy: %s (可选 %s/%s/%s)", policy, protocol.DriftRevert, protocol.DriftQuarantine, protocol.DriftAlert)
+}
@@ -0,0 +1,66 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Call 连接控制接口执行命令，返回命令结果的JSON数据
+// timeout为等待结果的最长时间（verify等命令需要Slave计算哈希，耗时较长）
+func Call(path string, req *Request, timeout time.Duration) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接控制接口 %s（节点是否在运行？）: %v", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("发送控制命令失败: %v", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("读取控制命令结果失败: %v", err)
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Data, nil
+}
+
+// Stream 连接控制接口订阅事件，每收到一个事件调用fn，直到连接断开或fn返回错误
+func Stream(path, group string, fn func(event *Event) error) error {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("无法连接控制接口 %s（节点是否在运行？）: %v", path, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(&Request{Command: "events", Group: group}); err != nil {
+		return fmt.Errorf("发送控制命令失败: %v", err)
+	}
+	decoder := json.NewDecoder(conn)
+	var resp Response
+	if err := decoder.Decode(&resp); err != nil {
+		return fmt.Errorf("读取控制命令结果失败: %v", err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("节点已关闭控制接口")
+			}
+			return fmt.Errorf("读取事件失败: %v", err)
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+}
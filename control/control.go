@@ -0,0 +1,280 @@
+// Package control 本地控制接口：运行中的节点在Unix套接字上接收xsync status等命令
+// 每个连接发送一个JSON请求，节点处理后返回一个JSON响应；events命令在响应之后持续输出事件，每行一个JSON
+// 访问权限由套接字文件的权限和属组控制，不监听网络端口
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Request 控制命令
+type Request struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Group   string   `json:"group,omitempty"` // 操作的同步组，为空时为顶层配置对应的节点
+}
+
+// Response 控制命令的执行结果
+type Response struct {
+	OK    bool            `json:"ok"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// HandlerFunc 处理控制命令，返回的结果以JSON编码后发给客户端
+type HandlerFunc func(req *Request) (interface{}, error)
+
+// requestTimeout 读取请求的超时时间
+const requestTimeout = 10 * time.Second
+
+// Options 控制接口的选项
+type Options struct {
+	Path   string
+	Mode   os.FileMode // 套接字文件的权限，0表示0600（只允许运行节点的用户访问）
+	Group  string      // 套接字文件的属组，为空时不修改；配合0660允许该组的用户访问
+	Events *Broker     // 实时事件的来源，为nil时不支持events命令
+}
+
+// Server 控制接口服务
+type Server struct {
+	path     string
+	listener net.Listener
+	handler  HandlerFunc
+	events   *Broker
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Listen 在Unix套接字上启动控制接口，所在目录不存在时创建
+// 套接字文件已存在时，能连接说明其他节点正在使用，否则视为上次异常退出遗留的文件并删除
+func Listen(opts Options, handler HandlerFunc) (*Server, error) {
+	path := opts.Path
+	if err := prepareDir(filepath.Dir(path), opts.Group); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("控制接口 %s 已被其他进程使用", path)
+		}
+		if !ownedBySelf(info) {
+			return nil, fmt.Errorf("控制套接字 %s 已存在且不属于当前用户", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("删除遗留的控制套接字失败: %v", err)
+		}
+	}
+
+	listener, err := listenPrivate(path, opts.Mode, opts.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{path: path, listener: listener, handler: handler, events: opts.Events, done: make(chan struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// serve 接受连接，每个连接单独处理
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn 读取一个请求并返回执行结果
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	var req Request
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		writeResponse(conn, &Response{Error: fmt.Sprintf("解析请求失败: %v", err)})
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if req.Command == "events" {
+		s.streamEvents(conn, &req)
+		return
+	}
+
+	log.Printf("执行控制命令: %s %v", req.Command, req.Args)
+	data, err := s.handler(&req)
+	if err != nil {
+		writeResponse(conn, &Response{Error: err.Error()})
+		return
+	}
+	resp := &Response{OK: true}
+	if data != nil {
+		if resp.Data, err = json.Marshal(data); err != nil {
+			resp = &Response{Error: fmt.Sprintf("序列化结果失败: %v", err)}
+		}
+	}
+	writeResponse(conn, resp)
+}
+
+// streamEvents 持续输出事件，直到客户端断开连接或控制接口关闭
+func (s *Server) streamEvents(conn net.Conn, req *Request) {
+	if s.events == nil {
+		writeResponse(conn, &Response{Error: "节点不支持events命令"})
+		return
+	}
+
+	sub := s.events.subscribe(req.Group)
+	defer func() {
+		if dropped := s.events.unsubscribe(sub); dropped > 0 {
+			log.Printf("events客户端读取过慢，丢弃了 %d 个事件", dropped)
+		}
+	}()
+	writeResponse(conn, &Response{OK: true})
+
+	// 客户端不再发送数据，读取返回说明连接已断开
+	closed := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(conn)
+		close(closed)
+	}()
+
+	encoder := json.NewEncoder(conn)
+	for {
+		select {
+		case event := <-sub.events:
+			conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+			if err := encoder.Encode(&event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// writeResponse 发送响应
+func writeResponse(conn net.Conn, resp *Response) {
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("发送控制命令结果失败: %v", err)
+	}
+}
+
+// Path 获取套接字路径
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Close 停止接受新的命令并删除套接字文件，断开events连接，正在执行的命令不受影响
+func (s *Server) Close() error {
+	close(s.done)
+	err := s.listener.Close()
+	os.Remove(s.path)
+	s.wg.Wait()
+	return err
+}
+
+// prepareDir 检查套接字所在目录，不存在时创建为只有当前用户可访问（设置属组时该组可进入）
+// 已存在的目录必须属于当前用户或root，且除带粘滞位的公共目录（如/tmp）外其他用户不可写
+func prepareDir(dir, group string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return fmt.Errorf("创建控制套接字目录失败: %v", err)
+		}
+		perm := os.FileMode(0700)
+		if group != "" {
+			perm = 0750
+		}
+		if err := os.Mkdir(dir, perm); err != nil {
+			return fmt.Errorf("创建控制套接字目录失败: %v", err)
+		}
+		// Mkdir的权限受umask影响
+		return setPermissions(dir, perm, group)
+	}
+	if err != nil {
+		return fmt.Errorf("检查控制套接字目录失败: %v", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("控制套接字目录 %s 不是目录", dir)
+	}
+	if !ownedBySelfOrRoot(info) {
+		return fmt.Errorf("控制套接字目录 %s 不属于当前用户或root", dir)
+	}
+	if info.Mode()&0022 != 0 && info.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("控制套接字目录 %s 允许其他用户写入（%v）", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// listenPrivate 在只有当前用户可访问的临时目录中创建套接字并设置权限后再移动到path
+// 其他用户无法在权限设置完成前连接；移动到已被其他用户占用的路径会失败
+func listenPrivate(path string, mode os.FileMode, group string) (net.Listener, error) {
+	tmpDir, err := ioutil.TempDir(filepath.Dir(path), ".xsync-ctl-")
+	if err != nil {
+		return nil, fmt.Errorf("创建控制套接字临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, "ctl.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("监听控制套接字失败: %v", err)
+	}
+	// 套接字移动后由Close删除
+	listener.SetUnlinkOnClose(false)
+
+	if err := setPermissions(tmpPath, mode, group); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("移动控制套接字失败: %v", err)
+	}
+	return listener, nil
+}
+
+// setPermissions 设置套接字文件或目录的权限和属组
+func setPermissions(path string, mode os.FileMode, group string) error {
+	if mode == 0 {
+		mode = 0600
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return fmt.Errorf("查找控制套接字的属组失败: %v", err)
+		}
+		gid, err := strconv.Atoi(g.Gid)
+		if err != nil {
+			return fmt.Errorf("无效的组ID %s: %v", g.Gid, err)
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			return fmt.Errorf("设置控制套接字的属组失败: %v", err)
+		}
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("设置控制套接字权限失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package control
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	EventChange      = "change"       // Master: 监控路径中的文件变更
+	EventSent        = "sent"         // Master: 变更已发送到所有Slave
+	EventSendFailed  = "send_failed"  // Master: 变更发送到部分Slave失败
+	EventFullSync    = "full_sync"    // Master: 全量同步开始或结束；Slave: 请求全量同步
+	EventDrift       = "drift"        // Slave检测到本地变更
+	EventHookFailed  = "hook_failed"  // Slave同步后钩子执行失败
+	EventPause       = "pause"        // Master: 暂停发送
+	EventResume      = "resume"       // Master: 恢复发送
+	EventHA          = "ha"           // Master: 主备切换
+	EventApply       = "apply"        // Slave: 已应用Master的变更
+	EventApplyFailed = "apply_failed" // Slave: 应用变更失败
+	EventBatch       = "batch"        // Slave: 批次已提交或丢弃
+	EventReload      = "reload"       // 配置已重新加载或加载失败
+)
+
+// eventBuffer 每个订阅者缓冲的事件数，读取过慢时丢弃新事件
+const eventBuffer = 1024
+
+// Event 节点运行中发生的事件，通过events命令实时输出
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Group   string    `json:"group,omitempty"`
+	Op      string    `json:"op,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Slave   string    `json:"slave,omitempty"` // 相关的Slave或Master地址
+	Message string    `json:"message,omitempty"`
+}
+
+// String 获取事件的单行文本
+func (e *Event) String() string {
+	text := e.Time.Format("2006-01-02 15:04:05.000") + " "
+	if e.Group != "" {
+		text += "[" + e.Group + "] "
+	}
+	text += e.Type
+	for _, field := range []string{e.Op, e.Path, e.Slave} {
+		if field != "" {
+			text += " " + field
+		}
+	}
+	if e.Message != "" {
+		text += ": " + e.Message
+	}
+	return text
+}
+
+// Broker 将节点发布的事件分发给所有订阅者
+type Broker struct {
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+// subscriber 一个events命令的连接
+type subscriber struct {
+	group   string // 只接收该同步组的事件，为空时接收所有事件
+	events  chan Event
+	dropped int64
+}
+
+// NewBroker 创建事件分发器
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[*subscriber]bool)}
+}
+
+// Publisher 获取同步组（顶层节点为空）发布事件使用的句柄
+func (b *Broker) Publisher(group string) *Publisher {
+	return &Publisher{broker: b, group: group}
+}
+
+// publish 分发事件，订阅者的缓冲已满时丢弃，不阻塞节点
+func (b *Broker) publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for sub := range b.subscribers {
+		if sub.group != "" && sub.group != event.Group {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// subscribe 订阅事件，group不为空时只接收该同步组的事件
+func (b *Broker) subscribe(group string) *subscriber {
+	sub := &subscriber{group: group, events: make(chan Event, eventBuffer)}
+	b.mutex.Lock()
+	b.subscribers[sub] = true
+	b.mutex.Unlock()
+	return sub
+}
+
+// unsubscribe 取消订阅，返回因读取过慢丢弃的事件数
+func (b *Broker) unsubscribe(sub *subscriber) int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.subscribers, sub)
+	return sub.dropped
+}
+
+// Publisher 节点发布事件的句柄，为nil时不发布
+type Publisher struct {
+	broker *Broker
+	group  string
+}
+
+// Publish 发布事件，填写时间和同步组
+func (p *Publisher) Publish(event Event) {
+	if p == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Group = p.group
+	p.broker.publish(event)
+}
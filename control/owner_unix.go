@@ -0,0 +1,20 @@
+//go:build !windows
+
+package control
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedBySelf 判断文件是否属于当前用户
+func ownedBySelf(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Geteuid()
+}
+
+// ownedBySelfOrRoot 判断文件是否属于当前用户或root
+func ownedBySelfOrRoot(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return !ok || int(st.Uid) == os.Geteuid() || st.Uid == 0
+}
@@ -0,0 +1,67 @@
+package control
+
+import (
+	"time"
+
+	"xsync/protocol"
+)
+
+// Status status命令的结果
+type Status struct {
+	NodeID string                 `json:"node_id"`
+	Role   string                 `json:"role"`
+	Paused []string               `json:"paused,omitempty"` // Master: 暂停发送的监控路径
+	Slaves []SlaveStatus          `json:"slaves,omitempty"` // Master: 各Slave的发送状态
+	Stats  map[string]interface{} `json:"stats"`            // 节点的统计信息
+}
+
+// SlaveStatus Master向一个Slave发送的状态
+type SlaveStatus struct {
+	Addr         string    `json:"addr"`
+	NodeID       string    `json:"node_id,omitempty"` // 从心跳中获知的节点ID
+	Paths        []string  `json:"paths"`             // 包含该Slave的监控路径
+	LastSeen     time.Time `json:"last_seen"`         // 最近收到心跳或请求的时间，零值表示尚未收到
+	Queued       int       `json:"queued"`            // 等待发送的文件变更
+	SyncQueued   int       `json:"sync_queued"`       // 等待发送的全量同步文件
+	Active       int       `json:"active"`            // 正在发送的数据包
+	LagSec       float64   `json:"lag_sec"`           // 最早一个等待发送的文件变更已等待的时间（秒）
+	Sent         int64     `json:"sent"`
+	Failed       int64     `json:"failed"`
+	FullSync     string    `json:"full_sync,omitempty"` // 最近一次全量同步的状态
+	Drifts       int64     `json:"drifts,omitempty"`
+	HookFailures int64     `json:"hook_failures,omitempty"`
+}
+
+// VerifyResult verify命令的结果：按目标比较Master和Slave上文件的哈希
+type VerifyResult struct {
+	Slave   string       `json:"slave"`
+	Targets []TargetDiff `json:"targets"`
+}
+
+// TargetDiff 一个目标中Master和Slave的差异
+type TargetDiff struct {
+	Target  string   `json:"target"`            // 为空表示Slave的sync_path
+	Files   int      `json:"files"`             // Master上需要同步的文件数
+	Missing []string `json:"missing,omitempty"` // Slave上缺少的文件
+	Differ  []string `json:"differ,omitempty"`  // 内容不同的文件
+	Extra   []string `json:"extra,omitempty"`   // 只在Slave上存在的文件（被过滤规则排除或在Slave本地创建）
+	Error   string   `json:"error,omitempty"`
+}
+
+// InSync 判断Slave上的文件是否与Master一致（不考虑只在Slave上存在的文件）
+func (r *VerifyResult) InSync() bool {
+	for _, diff := range r.Targets {
+		if diff.Error != "" || len(diff.Missing) > 0 || len(diff.Differ) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ListResult ls命令的结果
+type ListResult struct {
+	Slave   string               `json:"slave"`
+	Target  string               `json:"target,omitempty"`
+	Dir     string               `json:"dir"`
+	Entries []protocol.ListEntry `json:"entries"`
+}
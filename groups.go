@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"xsync/config"
+	"xsync/control"
+	"xsync/transport"
+)
+
+// groupNode 运行多个同步组的节点
+// 顶层配置和各同步组分别是独立的Master或Slave，共用一个QUIC端点，数据包按组名分发
+type groupNode struct {
+	transport *transport.QUICTransport
+	main      Node            // 顶层配置对应的节点，只配置了同步组时为nil
+	groups    map[string]Node // 同步组名 -> 节点
+	names     []string        // 按配置顺序排列的同步组名
+}
+
+// startGroups 启动顶层配置和所有同步组
+func startGroups(cfg *config.Config, events *control.Broker) (Node, error) {
+	qt := transport.NewQUICTransport([]byte(cfg.Key))
+	gn := &groupNode{
+		transport: qt,
+		groups:    make(map[string]Node),
+	}
+
+	if cfg.HasDefaultGroup() {
+		node, err := startNode(cfg, qt, events.Publisher(""))
+		if err != nil {
+			qt.Close()
+			return nil, err
+		}
+		gn.main = node
+	}
+
+	for i := range cfg.Groups {
+		group := &cfg.Groups[i]
+		groupCfg := cfg.GroupConfig(group)
+		log.Printf("启动同步组 %s: %s %s", group.Name, groupCfg.Role, groupCfg.NodeID)
+
+		node, err := startNode(groupCfg, qt.Group(group.Name, []byte(groupCfg.Key)), events.Publisher(group.Name))
+		if err != nil {
+			gn.Stop()
+			return nil, fmt.Errorf("同步组 %s: %v", group.Name, err)
+		}
+		gn.groups[group.Name] = node
+		gn.names = append(gn.names, group.Name)
+	}
+
+	return gn, nil
+}
+
+// Stop 停止所有同步组和顶层节点，最后关闭共用的传输层
+func (gn *groupNode) Stop() error {
+	var firstErr error
+	for _, name := range gn.names {
+		if err := gn.groups[name].Stop(); err != nil {
+			log.Printf("停止同步组 %s 失败: %v", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	// 顶层节点停止时会关闭共用的传输层
+	if gn.main != nil {
+		if err := gn.main.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	} else if err := gn.transport.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// GetStats 获取统计信息，同步组的统计信息位于groups下
+func (gn *groupNode) GetStats() map[string]interface{} {
+	return gn.collect(Node.GetStats)
+}
+
+// GetDetailedStats 获取详细统计信息
+func (gn *groupNode) GetDetailedStats() map[string]interface{} {
+	return gn.collect(Node.GetDetailedStats)
+}
+
+// collect 汇总顶层节点和各同步组的统计信息
+func (gn *groupNode) collect(get func(Node) map[string]interface{}) map[string]interface{} {
+	stats := make(map[string]interface{})
+	if gn.main != nil {
+		for key, value := range get(gn.main) {
+			stats[key] = value
+		}
+	}
+
+	groups := make(map[string]interface{}, len(gn.groups))
+	for name, node := range gn.groups {
+		groups[name] = get(node)
+	}
+	stats["groups"] = groups
+	return stats
+}
+
+// find 获取同步组的节点，name为空时获取顶层配置对应的节点
+func (gn *groupNode) find(name string) (Node, error) {
+	if name == "" {
+		if gn.main == nil {
+			return nil, fmt.Errorf("配置中只有同步组，请使用 -g 指定同步组")
+		}
+		return gn.main, nil
+	}
+	node, exists := gn.groups[name]
+	if !exists {
+		return nil, fmt.Errorf("未找到同步组: %s", name)
+	}
+	return node, nil
+}
+
+// Reload 热加载配置：顶层节点和各同步组分别加载自己的配置，增删同步组需要重启
+func (gn *groupNode) Reload(cfg *config.Config) error {
+	if cfg.HasDefaultGroup() != (gn.main != nil) || len(cfg.Groups) != len(gn.names) {
+		return fmt.Errorf("增加或删除同步组需要重启")
+	}
+	for _, name := range gn.names {
+		if cfg.FindGroup(name) == nil {
+			return fmt.Errorf("增加或删除同步组需要重启")
+		}
+	}
+
+	if gn.main != nil {
+		main := *cfg
+		main.Groups = nil
+		if err := reloadConfig(gn.main, &main); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range gn.names {
+		if err := reloadConfig(gn.groups[name], cfg.GroupConfig(cfg.FindGroup(name))); err != nil {
+			return fmt.Errorf("同步组 %s: %v", name, err)
+		}
+	}
+	return nil
+}
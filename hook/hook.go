@@ -0,0 +1,323 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/watcher"
+)
+
+// 默认值
+const (
+	DefaultSettleMs = 2000 // 最后一次变更后等待的时间
+	DefaultTimeout  = 60   // 执行超时（秒）
+
+	maxOutput = 4096 // 保留的命令输出或响应的最大长度
+)
+
+// Config 同步后钩子配置
+type Config struct {
+	Name     string   `yaml:"name"`
+	Paths    []string `yaml:"paths"`     // 触发路径（gitignore语法），为空时任意变更都触发
+	Command  string   `yaml:"command"`   // 通过 sh -c 执行的命令，工作目录为sync_path
+	URL      string   `yaml:"url"`       // 以POST方式回调的HTTP地址，请求体为JSON
+	SettleMs int      `yaml:"settle_ms"` // 最后一次变更后等待N毫秒再执行，合并一批变更，默认2000
+	Timeout  int      `yaml:"timeout"`   // 执行超时（秒），默认60
+}
+
+// Validate 检查钩子配置
+func (c *Config) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("hooks中的name不能为空")
+	}
+	if c.Command == "" && c.URL == "" {
+		return fmt.Errorf("钩子 %s: command和url至少配置一个", c.Name)
+	}
+	if c.SettleMs < 0 || c.Timeout < 0 {
+		return fmt.Errorf("钩子 %s: settle_ms/timeout不能为负数", c.Name)
+	}
+	for _, pattern := range c.Paths {
+		if err := watcher.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("钩子 %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Change 触发钩子的一个变更
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+}
+
+// Result 一次钩子执行的结果
+type Result struct {
+	Hook     string
+	Changes  []Change
+	Err      error
+	Output   string
+	Duration time.Duration
+}
+
+// Runner 按路径匹配收集变更，在一批变更稳定后执行钩子
+type Runner struct {
+	syncPath string
+	nodeID   string
+	hooks    []*hookState
+	onResult func(*Result)
+	mutex    sync.Mutex
+	stopped  bool
+}
+
+// hookState 单个钩子的待执行变更
+type hookState struct {
+	config  Config
+	matcher *watcher.Matcher
+	pending map[string]string // 路径 -> 操作
+	timer   *time.Timer
+	running bool
+}
+
+// NewRunner 创建钩子执行器，每次执行后调用onResult
+func NewRunner(syncPath, nodeID string, hooks []Config, onResult func(*Result)) (*Runner, error) {
+	r := &Runner{syncPath: syncPath, nodeID: nodeID, onResult: onResult}
+	for _, cfg := range hooks {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		if cfg.SettleMs == 0 {
+			cfg.SettleMs = DefaultSettleMs
+		}
+		if cfg.Timeout == 0 {
+			cfg.Timeout = DefaultTimeout
+		}
+
+		matcher, err := watcher.NewMatcher(cfg.Paths)
+		if err != nil {
+			return nil, fmt.Errorf("钩子 %s: %v", cfg.Name, err)
+		}
+		r.hooks = append(r.hooks, &hookState{
+			config:  cfg,
+			matcher: matcher,
+			pending: make(map[string]string),
+		})
+	}
+	return r, nil
+}
+
+// Notify 记录一个已应用的变更，匹配的钩子在settle_ms内没有新变更后执行
+func (r *Runner) Notify(op, relPath string, isDir bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stopped {
+		return
+	}
+
+	for _, h := range r.hooks {
+		if len(h.config.Paths) > 0 && !h.matcher.Match(relPath, isDir) {
+			continue
+		}
+		h.pending[relPath] = op
+		r.schedule(h)
+	}
+}
+
+// Stop 停止执行器，尚未执行的变更被丢弃，正在执行的钩子继续完成
+func (r *Runner) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stopped = true
+	for _, h := range r.hooks {
+		if h.timer != nil {
+			h.timer.Stop()
+		}
+		if len(h.pending) > 0 {
+			log.Printf("钩子 %s 有 %d 个变更未执行", h.config.Name, len(h.pending))
+		}
+	}
+}
+
+// schedule 重置钩子的等待计时器（调用时需持有锁）
+func (r *Runner) schedule(h *hookState) {
+	delay := time.Duration(h.config.SettleMs) * time.Millisecond
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	h.timer = time.AfterFunc(delay, func() { r.fire(h) })
+}
+
+// fire 执行钩子；上一次执行尚未结束时等结束后再执行
+func (r *Runner) fire(h *hookState) {
+	r.mutex.Lock()
+	if r.stopped || h.running || len(h.pending) == 0 {
+		r.mutex.Unlock()
+		return
+	}
+	changes := make([]Change, 0, len(h.pending))
+	for path, op := range h.pending {
+		changes = append(changes, Change{Op: op, Path: path})
+	}
+	h.pending = make(map[string]string)
+	h.running = true
+	r.mutex.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	result := r.run(h.config, changes)
+
+	r.mutex.Lock()
+	h.running = false
+	if !r.stopped && len(h.pending) > 0 {
+		r.schedule(h)
+	}
+	r.mutex.Unlock()
+
+	if r.onResult != nil {
+		r.onResult(result)
+	}
+}
+
+// run 执行钩子的命令和HTTP回调
+func (r *Runner) run(cfg Config, changes []Change) *Result {
+	start := time.Now()
+	result := &Result{Hook: cfg.Name, Changes: changes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+
+	var outputs []string
+	if cfg.Command != "" {
+		output, err := r.runCommand(ctx, cfg, changes)
+		outputs = append(outputs, output)
+		if err != nil {
+			result.Err = err
+		}
+	}
+	if cfg.URL != "" && result.Err == nil {
+		output, err := r.callURL(ctx, cfg, changes)
+		outputs = append(outputs, output)
+		if err != nil {
+			result.Err = err
+		}
+	}
+
+	result.Output = truncate(strings.TrimSpace(strings.Join(outputs, "\n")))
+	result.Duration = time.Since(start)
+	return result
+}
+
+// runCommand 执行钩子命令，变更信息通过环境变量传递
+func (r *Runner) runCommand(ctx context.Context, cfg Config, changes []Change) (string, error) {
+	// 变更列表较长时环境变量可能超出限制，同时写入文件供脚本读取
+	listFile, err := ioutil.TempFile("", "xsync-hook-")
+	if err != nil {
+		return "", fmt.Errorf("创建变更列表文件失败: %v", err)
+	}
+	defer os.Remove(listFile.Name())
+
+	var paths, deleted []string
+	for _, change := range changes {
+		fmt.Fprintf(listFile, "%s %s\n", change.Op, change.Path)
+		paths = append(paths, change.Path)
+		if change.Op == "DELETE" {
+			deleted = append(deleted, change.Path)
+		}
+	}
+	listFile.Close()
+
+	env := []string{
+		"XSYNC_HOOK=" + cfg.Name,
+		"XSYNC_NODE_ID=" + r.nodeID,
+		"XSYNC_SYNC_PATH=" + r.syncPath,
+		"XSYNC_CHANGED_COUNT=" + strconv.Itoa(len(changes)),
+		"XSYNC_CHANGED_PATHS=" + strings.Join(paths, "\n"),
+		"XSYNC_DELETED_PATHS=" + strings.Join(deleted, "\n"),
+		"XSYNC_CHANGED_FILE=" + listFile.Name(),
+	}
+	return runShell(ctx, cfg.Command, r.syncPath, env, cfg.Timeout)
+}
+
+// runShell 通过 sh -c 执行命令并返回合并的输出，超时时结束整个进程组
+func runShell(ctx context.Context, command, dir string, env []string, timeout int) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("启动命令失败: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return output.String(), fmt.Errorf("命令执行失败: %v", err)
+		}
+		return output.String(), nil
+	case <-ctx.Done():
+		// 结束整个进程组，避免子进程继续占用输出管道
+		killProcessGroup(cmd)
+		<-done
+		return output.String(), fmt.Errorf("命令执行超时(%ds)", timeout)
+	}
+}
+
+// callURL 以POST方式回调HTTP地址
+func (r *Runner) callURL(ctx context.Context, cfg Config, changes []Change) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"hook":      cfg.Name,
+		"node_id":   r.nodeID,
+		"sync_path": r.syncPath,
+		"changes":   changes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("HTTP回调失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxOutput))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return string(data), fmt.Errorf("HTTP回调返回 %s", resp.Status)
+	}
+	return string(data), nil
+}
+
+// truncate 截断过长的输出
+func truncate(output string) string {
+	if len(output) <= maxOutput {
+		return output
+	}
+	return output[len(output)-maxOutput:]
+}
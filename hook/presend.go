@@ -0,0 +1,215 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/watcher"
+)
+
+// PreSendConfig Master发送前钩子配置
+type PreSendConfig struct {
+	Name    string   `yaml:"name"`
+	Paths   []string `yaml:"paths"`   // 检查的路径（gitignore语法），为空时检查所有文件
+	Command string   `yaml:"command"` // 通过 sh -c 执行，退出码0放行、非0拒绝；修改$XSYNC_FILE即改写发送的内容
+	Timeout int      `yaml:"timeout"` // 执行超时（秒），默认60，超时视为拒绝
+}
+
+// Validate 检查发送前钩子配置
+func (c *PreSendConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("pre_send中的name不能为空")
+	}
+	if c.Command == "" {
+		return fmt.Errorf("发送前钩子 %s: command不能为空", c.Name)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("发送前钩子 %s: timeout不能为负数", c.Name)
+	}
+	for _, pattern := range c.Paths {
+		if err := watcher.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("发送前钩子 %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Verdict 发送前检查的结果
+type Verdict struct {
+	Rejected    bool   // 被钩子拒绝，不应发送
+	Hook        string // 拒绝变更的钩子
+	Reason      string // 拒绝原因（错误和命令输出）
+	Content     []byte // 放行时要发送的内容（可能已被改写）
+	Transformed bool   // 内容是否被钩子改写
+	Cached      bool   // 相同内容已检查过，结果来自缓存
+}
+
+// PreSend 按顺序执行发送前钩子，决定变更是否发送以及发送的内容
+type PreSend struct {
+	root  string
+	hooks []preSendHook
+	cache map[string]cachedVerdict // 路径 -> 最近一次检查的结果（不含内容），DELETE时删除
+	mutex sync.Mutex
+}
+
+// preSendHook 单个发送前钩子
+type preSendHook struct {
+	config  PreSendConfig
+	matcher *watcher.Matcher
+}
+
+// cachedVerdict 按内容哈希缓存的检查结果，避免全量同步时重复执行钩子
+// 只保存哈希和结果，不保存内容：放行和拒绝直接使用缓存，改写过的内容需重新执行钩子
+type cachedVerdict struct {
+	hash        [sha256.Size]byte
+	rejected    bool
+	hook        string
+	reason      string
+	transformed bool
+}
+
+// NewPreSend 创建发送前检查器，root为监控路径
+func NewPreSend(root string, hooks []PreSendConfig) (*PreSend, error) {
+	p := &PreSend{root: root, cache: make(map[string]cachedVerdict)}
+	for _, cfg := range hooks {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		if cfg.Timeout == 0 {
+			cfg.Timeout = DefaultTimeout
+		}
+
+		matcher, err := watcher.NewMatcher(cfg.Paths)
+		if err != nil {
+			return nil, fmt.Errorf("发送前钩子 %s: %v", cfg.Name, err)
+		}
+		p.hooks = append(p.hooks, preSendHook{config: cfg, matcher: matcher})
+	}
+	return p, nil
+}
+
+// Check 依次执行匹配的钩子检查文件变更，前一个钩子改写的内容交给下一个钩子
+// 只检查CREATE和MODIFY，其他操作直接放行，DELETE时清除该路径（及其下文件）的缓存
+func (p *PreSend) Check(op, relPath string, content []byte) *Verdict {
+	verdict := &Verdict{Content: content}
+	if op == "DELETE" {
+		p.forget(relPath)
+	}
+	if op != "CREATE" && op != "MODIFY" {
+		return verdict
+	}
+
+	var matched []PreSendConfig
+	for _, h := range p.hooks {
+		if len(h.config.Paths) > 0 && !h.matcher.Match(relPath, false) {
+			continue
+		}
+		matched = append(matched, h.config)
+	}
+	if len(matched) == 0 {
+		return verdict
+	}
+
+	hash := sha256.Sum256(content)
+	p.mutex.Lock()
+	cached, exists := p.cache[relPath]
+	p.mutex.Unlock()
+	if exists && cached.hash == hash && !cached.transformed {
+		verdict.Cached = true
+		if cached.rejected {
+			verdict.Rejected, verdict.Hook, verdict.Reason = true, cached.hook, cached.reason
+			verdict.Content = nil
+		}
+		return verdict
+	}
+
+	for _, cfg := range matched {
+		transformed, err := p.run(cfg, op, relPath, verdict.Content)
+		if err != nil {
+			verdict.Rejected = true
+			verdict.Hook = cfg.Name
+			verdict.Reason = err.Error()
+			verdict.Content = nil
+			verdict.Transformed = false
+			break
+		}
+		if !bytes.Equal(transformed, verdict.Content) {
+			verdict.Content = transformed
+			verdict.Transformed = true
+		}
+	}
+
+	// 改写结果与上次相同时不重复记录日志
+	verdict.Cached = exists && cached.hash == hash && verdict.Transformed
+
+	p.mutex.Lock()
+	p.cache[relPath] = cachedVerdict{
+		hash:        hash,
+		rejected:    verdict.Rejected,
+		hook:        verdict.Hook,
+		reason:      verdict.Reason,
+		transformed: verdict.Transformed,
+	}
+	p.mutex.Unlock()
+	return verdict
+}
+
+// forget 清除路径及其下所有文件的缓存（文件删除或目录删除、重命名时）
+func (p *PreSend) forget(relPath string) {
+	prefix := relPath + "/"
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.cache, relPath)
+	for path := range p.cache {
+		if strings.HasPrefix(path, prefix) {
+			delete(p.cache, path)
+		}
+	}
+}
+
+// run 将内容写入临时文件后执行钩子命令，返回命令执行后的文件内容
+func (p *PreSend) run(cfg PreSendConfig, op, relPath string, content []byte) ([]byte, error) {
+	// 临时文件保留原文件名，便于按扩展名选择校验工具
+	dir, err := ioutil.TempDir("", "xsync-presend-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpFile := filepath.Join(dir, filepath.Base(filepath.FromSlash(relPath)))
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return nil, fmt.Errorf("写入临时文件失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+
+	env := []string{
+		"XSYNC_HOOK=" + cfg.Name,
+		"XSYNC_OP=" + op,
+		"XSYNC_PATH=" + relPath,
+		"XSYNC_FILE=" + tmpFile,
+		"XSYNC_ROOT=" + p.root,
+	}
+	output, err := runShell(ctx, cfg.Command, p.root, env, cfg.Timeout)
+	if err != nil {
+		if output = truncate(strings.TrimSpace(output)); output != "" {
+			return nil, fmt.Errorf("%v: %s", err, output)
+		}
+		return nil, err
+	}
+
+	transformed, err := ioutil.ReadFile(tmpFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取钩子处理后的文件失败: %v", err)
+	}
+	return transformed, nil
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package hook
+
+import "os/exec"
+
+// setProcessGroup Windows平台不设置进程组
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup Windows平台只结束命令进程本身
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
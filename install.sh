@@ -68,6 +68,7 @@ After=network.target
 Type=simple
 User=root
 ExecStart=$INSTALL_DIR/$APP_NAME -c $CONFIG_DIR/master.yaml
+ExecReload=$INSTALL_DIR/$APP_NAME -c $CONFIG_DIR/master.yaml reload
 Restart=on-failure
 RestartSec=5s
 LimitNOFILE=65536
@@ -90,6 +91,7 @@ After=network.target
 Type=simple
 User=root
 ExecStart=$INSTALL_DIR/$APP_NAME -c $CONFIG_DIR/slave1.yaml
+ExecReload=$INSTALL_DIR/$APP_NAME -c $CONFIG_DIR/slave1.yaml reload
 Restart=on-failure
 RestartSec=5s
 LimitNOFILE=65536
@@ -112,6 +114,7 @@ After=network.target
 Type=simple
 User=root
 ExecStart=$INSTALL_DIR/$APP_NAME -c $CONFIG_DIR/slave2.yaml
+ExecReload=$INSTALL_DIR/$APP_NAME -c $CONFIG_DIR/slave2.yaml reload
 Restart=on-failure
 RestartSec=5s
 LimitNOFILE=65536
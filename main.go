@@ -6,14 +6,18 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"xsync/config"
+	"xsync/control"
 	"xsync/master"
 	"xsync/slave"
+	"xsync/transport"
 )
 
 var (
@@ -23,6 +27,7 @@ var (
 	daemon     = flag.Bool("d", false, "以daemon模式运行")
 	pidFile    = flag.String("p", "", "PID文件路径")
 	logFile    = flag.String("l", "", "日志文件路径")
+	groupName  = flag.String("g", "", "子命令操作的同步组")
 )
 
 const (
@@ -30,57 +35,17 @@ const (
 	APP_NAME = "xsync"
 )
 
-// 类型转换函数
-func convertMonitorPaths(paths []MonitorPath) []master.MonitorPath {
-	result := make([]master.MonitorPath, len(paths))
-	for i, path := range paths {
-		result[i] = master.MonitorPath{
-			Path:   path.Path,
-			Slaves: path.Slaves,
-		}
-	}
-	return result
-}
-
-func convertWebConfig(cfg *WebConfig) *master.WebConfig {
-	if cfg == nil {
-		return nil
-	}
-	return &master.WebConfig{
-		Enabled:   cfg.Enabled,
-		Port:      cfg.Port,
-		Username:  cfg.Username,
-		Password:  cfg.Password,
-		UploadDir: cfg.UploadDir,
-	}
-}
+func main() {
+	flag.Parse()
 
-func convertSlaveMonitorPaths(paths []MonitorPath) []slave.MonitorPath {
-	result := make([]slave.MonitorPath, len(paths))
-	for i, path := range paths {
-		result[i] = slave.MonitorPath{
-			Path:   path.Path,
-			Slaves: path.Slaves,
+	// 子命令
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
 		}
+		return
 	}
-	return result
-}
-
-func convertSlaveWebConfig(cfg *WebConfig) *slave.WebConfig {
-	if cfg == nil {
-		return nil
-	}
-	return &slave.WebConfig{
-		Enabled:   cfg.Enabled,
-		Port:      cfg.Port,
-		Username:  cfg.Username,
-		Password:  cfg.Password,
-		UploadDir: cfg.UploadDir,
-	}
-}
-
-func main() {
-	flag.Parse()
 
 	if *version {
 		fmt.Printf("%s version %s\n", APP_NAME, VERSION)
@@ -112,52 +77,131 @@ func main() {
 	}
 
 	// 加载配置
-	cfg, err := LoadConfig(*configPath)
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("加载配置失败: %v", err)
 	}
 
 	log.Printf("启动 %s 节点: %s", cfg.Role, cfg.NodeID)
 
-	// 根据角色启动相应的节点
+	// 根据角色启动相应的节点，配置了同步组时所有同步组共用一个传输端点
+	events := control.NewBroker()
 	var node Node
-	if cfg.IsMaster() {
-		node, err = startMaster(cfg)
+	if len(cfg.Groups) > 0 {
+		node, err = startGroups(cfg, events)
 	} else {
-		node, err = startSlave(cfg)
+		node, err = startNode(cfg, transport.NewQUICTransport([]byte(cfg.Key)), events.Publisher(""))
 	}
 
 	if err != nil {
 		log.Fatalf("启动节点失败: %v", err)
 	}
 
+	// 启动本地控制接口，供xsync status等命令使用
+	ctl, err := startControl(cfg, node, events)
+	if err != nil {
+		log.Printf("启动控制接口失败，status等命令不可用: %v", err)
+	} else {
+		log.Printf("控制接口已启动: %s", ctl.Path())
+	}
+
 	// 等待中断信号
-	waitForShutdown(node)
+	waitForShutdown(node, ctl, events.Publisher(""))
+}
+
+// startControl 启动本地控制接口，stats和reload作用于整个进程，其他命令交给节点处理
+func startControl(cfg *config.Config, node Node, events *control.Broker) (*control.Server, error) {
+	mode, err := cfg.ControlSocketPerm()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := control.Options{
+		Path:   cfg.ControlSocket,
+		Mode:   mode,
+		Group:  cfg.ControlSocketGroup,
+		Events: events,
+	}
+	publisher := events.Publisher("")
+	return control.Listen(opts, func(req *control.Request) (interface{}, error) {
+		switch req.Command {
+		case "stats":
+			return nodeStats(node, req.Group)
+		case "reload":
+			if req.Group != "" || len(req.Args) > 0 {
+				return nil, fmt.Errorf("reload 重新加载整个配置文件，不接受参数和同步组")
+			}
+			if err := reload(node, publisher); err != nil {
+				return nil, err
+			}
+			return fmt.Sprintf("已重新加载配置: %s", *configPath), nil
+		}
+		return handleControl(node, req)
+	})
 }
 
 // Node 节点接口
 type Node interface {
 	Stop() error
 	GetStats() map[string]interface{}
+	GetDetailedStats() map[string]interface{}
+}
+
+// Controller 支持本地控制接口命令的节点
+type Controller interface {
+	HandleControl(command string, args []string) (interface{}, error)
+}
+
+// handleControl 将控制命令交给请求的同步组或顶层节点处理
+func handleControl(node Node, req *control.Request) (interface{}, error) {
+	if gn, ok := node.(*groupNode); ok {
+		found, err := gn.find(req.Group)
+		if err != nil {
+			return nil, err
+		}
+		node = found
+	} else if req.Group != "" {
+		return nil, fmt.Errorf("节点未配置同步组: %s", req.Group)
+	}
+
+	c, ok := node.(Controller)
+	if !ok {
+		return nil, fmt.Errorf("节点不支持控制命令")
+	}
+	return c.HandleControl(req.Command, req.Args)
+}
+
+// nodeStats 获取整个节点或指定同步组的详细状态
+func nodeStats(node Node, group string) (interface{}, error) {
+	if group == "" {
+		return node.GetDetailedStats(), nil
+	}
+	gn, ok := node.(*groupNode)
+	if !ok {
+		return nil, fmt.Errorf("节点未配置同步组: %s", group)
+	}
+	found, err := gn.find(group)
+	if err != nil {
+		return nil, err
+	}
+	return found.GetDetailedStats(), nil
+}
+
+// startNode 根据角色使用指定的传输层启动节点，节点的事件通过events发布到控制接口
+func startNode(cfg *config.Config, t transport.Transport, events *control.Publisher) (Node, error) {
+	if cfg.IsMaster() {
+		return startMaster(cfg, t, events)
+	}
+	return startSlave(cfg, t, events)
 }
 
 // startMaster 启动Master节点
-func startMaster(cfg *Config) (Node, error) {
-	// 转换Config类型
-	masterCfg := &master.Config{
-		NodeID:       cfg.NodeID,
-		Role:         cfg.Role,
-		Key:          cfg.Key,
-		UDPPort:      cfg.UDPPort,
-		MonitorPaths: convertMonitorPaths(cfg.MonitorPaths),
-		MasterAddr:   cfg.MasterAddr,
-		SyncPath:     cfg.SyncPath,
-		WebServer:    convertWebConfig(cfg.WebServer),
-	}
-	m, err := master.NewMaster(masterCfg)
+func startMaster(cfg *config.Config, t transport.Transport, events *control.Publisher) (Node, error) {
+	m, err := master.NewMasterWithTransport(cfg, t)
 	if err != nil {
 		return nil, fmt.Errorf("创建Master节点失败: %v", err)
 	}
+	m.SetEvents(events)
 
 	if err := m.Start(); err != nil {
 		return nil, fmt.Errorf("启动Master节点失败: %v", err)
@@ -175,22 +219,12 @@ func startMaster(cfg *Config) (Node, error) {
 }
 
 // startSlave 启动Slave节点
-func startSlave(cfg *Config) (Node, error) {
-	// 转换Config类型
-	slaveCfg := &slave.Config{
-		NodeID:       cfg.NodeID,
-		Role:         cfg.Role,
-		Key:          cfg.Key,
-		UDPPort:      cfg.UDPPort,
-		MonitorPaths: convertSlaveMonitorPaths(cfg.MonitorPaths),
-		MasterAddr:   cfg.MasterAddr,
-		SyncPath:     cfg.SyncPath,
-		WebServer:    convertSlaveWebConfig(cfg.WebServer),
-	}
-	s, err := slave.NewSlave(slaveCfg)
+func startSlave(cfg *config.Config, t transport.Transport, events *control.Publisher) (Node, error) {
+	s, err := slave.NewSlaveWithTransport(cfg, t)
 	if err != nil {
 		return nil, fmt.Errorf("创建Slave节点失败: %v", err)
 	}
+	s.SetEvents(events)
 
 	if err := s.Start(); err != nil {
 		return nil, fmt.Errorf("启动Slave节点失败: %v", err)
@@ -202,11 +236,11 @@ func startSlave(cfg *Config) (Node, error) {
 	return s, nil
 }
 
-// waitForShutdown 等待关闭信号
-func waitForShutdown(node Node) {
+// waitForShutdown 等待关闭信号，关闭节点前先关闭控制接口（ctl为nil表示未启动）
+func waitForShutdown(node Node, ctl *control.Server, events *control.Publisher) {
 	// 创建信号通道
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	notifySignals(sigChan)
 
 	// 启动状态报告定时器
 	statsTicker := time.NewTicker(60 * time.Second)
@@ -217,7 +251,21 @@ func waitForShutdown(node Node) {
 	for {
 		select {
 		case sig := <-sigChan:
+			switch sig {
+			case reloadSignal:
+				log.Printf("接收到信号: %v，重新加载配置: %s", sig, *configPath)
+				reload(node, events)
+				continue
+			case statsSignal:
+				log.Printf("接收到信号: %v，输出状态信息", sig)
+				dumpStats(node)
+				continue
+			}
+
 			log.Printf("接收到信号: %v，开始关闭...", sig)
+			if ctl != nil {
+				ctl.Close()
+			}
 			if err := node.Stop(); err != nil {
 				log.Printf("关闭节点失败: %v", err)
 				os.Exit(1)
@@ -232,20 +280,114 @@ func waitForShutdown(node Node) {
 	}
 }
 
+// reloadMutex 保证SIGHUP和控制接口的reload命令不会同时热加载
+var reloadMutex sync.Mutex
+
+// reload 热加载配置并发布结果，失败时继续使用原配置
+func reload(node Node, events *control.Publisher) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if err := reloadNode(node); err != nil {
+		log.Printf("重新加载配置失败，继续使用原配置: %v", err)
+		events.Publish(control.Event{Type: control.EventReload, Path: *configPath, Message: "失败，继续使用原配置: " + err.Error()})
+		return err
+	}
+	events.Publish(control.Event{Type: control.EventReload, Path: *configPath, Message: "已重新加载"})
+	return nil
+}
+
+// reloadNode 重新读取配置文件并热加载到运行中的节点
+func reloadNode(node Node) error {
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	return reloadConfig(node, cfg)
+}
+
+// reloadConfig 将新配置热加载到运行中的节点
+func reloadConfig(node Node, cfg *config.Config) error {
+	switch n := node.(type) {
+	case *groupNode:
+		return n.Reload(cfg)
+	case *master.Master:
+		if len(cfg.Groups) > 0 {
+			return fmt.Errorf("增加同步组需要重启")
+		}
+		if !cfg.IsMaster() {
+			return fmt.Errorf("不支持热加载切换节点角色: master -> %s", cfg.Role)
+		}
+		return n.Reload(cfg)
+	case *slave.Slave:
+		if len(cfg.Groups) > 0 {
+			return fmt.Errorf("增加同步组需要重启")
+		}
+		if !cfg.IsSlave() {
+			return fmt.Errorf("不支持热加载切换节点角色: slave -> %s", cfg.Role)
+		}
+		return n.Reload(cfg)
+	default:
+		return fmt.Errorf("节点不支持热加载")
+	}
+}
+
+// dumpStats 输出详细状态信息
+func dumpStats(node Node) {
+	stats := node.GetDetailedStats()
+
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	log.Printf("===== 节点详细状态 =====")
+	for _, key := range keys {
+		log.Printf("  %s: %+v", key, stats[key])
+	}
+	log.Printf("========================")
+}
+
 // printUsage 打印使用说明
 func printUsage() {
 	fmt.Printf(`%s - 跨服务器文件同步守护程序 v%s
 
 `, APP_NAME, VERSION)
 	fmt.Printf("用法:\n")
-	fmt.Printf("  %s [选项]\n\n", APP_NAME)
+	fmt.Printf("  %s [选项]\n", APP_NAME)
+	fmt.Printf("  %s [选项] <命令> [参数]\n\n", APP_NAME)
 	fmt.Printf("选项:\n")
 	fmt.Printf("  -c <配置文件>    指定配置文件路径 (默认: xsync.yaml)\n")
 	fmt.Printf("  -d              以daemon模式运行\n")
 	fmt.Printf("  -p <PID文件>     指定PID文件路径\n")
 	fmt.Printf("  -l <日志文件>    指定日志文件路径\n")
+	fmt.Printf("  -g <同步组>      子命令操作指定同步组的目录\n")
 	fmt.Printf("  -v              显示版本信息\n")
 	fmt.Printf("  -h              显示此帮助信息\n\n")
+	fmt.Printf("命令:\n")
+	fmt.Printf("  versions list [路径]          列出有历史版本的文件或指定文件的历史版本 (Slave)\n")
+	fmt.Printf("  versions restore <路径> <ID>  将文件恢复为指定的历史版本 (Slave)\n")
+	fmt.Printf("  snapshot list                 列出同步目录的快照 (Slave)\n")
+	fmt.Printf("  snapshot create               立即创建快照 (Slave)\n")
+	fmt.Printf("  snapshot diff <快照> [快照]   比较两个快照，省略第二个时与当前目录比较 (Slave)\n")
+	fmt.Printf("  snapshot restore <快照>       将同步目录恢复到快照 (Slave)\n")
+	fmt.Printf("                                快照可以是ID、latest或时间(如 2024-01-15T14:00)\n")
+	fmt.Printf("  config check                  检查配置：目录读写权限、端口、地址解析和密钥，有错误时退出码非0\n")
+	fmt.Printf("  config print                  输出合并include、环境变量和默认值后生效的配置（隐藏密钥和密码）\n\n")
+	fmt.Printf("控制命令 (通过control_socket访问运行中的节点):\n")
+	fmt.Printf("  status                        查看节点状态，Master列出各Slave的待发送数、延迟、错误和最近心跳\n")
+	fmt.Printf("  stats                         以JSON输出详细统计信息，与SIGUSR1输出的内容相同\n")
+	fmt.Printf("  events                        实时输出文件变更、发送结果、全量同步、偏差和钩子失败等事件\n")
+	fmt.Printf("  reload                        重新加载配置文件，与SIGHUP相同，失败时退出码非0\n")
+	fmt.Printf("  resync [slave [路径]]         向Slave重新全量同步，指定路径时只重新发送该路径，省略slave时同步所有Slave (Master)\n")
+	fmt.Printf("  resync                        向Master请求全量同步 (Slave)\n")
+	fmt.Printf("  push <文件>                   立即将文件或目录发送给所在监控路径的所有Slave (Master)\n")
+	fmt.Printf("  verify <slave>                比较Master和Slave上文件的哈希，不一致时退出码非0 (Master)\n")
+	fmt.Printf("  ls <slave> [[目标:]目录]      列出Slave上的目录 (Master)\n")
+	fmt.Printf("  pause [监控路径]              暂停发送变更，省略路径时暂停所有监控路径 (Master)\n")
+	fmt.Printf("  resume [监控路径]             恢复发送，并发送暂停期间的变更 (Master)\n")
+	fmt.Printf("                                slave可以是monitor_paths中的地址或Slave的节点ID\n\n")
 	fmt.Printf("示例:\n")
 	fmt.Printf("  # 前台启动Master节点\n")
 	fmt.Printf("  %s -c master.yaml\n\n", APP_NAME)
@@ -253,8 +395,23 @@ func printUsage() {
 	fmt.Printf("  %s -d -c master.yaml -p /var/run/xsync-master.pid -l /var/log/xsync-master.log\n\n", APP_NAME)
 	fmt.Printf("  # daemon模式启动Slave节点\n")
 	fmt.Printf("  %s -d -c slave1.yaml -p /var/run/xsync-slave1.pid -l /var/log/xsync-slave1.log\n\n", APP_NAME)
+	fmt.Printf("  # 查看并恢复Slave上文件的历史版本\n")
+	fmt.Printf("  %s -c slave1.yaml versions list docs/a.txt\n", APP_NAME)
+	fmt.Printf("  %s -c slave1.yaml versions restore docs/a.txt 20240101-120000.000000000\n\n", APP_NAME)
+	fmt.Printf("  # 将Slave的同步目录恢复到14:00时的状态\n")
+	fmt.Printf("  %s -c slave1.yaml snapshot restore 2024-01-15T14:00\n\n", APP_NAME)
+	fmt.Printf("  # 列出同步组tenant-a的快照\n")
+	fmt.Printf("  %s -c slave1.yaml -g tenant-a snapshot list\n\n", APP_NAME)
+	fmt.Printf("  # 查看各Slave的同步状态，并检查slave-01上的文件是否与Master一致\n")
+	fmt.Printf("  %s -c master.yaml status\n", APP_NAME)
+	fmt.Printf("  %s -c master.yaml verify slave-01\n\n", APP_NAME)
+	fmt.Printf("  # 实时查看同步组tenant-a的事件\n")
+	fmt.Printf("  %s -c master.yaml -g tenant-a events\n\n", APP_NAME)
+	fmt.Printf("  # 部署前检查配置\n")
+	fmt.Printf("  %s -c master.yaml config check\n\n", APP_NAME)
 	fmt.Printf("环境变量:\n")
-	fmt.Printf("  XSYNC_KEY       AES-256加密密钥 (32字节)\n\n")
+	fmt.Printf("  XSYNC_KEY       AES-256加密密钥 (32字节)\n")
+	fmt.Printf("  XSYNC_<配置项>  覆盖配置文件中的配置项，如 XSYNC_UDP_PORT、XSYNC_WEB_SERVER_PORT\n\n")
 	fmt.Printf("信号处理:\n")
 	fmt.Printf("  SIGTERM/SIGINT  优雅停止服务\n")
 	fmt.Printf("  SIGHUP          重新加载配置\n")
@@ -0,0 +1,185 @@
+package master
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/config"
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// eventBatch 等待一起发送的文件事件
+type eventBatch struct {
+	started time.Time
+	ops     map[string]string // 路径 -> 最后一次操作
+}
+
+// add 合并一个文件事件，同一路径只保留最后一次操作
+func (b *eventBatch) add(event *watcher.FileEvent) {
+	b.ops[event.Path] = event.Op
+}
+
+// batchOpen 判断批次是否仍需等待：标记文件存在时发布尚未完成
+func batchOpen(p config.MonitorPath, batch *eventBatch) bool {
+	if p.BatchMarker == "" || time.Since(batch.started) >= p.BatchMaxMs.Duration() {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(p.Path, filepath.FromSlash(p.BatchMarker)))
+	return err == nil
+}
+
+// handleBatchEvents 批量模式下处理文件事件：事件静默batch_quiet_ms且标记文件不存在后整批发送
+func (m *Master) handleBatchEvents(fw *watcher.FileWatcher, monitorPath config.MonitorPath) {
+	var batch *eventBatch
+	var quiet <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-fw.GetEventChan():
+			if !ok {
+				// 监控器停止（热加载重建）时发送已收集的变更
+				if batch != nil {
+					m.sendBatch(batch, monitorPath)
+				}
+				return
+			}
+			if current, exists := m.getMonitorPath(monitorPath.Path); exists {
+				monitorPath = current
+			}
+			if m.holdEvent(event, monitorPath) {
+				continue
+			}
+			m.stats.recordEvent()
+
+			if batch == nil {
+				batch = &eventBatch{started: time.Now(), ops: make(map[string]string)}
+			}
+			batch.add(event)
+			if time.Since(batch.started) >= monitorPath.BatchMaxMs.Duration() {
+				m.sendBatch(batch, monitorPath)
+				batch, quiet = nil, nil
+				continue
+			}
+			quiet = time.After(monitorPath.BatchQuietMs.Duration())
+
+		case <-quiet:
+			if batchOpen(monitorPath, batch) {
+				quiet = time.After(monitorPath.BatchQuietMs.Duration())
+				continue
+			}
+			m.sendBatch(batch, monitorPath)
+			batch, quiet = nil, nil
+
+		case <-m.done:
+			if batch != nil {
+				log.Printf("丢弃未发送的批次: %s (%d 个变更)", monitorPath.Path, len(batch.ops))
+			}
+			return
+		}
+	}
+}
+
+// sendBatch 按文件当前状态生成一批数据包，发送给所有Slave后发送BATCH_COMMIT
+// 某个Slave有数据包发送失败时不向它提交，Slave超时后丢弃该批次并重新请求全量同步
+func (m *Master) sendBatch(batch *eventBatch, monitorPath config.MonitorPath) {
+	id := time.Now().Format("20060102-150405.000000")
+
+	paths := make([]string, 0, len(batch.ops))
+	for path := range batch.ops {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rep := m.getReplica(monitorPath.Path)
+	commit := protocol.BatchCommit{ID: id}
+	var packets []*protocol.SyncPacket
+	for _, path := range paths {
+		// 同一路径的多次变更已合并，按文件当前是否存在决定发送内容还是删除
+		event := &watcher.FileEvent{Op: batch.ops[path], Path: path}
+		if _, err := os.Stat(filepath.Join(monitorPath.Path, path)); err != nil {
+			event.Op = "DELETE"
+		} else if event.Op == "DELETE" {
+			event.Op = "CREATE"
+		}
+
+		packet, err := watcher.CreateSyncPacket(event, monitorPath.Path)
+		if err != nil {
+			log.Printf("创建同步包失败: %v", err)
+			continue
+		}
+		if rep != nil && !rep.PrepareLocal(packet) {
+			log.Printf("忽略远程变更引起的本地事件: %s %s", packet.Op, packet.Path)
+			continue
+		}
+		if !m.checkPreSend(monitorPath, packet) {
+			continue
+		}
+
+		packet.Batch = id
+		packet.Target = monitorPath.Target
+		packets = append(packets, packet)
+		commit.Entries = append(commit.Entries, packet.Path)
+	}
+	if len(packets) == 0 {
+		return
+	}
+
+	commitPacket, err := protocol.NewReportPacket("BATCH_COMMIT", id, commit)
+	if err != nil {
+		log.Printf("创建批次提交包失败: %v", err)
+		return
+	}
+	commitPacket.Target = monitorPath.Target
+
+	log.Printf("发送批次 %s: %s, %d 个变更 -> %v", id, monitorPath.Path, len(packets), monitorPath.Slaves)
+	var wg sync.WaitGroup
+	var failedMutex sync.Mutex
+	failed := make(map[string]bool)
+	for _, packet := range packets {
+		wg.Add(1)
+		m.sender.submit(m.withPeer(monitorPath.Slaves, packet, monitorPath), packet, priorityHigh, func(addrs []string) {
+			failedMutex.Lock()
+			for _, addr := range addrs {
+				failed[addr] = true
+			}
+			failedMutex.Unlock()
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	var targets []string
+	for _, slaveAddr := range monitorPath.Slaves {
+		if failed[slaveAddr] {
+			log.Printf("批次 %s 发送到 %s 失败，不提交", id, slaveAddr)
+			continue
+		}
+		targets = append(targets, slaveAddr)
+	}
+	var failedCommits []string
+	if len(targets) > 0 {
+		failedCommits = m.sender.sendAll(targets, commitPacket, priorityHigh)
+		log.Printf("批次 %s 已提交到 %v", id, diffSlaves(failedCommits, targets))
+	}
+
+	if committed := diffSlaves(failedCommits, targets); len(committed) > 0 {
+		m.events.Publish(control.Event{Type: control.EventBatch, Path: monitorPath.Path, Slave: strings.Join(committed, ","),
+			Message: fmt.Sprintf("批次 %s 已提交，%d 个变更", id, len(packets))})
+	}
+	if unsent := diffSlaves(targets, monitorPath.Slaves); len(unsent) > 0 || len(failedCommits) > 0 {
+		m.events.Publish(control.Event{Type: control.EventSendFailed, Path: monitorPath.Path, Slave: strings.Join(append(unsent, failedCommits...), ","),
+			Message: fmt.Sprintf("批次 %s 未提交", id)})
+	}
+
+	m.stats.mutex.Lock()
+	m.stats.Batches++
+	m.stats.mutex.Unlock()
+}
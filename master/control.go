@@ -0,0 +1,620 @@
+package master
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/config"
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// 向Slave查询的超时时间
+const (
+	listTimeout   = 30 * time.Second
+	verifyTimeout = 5 * time.Minute // Slave需要计算所有文件的哈希
+)
+
+// pausedPath 暂停发送的监控路径，期间的变更按路径合并，恢复时按文件当前状态发送
+type pausedPath struct {
+	since  time.Time
+	events map[string]*watcher.FileEvent
+}
+
+// queryTable 等待Slave回复的查询
+type queryTable struct {
+	mutex   sync.Mutex
+	next    uint64
+	waiting map[string]chan *protocol.QueryReply
+}
+
+// newQueryTable 创建查询表
+func newQueryTable() *queryTable {
+	return &queryTable{waiting: make(map[string]chan *protocol.QueryReply)}
+}
+
+// SetEvents 设置发布到本地控制接口的事件，需在Start前调用
+func (m *Master) SetEvents(events *control.Publisher) {
+	m.events = events
+}
+
+// HandleControl 执行本地控制接口的命令
+func (m *Master) HandleControl(command string, args []string) (interface{}, error) {
+	switch command {
+	case "status":
+		return m.controlStatus(), nil
+	case "resync":
+		if len(args) > 2 {
+			return nil, fmt.Errorf("用法: resync [slave [路径]]")
+		}
+		return m.controlResync(args)
+	case "push":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("用法: push <文件>")
+		}
+		return m.controlPush(args[0])
+	case "verify":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("用法: verify <slave>")
+		}
+		return m.controlVerify(args[0])
+	case "ls":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("用法: ls <slave> [[目标:]目录]")
+		}
+		dir := ""
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		return m.controlList(args[0], dir)
+	case "pause":
+		if len(args) > 1 {
+			return nil, fmt.Errorf("用法: pause [监控路径]")
+		}
+		return m.pause(strings.Join(args, ""))
+	case "resume":
+		if len(args) > 1 {
+			return nil, fmt.Errorf("用法: resume [监控路径]")
+		}
+		return m.resume(strings.Join(args, ""))
+	default:
+		return nil, fmt.Errorf("Master不支持的命令: %s", command)
+	}
+}
+
+// controlStatus 获取节点状态和各Slave的发送队列、延迟和错误
+func (m *Master) controlStatus() *control.Status {
+	status := &control.Status{NodeID: m.config.NodeID, Role: "master", Stats: m.GetStats()}
+	if ha := m.getHAStats(); ha != nil {
+		status.Stats["ha"] = ha
+	}
+
+	m.mutex.RLock()
+	for path := range m.paused {
+		status.Paused = append(status.Paused, path)
+	}
+	m.mutex.RUnlock()
+	sort.Strings(status.Paused)
+
+	// 按配置顺序列出Slave
+	var addrs []string
+	paths := make(map[string][]string)
+	for _, monitorPath := range m.getMonitorPaths() {
+		for _, addr := range monitorPath.Slaves {
+			if _, exists := paths[addr]; !exists {
+				addrs = append(addrs, addr)
+			}
+			paths[addr] = append(paths[addr], monitorPath.Path)
+		}
+	}
+
+	syncs := m.getSyncStats()
+	m.stats.mutex.Lock()
+	status.Stats["processed_events"] = m.stats.ProcessedEvents
+	status.Stats["sent_packets"] = m.stats.SentPackets
+	status.Stats["failed_sends"] = m.stats.FailedSends
+	for _, addr := range addrs {
+		queue := m.sender.getQueueStatus(addr)
+		slave := control.SlaveStatus{
+			Addr:         addr,
+			NodeID:       m.stats.SlaveNodes[addr],
+			Paths:        paths[addr],
+			LastSeen:     m.stats.SlaveSeen[addr],
+			Queued:       queue.high,
+			SyncQueued:   queue.low,
+			Active:       queue.active,
+			LagSec:       queue.lag.Seconds(),
+			Sent:         queue.sent,
+			Failed:       queue.failed,
+			Drifts:       m.stats.SlaveDrifts[addr],
+			HookFailures: m.stats.SlaveHookFailures[addr],
+		}
+		if progress, ok := syncs[addr].(map[string]interface{}); ok {
+			slave.FullSync, _ = progress["status"].(string)
+		}
+		status.Slaves = append(status.Slaves, slave)
+	}
+	m.stats.mutex.Unlock()
+	return status
+}
+
+// resolveSlave 按配置中的地址或节点ID查找Slave，返回配置中的地址
+func (m *Master) resolveSlave(name string) (string, error) {
+	configured := make(map[string]bool)
+	for _, monitorPath := range m.getMonitorPaths() {
+		for _, addr := range monitorPath.Slaves {
+			configured[addr] = true
+		}
+	}
+	if configured[name] {
+		return name, nil
+	}
+
+	m.stats.mutex.Lock()
+	defer m.stats.mutex.Unlock()
+	for addr, nodeID := range m.stats.SlaveNodes {
+		if nodeID == name && configured[addr] {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("未找到Slave: %s（可使用monitor_paths中的地址或Slave的节点ID）", name)
+}
+
+// requireActive 检查本节点是否为主Master，备用Master不发送文件
+func (m *Master) requireActive() error {
+	if !m.isActive() {
+		return fmt.Errorf("本节点是备用Master，请在主Master上执行")
+	}
+	return nil
+}
+
+// controlResync 向Slave重新发送所有文件，指定路径时只发送该路径下的文件，未指定Slave时向所有Slave全量同步
+func (m *Master) controlResync(args []string) (interface{}, error) {
+	if err := m.requireActive(); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		slaves := m.allSlaves()
+		for _, slaveAddr := range slaves {
+			go func(slaveAddr string) {
+				if err := m.handleSyncRequest(slaveAddr); err != nil {
+					log.Printf("全量同步失败 %s: %v", slaveAddr, err)
+				}
+			}(slaveAddr)
+		}
+		return fmt.Sprintf("已开始向 %d 个Slave全量同步，可通过 status 查看进度", len(slaves)), nil
+	}
+	slaveAddr, err := m.resolveSlave(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 1 {
+		go func() {
+			if err := m.handleSyncRequest(slaveAddr); err != nil {
+				log.Printf("全量同步失败 %s: %v", slaveAddr, err)
+			}
+		}()
+		return fmt.Sprintf("已开始向 %s 全量同步，可通过 status 查看进度", slaveAddr), nil
+	}
+
+	count, matched := 0, false
+	for _, monitorPath := range m.getMonitorPaths() {
+		if !m.isSlaveInPath(slaveAddr, monitorPath) {
+			continue
+		}
+		relPath, ok := monitorRelPath(monitorPath, args[1])
+		if !ok {
+			continue
+		}
+		matched = true
+		monitorPath.Slaves = []string{slaveAddr}
+		n, err := m.sendTree(monitorPath, relPath)
+		count += n
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !matched {
+		return nil, fmt.Errorf("%s 不在 %s 的监控路径中", args[1], slaveAddr)
+	}
+	return fmt.Sprintf("已向 %s 重新发送 %d 项", slaveAddr, count), nil
+}
+
+// controlPush 立即向监控路径的所有Slave发送文件（或目录下的所有文件），不受暂停影响
+func (m *Master) controlPush(path string) (interface{}, error) {
+	if err := m.requireActive(); err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("需要绝对路径: %s", path)
+	}
+
+	count, matched := 0, false
+	for _, monitorPath := range m.getMonitorPaths() {
+		relPath, ok := monitorRelPath(monitorPath, path)
+		if !ok {
+			continue
+		}
+		matched = true
+		n, err := m.sendTree(monitorPath, relPath)
+		count += n
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !matched {
+		return nil, fmt.Errorf("%s 不在任何监控路径中", path)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%s 被监控路径的过滤规则排除", path)
+	}
+	return fmt.Sprintf("已将 %d 项加入发送队列", count), nil
+}
+
+// monitorRelPath 获取路径在监控路径中的相对路径：绝对路径需位于监控路径下，相对路径相对监控路径
+// 监控路径本身返回"."
+func monitorRelPath(monitorPath config.MonitorPath, path string) (string, bool) {
+	if filepath.IsAbs(path) {
+		root, err := filepath.Abs(monitorPath.Path)
+		if err != nil {
+			return "", false
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return filepath.ToSlash(relPath), true
+	}
+	if path == "" || path == "." {
+		return ".", true
+	}
+	relPath, err := protocol.CleanPath(path)
+	if err != nil {
+		return "", false
+	}
+	return relPath, true
+}
+
+// sendTree 将监控路径中relPath对应的文件或目录（含其下所有项）加入监控路径Slave的发送队列
+// 按全量同步的方式发送（低优先级，附加当前版本），返回加入队列的项数
+func (m *Master) sendTree(monitorPath config.MonitorPath, relPath string) (int, error) {
+	if _, err := os.Stat(filepath.Join(monitorPath.Path, filepath.FromSlash(relPath))); err != nil {
+		return 0, fmt.Errorf("%s 中不存在 %s", monitorPath.Path, relPath)
+	}
+
+	count := 0
+	err := m.walkMonitorPath(monitorPath, func(path, rel string, info os.FileInfo) error {
+		if relPath == "." || rel == relPath || strings.HasPrefix(rel, relPath+"/") {
+			m.dispatchEvent(&watcher.FileEvent{Op: "CREATE", Path: rel, IsDir: info.IsDir()}, monitorPath, false)
+			count++
+			return nil
+		}
+		// 跳过不包含目标路径的目录
+		if info.IsDir() && !strings.HasPrefix(relPath, rel+"/") {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("遍历目录失败: %v", err)
+	}
+	return count, nil
+}
+
+// controlVerify 按目标比较Master和Slave上文件的哈希
+func (m *Master) controlVerify(name string) (interface{}, error) {
+	slaveAddr, err := m.resolveSlave(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一目标可能对应多个监控路径，与全量同步的文件清单一致
+	var targets []string
+	byTarget := make(map[string][]config.MonitorPath)
+	for _, monitorPath := range m.getMonitorPaths() {
+		if !m.isSlaveInPath(slaveAddr, monitorPath) {
+			continue
+		}
+		if _, exists := byTarget[monitorPath.Target]; !exists {
+			targets = append(targets, monitorPath.Target)
+		}
+		byTarget[monitorPath.Target] = append(byTarget[monitorPath.Target], monitorPath)
+	}
+
+	result := &control.VerifyResult{Slave: slaveAddr}
+	for _, target := range targets {
+		result.Targets = append(result.Targets, m.verifyTarget(slaveAddr, target, byTarget[target]))
+	}
+	return result, nil
+}
+
+// verifyTarget 比较一个目标中的文件，Slave计算哈希的同时Master计算本地文件的哈希
+func (m *Master) verifyTarget(slaveAddr, target string, monitorPaths []config.MonitorPath) control.TargetDiff {
+	diff := control.TargetDiff{Target: target}
+
+	type queryResult struct {
+		reply *protocol.QueryReply
+		err   error
+	}
+	remote := make(chan queryResult, 1)
+	go func() {
+		reply, err := m.query(slaveAddr, "VERIFY", target, protocol.Query{}, verifyTimeout)
+		remote <- queryResult{reply, err}
+	}()
+
+	local := make(map[string]string)
+	for _, monitorPath := range monitorPaths {
+		err := m.walkMonitorPath(monitorPath, func(path, relPath string, info os.FileInfo) error {
+			if info.IsDir() {
+				return nil
+			}
+			hash, err := protocol.HashFile(path)
+			if err != nil {
+				// 遍历期间被删除的文件不参与比较
+				log.Printf("计算文件哈希失败 %s: %v", path, err)
+				return nil
+			}
+			local[relPath] = hash
+			return nil
+		})
+		if err != nil {
+			diff.Error = fmt.Sprintf("遍历目录失败 %s: %v", monitorPath.Path, err)
+		}
+	}
+
+	result := <-remote
+	if result.err != nil {
+		diff.Error = result.err.Error()
+		return diff
+	}
+
+	diff.Files = len(local)
+	for relPath, hash := range local {
+		remoteHash, exists := result.reply.Hashes[relPath]
+		switch {
+		case !exists:
+			diff.Missing = append(diff.Missing, relPath)
+		case remoteHash != hash:
+			diff.Differ = append(diff.Differ, relPath)
+		}
+	}
+	for relPath := range result.reply.Hashes {
+		if _, exists := local[relPath]; !exists {
+			diff.Extra = append(diff.Extra, relPath)
+		}
+	}
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Differ)
+	sort.Strings(diff.Extra)
+	return diff
+}
+
+// controlList 列出Slave上的目录，dir可写为"目标:目录"列出targets中的目录
+func (m *Master) controlList(name, dir string) (interface{}, error) {
+	slaveAddr, err := m.resolveSlave(name)
+	if err != nil {
+		return nil, err
+	}
+
+	target := ""
+	if i := strings.Index(dir, ":"); i > 0 {
+		for _, monitorPath := range m.getMonitorPaths() {
+			if monitorPath.Target == dir[:i] && m.isSlaveInPath(slaveAddr, monitorPath) {
+				target, dir = dir[:i], dir[i+1:]
+				break
+			}
+		}
+	}
+
+	reply, err := m.query(slaveAddr, "LIST", target, protocol.Query{Dir: dir}, listTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		dir = "."
+	}
+	return &control.ListResult{Slave: slaveAddr, Target: target, Dir: dir, Entries: reply.Entries}, nil
+}
+
+// query 向Slave发送查询并等待回复
+func (m *Master) query(slaveAddr, op, target string, query protocol.Query, timeout time.Duration) (*protocol.QueryReply, error) {
+	id, replies := m.queries.add()
+	defer m.queries.remove(id)
+
+	query.ID = id
+	packet, err := protocol.NewReportPacket(op, m.config.NodeID, query)
+	if err != nil {
+		return nil, err
+	}
+	packet.Target = target
+	if err := m.transport.Send(slaveAddr, packet); err != nil {
+		return nil, fmt.Errorf("发送查询到 %s 失败: %v", slaveAddr, err)
+	}
+
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, fmt.Errorf("%s: %s", slaveAddr, reply.Error)
+		}
+		return reply, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("等待 %s 回复超时", slaveAddr)
+	}
+}
+
+// add 登记一个查询，返回查询ID和接收回复的通道
+func (t *queryTable) add() (string, chan *protocol.QueryReply) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.next++
+	id := fmt.Sprintf("%d-%d", time.Now().UnixNano(), t.next)
+	replies := make(chan *protocol.QueryReply, 1)
+	t.waiting[id] = replies
+	return id, replies
+}
+
+// remove 删除查询
+func (t *queryTable) remove(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.waiting, id)
+}
+
+// deliver 将回复交给等待的查询，查询已超时时返回false
+func (t *queryTable) deliver(reply *protocol.QueryReply) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	replies, exists := t.waiting[reply.ID]
+	if !exists {
+		return false
+	}
+	select {
+	case replies <- reply:
+	default:
+	}
+	return true
+}
+
+// handleQueryReply 处理Slave对查询的回复
+func (m *Master) handleQueryReply(packet *protocol.SyncPacket) error {
+	var reply protocol.QueryReply
+	if err := packet.DecodeReport(&reply); err != nil {
+		return err
+	}
+	if !m.queries.deliver(&reply) {
+		log.Printf("丢弃已超时的查询回复: %s from %s", reply.ID, reply.NodeID)
+	}
+	return nil
+}
+
+// findMonitorPath 按路径查找监控路径配置，比较绝对路径
+func (m *Master) findMonitorPath(path string) (config.MonitorPath, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return config.MonitorPath{}, false
+	}
+	for _, monitorPath := range m.getMonitorPaths() {
+		if root, err := filepath.Abs(monitorPath.Path); err == nil && root == absPath {
+			return monitorPath, true
+		}
+	}
+	return config.MonitorPath{}, false
+}
+
+// pause 暂停发送监控路径的变更，path为空时暂停所有监控路径
+// 暂停期间的变更按路径合并保存，恢复后按文件当前状态发送；Slave请求的全量同步不受影响
+func (m *Master) pause(path string) (interface{}, error) {
+	var paths []string
+	if path == "" {
+		for _, monitorPath := range m.getMonitorPaths() {
+			paths = append(paths, monitorPath.Path)
+		}
+	} else {
+		monitorPath, ok := m.findMonitorPath(path)
+		if !ok {
+			return nil, fmt.Errorf("未找到监控路径: %s", path)
+		}
+		paths = []string{monitorPath.Path}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var paused []string
+	for _, p := range paths {
+		if _, exists := m.paused[p]; exists {
+			continue
+		}
+		m.paused[p] = &pausedPath{since: time.Now(), events: make(map[string]*watcher.FileEvent)}
+		paused = append(paused, p)
+		log.Printf("暂停发送监控路径的变更: %s", p)
+		m.events.Publish(control.Event{Type: control.EventPause, Path: p})
+	}
+	return map[string]interface{}{"paused": paused}, nil
+}
+
+// resume 恢复发送监控路径的变更并发送暂停期间收集的变更，path为空时恢复所有监控路径
+func (m *Master) resume(path string) (interface{}, error) {
+	var target string
+	if path != "" {
+		monitorPath, ok := m.findMonitorPath(path)
+		if !ok {
+			return nil, fmt.Errorf("未找到监控路径: %s", path)
+		}
+		target = monitorPath.Path
+	}
+
+	m.mutex.Lock()
+	held := make(map[string]*pausedPath)
+	for p, paused := range m.paused {
+		if target == "" || p == target {
+			held[p] = paused
+			delete(m.paused, p)
+		}
+	}
+	m.mutex.Unlock()
+
+	resumed := make(map[string]int, len(held))
+	for p, paused := range held {
+		resumed[p] = len(paused.events)
+		log.Printf("恢复发送监控路径的变更: %s (暂停 %s，待发送 %d 项)", p, time.Since(paused.since).Round(time.Second), len(paused.events))
+		m.events.Publish(control.Event{Type: control.EventResume, Path: p, Message: fmt.Sprintf("待发送 %d 项", len(paused.events))})
+		monitorPath, exists := m.getMonitorPath(p)
+		if !exists || len(paused.events) == 0 {
+			continue
+		}
+		go m.sendHeld(monitorPath, paused)
+	}
+	return map[string]interface{}{"resumed": resumed}, nil
+}
+
+// holdEvent 监控路径暂停时保存文件事件，返回true表示事件已保存、暂不发送
+func (m *Master) holdEvent(event *watcher.FileEvent, monitorPath config.MonitorPath) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	paused, exists := m.paused[monitorPath.Path]
+	if !exists {
+		return false
+	}
+	paused.events[event.Path] = event
+	return true
+}
+
+// sendHeld 发送暂停期间收集的变更：批量模式的路径作为一个批次发送，否则按路径顺序逐个发送
+func (m *Master) sendHeld(monitorPath config.MonitorPath, paused *pausedPath) {
+	if monitorPath.Batch {
+		batch := &eventBatch{started: time.Now(), ops: make(map[string]string, len(paused.events))}
+		for _, event := range paused.events {
+			batch.add(event)
+		}
+		m.sendBatch(batch, monitorPath)
+		return
+	}
+
+	paths := make([]string, 0, len(paused.events))
+	for path := range paused.events {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		// 同一路径的多次变更已合并，按文件当前是否存在决定发送内容还是删除
+		event := *paused.events[path]
+		if info, err := os.Stat(filepath.Join(monitorPath.Path, filepath.FromSlash(path))); err != nil {
+			event.Op = "DELETE"
+		} else {
+			event.IsDir = info.IsDir()
+			if event.Op == "DELETE" {
+				event.Op = "CREATE"
+			}
+		}
+		m.processFileEvent(&event, monitorPath)
+	}
+}
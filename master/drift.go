@@ -0,0 +1,121 @@
+package master
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// maxDriftRecords 保留的最近偏差报告数量
+const maxDriftRecords = 50
+
+// driftRecord 一条Slave偏差报告
+type driftRecord struct {
+	Time   time.Time `json:"time"`
+	Slave  string    `json:"slave"`
+	NodeID string    `json:"node_id"`
+	Op     string    `json:"op"`
+	Path   string    `json:"path"`
+	Policy string    `json:"policy"`
+}
+
+// handleDriftReport 处理Slave报告的本地变更，除alert策略外发送Master上的版本进行修复
+func (m *Master) handleDriftReport(packet *protocol.SyncPacket, slaveAddr string) error {
+	var report protocol.DriftReport
+	if err := packet.DecodeReport(&report); err != nil {
+		return err
+	}
+
+	relPath, err := protocol.CleanPath(packet.Path)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Slave %s(%s) 报告本地变更: %s %s (策略 %s)", slaveAddr, report.NodeID, report.Op, relPath, report.Policy)
+	m.stats.recordDrift(driftRecord{
+		Time:   report.Time,
+		Slave:  slaveAddr,
+		NodeID: report.NodeID,
+		Op:     report.Op,
+		Path:   relPath,
+		Policy: report.Policy,
+	})
+	m.events.Publish(control.Event{Type: control.EventDrift, Op: report.Op, Path: relPath, Slave: slaveAddr, Message: "策略 " + report.Policy})
+
+	if report.Policy == protocol.DriftAlert {
+		return nil
+	}
+	return m.repairDrift(slaveAddr, relPath)
+}
+
+// repairDrift 向Slave发送文件在Master上的版本；Master上不存在时删除Slave上多出的文件
+func (m *Master) repairDrift(slaveAddr, relPath string) error {
+	managed := false
+
+	for _, monitorPath := range m.getMonitorPaths() {
+		// Slave只检测sync_path中的本地变更，映射到其他目标的路径不参与修复
+		if !m.isSlaveInPath(slaveAddr, monitorPath) || monitorPath.Target != "" {
+			continue
+		}
+
+		filter, err := watcher.NewFilter(monitorPath.Path, monitorPath.FilterConfig())
+		if err != nil {
+			continue
+		}
+		fullPath := filepath.Join(monitorPath.Path, filepath.FromSlash(relPath))
+		info, err := os.Lstat(fullPath)
+		if err != nil {
+			// 不存在的路径按包含和排除规则判断是否由该监控路径管理
+			if filter.Match(relPath, nil) {
+				managed = true
+			}
+			continue
+		}
+		if !filter.Match(relPath, info) {
+			continue
+		}
+
+		var packet *protocol.SyncPacket
+		if info.IsDir() {
+			packet = protocol.NewSyncPacket("MKDIR", relPath, nil)
+		} else {
+			content, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				return fmt.Errorf("读取文件失败 %s: %v", fullPath, err)
+			}
+			packet = protocol.NewSyncPacket("MODIFY", relPath, content)
+		}
+
+		log.Printf("恢复Slave文件: %s -> %s", relPath, slaveAddr)
+		return m.transport.Send(slaveAddr, packet)
+	}
+
+	// 被所有监控路径排除的文件不属于同步范围，保持不动
+	if !managed {
+		log.Printf("忽略不在同步范围内的偏差: %s %s", slaveAddr, relPath)
+		return nil
+	}
+
+	log.Printf("删除Slave上多出的文件: %s -> %s", relPath, slaveAddr)
+	return m.transport.Send(slaveAddr, protocol.NewSyncPacket("DELETE", relPath, nil))
+}
+
+// recordDrift 记录偏差报告
+func (s *MasterStats) recordDrift(record driftRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.DriftReports++
+	s.SlaveDrifts[record.Slave]++
+	s.RecentDrifts = append(s.RecentDrifts, record)
+	if len(s.RecentDrifts) > maxDriftRecords {
+		s.RecentDrifts = s.RecentDrifts[len(s.RecentDrifts)-maxDriftRecords:]
+	}
+}
@@ -0,0 +1,716 @@
+package master
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/config"
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/webserver"
+)
+
+// 全量同步会话的默认值
+const (
+	syncCursorDir      = "fullsync"         // 进度文件目录（位于state_dir下）
+	syncCursorInterval = 2 * time.Second    // 保存进度文件的间隔
+	syncProgressLog    = 10 * time.Second   // 输出进度日志的间隔
+	syncCursorMaxAge   = 7 * 24 * time.Hour // 超过此时间的进度文件不再用于续传
+	syncChunkSize      = 4 << 20            // 超过此大小的文件分块发送（字节）
+)
+
+// 全量同步会话状态
+const (
+	syncRunning    = "running"
+	syncCompleted  = "completed"
+	syncIncomplete = "incomplete" // 部分文件发送失败，再次请求时从中断处继续
+	syncCanceled   = "canceled"   // 被同一Slave的新请求取代
+)
+
+// syncSession 一次向某个Slave的全量同步，记录进度用于统计和Web接口
+type syncSession struct {
+	mutex        sync.Mutex
+	slave        string
+	status       string
+	started      time.Time
+	finished     time.Time
+	filesTotal   int64
+	filesDone    int64 // 已发送的文件
+	filesSkipped int64 // 续传时跳过的文件和被发送前钩子拒绝的文件
+	filesFailed  int64
+	bytesTotal   int64
+	bytesDone    int64
+	bytesSkipped int64
+	canceled     bool
+	aborted      bool // 有文件发送失败，停止发送剩余的文件
+}
+
+// syncEntry 全量同步中的一个文件或目录
+type syncEntry struct {
+	path    string
+	relPath string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// syncCursor 进度文件的第一行，之后每行是一个已发送成功的文件（sentFile）
+type syncCursor struct {
+	Slave   string    `json:"slave"`
+	Path    string    `json:"path"`
+	Started time.Time `json:"started"`
+}
+
+// sentFile 已发送成功的文件，续传时只跳过路径、大小和修改时间都相同的文件
+type sentFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // 纳秒
+}
+
+// syncPlan 单个监控路径的全量同步计划
+type syncPlan struct {
+	monitorPath config.MonitorPath
+	entries     []syncEntry
+	cursorFile  string
+	resume      *syncCursor         // 上次中断的进度，为nil表示不续传
+	sent        map[string]sentFile // 上次中断前已发送的文件
+	excluded    []string            // 被过滤规则排除的路径，随文件清单发给Slave
+
+	mutex   sync.Mutex
+	done    int // 已发送成功或跳过的条目数
+	failed  bool
+	pending []sentFile // 已发送成功、尚未写入进度文件的文件
+	journal *os.File
+}
+
+// startSyncSession 创建Slave的全量同步会话，取消该Slave正在进行的会话
+func (m *Master) startSyncSession(slaveAddr string) *syncSession {
+	session := &syncSession{slave: slaveAddr, status: syncRunning, started: time.Now()}
+
+	m.mutex.Lock()
+	previous := m.syncs[slaveAddr]
+	m.syncs[slaveAddr] = session
+	m.mutex.Unlock()
+
+	if previous != nil {
+		previous.mutex.Lock()
+		if previous.status == syncRunning {
+			previous.canceled = true
+			log.Printf("取消 %s 正在进行的全量同步，从上次的进度继续", slaveAddr)
+		}
+		previous.mutex.Unlock()
+	}
+	return session
+}
+
+// isCanceled 检查会话是否已被新的请求取代
+func (s *syncSession) isCanceled() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.canceled
+}
+
+// stopped 检查会话是否应停止发送：已被取代或Slave已无法连接
+func (s *syncSession) stopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.canceled || s.aborted
+}
+
+// record 记录一个文件的发送结果
+func (s *syncSession) record(size int64, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ok {
+		s.filesDone++
+		s.bytesDone += size
+	} else {
+		s.filesFailed++
+	}
+}
+
+// abort 停止发送剩余的文件
+// 重试后仍发送失败通常说明Slave已断开，Slave重新连接并请求全量同步时从进度处继续
+func (s *syncSession) abort() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.aborted && !s.canceled {
+		s.aborted = true
+		log.Printf("向 %s 发送失败，停止本次全量同步", s.slave)
+	}
+}
+
+// skip 记录一个无需发送的文件
+func (s *syncSession) skip(size int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.filesSkipped++
+	s.bytesSkipped += size
+}
+
+// finish 结束会话
+func (s *syncSession) finish() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case s.canceled:
+		s.status = syncCanceled
+	case s.filesFailed > 0 || s.aborted:
+		s.status = syncIncomplete
+	default:
+		s.status = syncCompleted
+	}
+	s.finished = time.Now()
+	return s.status
+}
+
+// progress 获取会话进度：已完成的文件和字节数、吞吐量和预计剩余时间
+func (s *syncSession) progress() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	end := time.Now()
+	if s.status != syncRunning {
+		end = s.finished
+	}
+	elapsed := end.Sub(s.started).Seconds()
+
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(s.bytesDone) / elapsed
+	}
+	remaining := s.bytesTotal - s.bytesDone - s.bytesSkipped
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	progress := map[string]interface{}{
+		"slave":           s.slave,
+		"status":          s.status,
+		"started":         s.started.Format(time.RFC3339),
+		"elapsed_sec":     elapsed,
+		"files_total":     s.filesTotal,
+		"files_done":      s.filesDone,
+		"files_skipped":   s.filesSkipped,
+		"files_failed":    s.filesFailed,
+		"bytes_total":     s.bytesTotal,
+		"bytes_done":      s.bytesDone,
+		"bytes_skipped":   s.bytesSkipped,
+		"throughput_bps":  throughput,
+		"bytes_remaining": remaining,
+	}
+	if s.status == syncRunning {
+		if throughput > 0 {
+			progress["eta_sec"] = float64(remaining) / throughput
+		}
+	} else {
+		progress["finished"] = s.finished.Format(time.RFC3339)
+	}
+	return progress
+}
+
+// logProgress 输出一行进度日志
+func (s *syncSession) logProgress() {
+	progress := s.progress()
+	eta := "未知"
+	if seconds, ok := progress["eta_sec"].(float64); ok {
+		eta = (time.Duration(seconds) * time.Second).String()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	log.Printf("全量同步进度 %s: %d/%d 个文件(跳过 %d, 失败 %d), %.1f/%.1f MB, %.2f MB/s, 预计剩余 %s",
+		s.slave, s.filesDone+s.filesSkipped+s.filesFailed, s.filesTotal, s.filesSkipped, s.filesFailed,
+		float64(s.bytesDone+s.bytesSkipped)/(1<<20), float64(s.bytesTotal)/(1<<20),
+		progress["throughput_bps"].(float64)/(1<<20), eta)
+}
+
+// handleSyncRequest 处理同步请求
+// 先遍历生成文件列表，再以低优先级并行发送（每个Slave最多send_workers个流）
+// 进度按监控路径持久化，中断后再次请求时跳过已发送且之后未修改的文件
+func (m *Master) handleSyncRequest(slaveAddr string) error {
+	log.Printf("处理来自 %s 的全量同步请求", slaveAddr)
+	m.events.Publish(control.Event{Type: control.EventFullSync, Slave: slaveAddr, Message: "开始"})
+
+	session := m.startSyncSession(slaveAddr)
+
+	// 按目标记录文件清单，同步结束后发给Slave用于清理对应目录中的多余文件
+	manifests := make(map[string]*protocol.Manifest)
+	complete, matched := true, false
+
+	var plans []*syncPlan
+	for _, monitorPath := range m.getMonitorPaths() {
+		// 检查这个Slave是否在监控路径的目标列表中（备用Master同步所有监控路径）
+		if !m.isSlaveInPath(slaveAddr, monitorPath) && !m.isPeer(slaveAddr) {
+			continue
+		}
+		matched = true
+
+		plan, err := m.planSync(monitorPath, slaveAddr)
+		if err != nil {
+			log.Printf("遍历目录失败 %s: %v", monitorPath.Path, err)
+			complete = false
+			continue
+		}
+		plans = append(plans, plan)
+
+		manifest := manifests[monitorPath.Target]
+		if manifest == nil {
+			manifest = &protocol.Manifest{}
+			manifests[monitorPath.Target] = manifest
+		}
+		manifest.Filters = append(manifest.Filters, protocol.ManifestFilter{Include: monitorPath.Include, Exclude: monitorPath.Exclude})
+		manifest.Excluded = append(manifest.Excluded, plan.excluded...)
+
+		session.mutex.Lock()
+		for _, entry := range plan.entries {
+			if entry.dir {
+				manifest.Dirs = append(manifest.Dirs, entry.relPath)
+				continue
+			}
+			// 读取失败的文件也列入清单，避免Slave上的副本被删除
+			manifest.Files = append(manifest.Files, entry.relPath)
+			session.filesTotal++
+			session.bytesTotal += entry.size
+		}
+		session.mutex.Unlock()
+	}
+
+	// 定期保存进度文件并输出进度
+	stopProgress := make(chan struct{})
+	go func() {
+		saveTicker := time.NewTicker(syncCursorInterval)
+		logTicker := time.NewTicker(syncProgressLog)
+		defer saveTicker.Stop()
+		defer logTicker.Stop()
+		for {
+			select {
+			case <-saveTicker.C:
+				for _, plan := range plans {
+					plan.flush(session)
+				}
+			case <-logTicker.C:
+				session.logProgress()
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+
+	for _, plan := range plans {
+		m.runSyncPlan(session, plan)
+	}
+	close(stopProgress)
+
+	status := session.finish()
+	session.logProgress()
+
+	// 清单不完整时不发送，以免Slave误删文件
+	if matched && complete && status != syncCanceled {
+		if m.isPeer(slaveAddr) {
+			// 备用Master按监控路径分别清理
+			for _, plan := range plans {
+				if err := m.sendPathManifest(slaveAddr, plan); err != nil {
+					log.Printf("发送文件清单到备用Master失败 %s: %v", plan.monitorPath.Path, err)
+				}
+			}
+		} else {
+			for target, manifest := range manifests {
+				if err := m.sendManifest(slaveAddr, target, manifest); err != nil {
+					log.Printf("发送文件清单到Slave失败 %s: %v", slaveAddr, err)
+				}
+			}
+		}
+	}
+
+	switch status {
+	case syncCompleted:
+		log.Printf("完成向 %s 的全量同步", slaveAddr)
+	case syncIncomplete:
+		log.Printf("向 %s 的全量同步未完成，部分文件发送失败，再次请求时从中断处继续", slaveAddr)
+	case syncCanceled:
+		log.Printf("向 %s 的全量同步已取消", slaveAddr)
+	}
+	m.events.Publish(control.Event{Type: control.EventFullSync, Slave: slaveAddr, Message: status})
+	return nil
+}
+
+// planSync 遍历监控路径生成全量同步计划，并读取上次中断的进度
+func (m *Master) planSync(monitorPath config.MonitorPath, slaveAddr string) (*syncPlan, error) {
+	plan := &syncPlan{
+		monitorPath: monitorPath,
+		cursorFile:  syncCursorPath(m.config.StateDir, monitorPath.Path, slaveAddr),
+	}
+
+	err := m.walkFiltered(monitorPath, func(path, relPath string, info os.FileInfo) error {
+		entry := syncEntry{path: path, relPath: relPath, modTime: info.ModTime(), dir: info.IsDir()}
+		if !entry.dir {
+			entry.size = info.Size()
+		}
+		plan.entries = append(plan.entries, entry)
+		return nil
+	}, func(relPath string) {
+		plan.excluded = append(plan.excluded, relPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cursor, sent := loadSyncCursor(plan.cursorFile, monitorPath.Path, slaveAddr); cursor != nil {
+		plan.resume, plan.sent = cursor, sent
+		log.Printf("从上次中断处继续同步 %s -> %s: 上次已发送 %d 个文件 (%s)",
+			monitorPath.Path, slaveAddr, len(sent), cursor.Started.Format(time.RFC3339))
+	}
+	return plan, nil
+}
+
+// runSyncPlan 发送一个监控路径的所有条目并等待完成
+// 每个条目从读取到发送完成期间持有路径的发送锁，与同一路径的实时变更按顺序发送，先读取的内容不会覆盖较新的修改
+func (m *Master) runSyncPlan(session *syncSession, plan *syncPlan) {
+	monitorPath := plan.monitorPath
+	slaveAddr := session.slave
+	log.Printf("开始向 %s 同步路径: %s (%d 项)", slaveAddr, monitorPath.Path, len(plan.entries))
+	rep := m.getReplica(monitorPath.Path)
+	// 发送前钩子和双向同步需要完整的文件内容，不分块发送
+	chunked := rep == nil && len(monitorPath.PreSend) == 0
+
+	var wg sync.WaitGroup
+	submit := func(packet *protocol.SyncPacket, done func(ok bool)) {
+		if m.ha != nil {
+			packet.Source = monitorPath.Path
+		}
+		packet.Target = monitorPath.Target
+		m.sender.submitSkippable([]string{slaveAddr}, packet, priorityLow, session.stopped, func(failed []string) {
+			done(len(failed) == 0)
+		})
+	}
+	// sent 记录一个条目的发送结果并释放路径的发送锁
+	sent := func(entry syncEntry, ok bool, unlock func()) {
+		unlock()
+		if !ok {
+			session.abort()
+		}
+		if !entry.dir {
+			session.record(entry.size, ok)
+		}
+		plan.complete(entry, ok)
+		wg.Done()
+	}
+	// readFailed 读取失败不影响其他文件，只是同步不算完成，保留进度文件
+	readFailed := func(entry syncEntry, err error, unlock func()) {
+		unlock()
+		log.Printf("读取文件失败 %s: %v", entry.path, err)
+		session.record(0, false)
+		plan.complete(entry, false)
+	}
+
+	for _, entry := range plan.entries {
+		if session.stopped() {
+			break
+		}
+
+		// 上次已发送且大小和修改时间都未变化的文件不再发送
+		if prev, ok := plan.sent[entry.relPath]; !entry.dir && ok && prev.Size == entry.size && prev.ModTime == entry.modTime.UnixNano() {
+			session.skip(entry.size)
+			plan.skip()
+			continue
+		}
+
+		unlock := m.lockPath(filepath.Join(monitorPath.Path, filepath.FromSlash(entry.relPath)))
+
+		// 目录只同步结构（保证空目录也会创建）
+		if entry.dir {
+			dirPacket := protocol.NewSyncPacket("MKDIR", entry.relPath, nil)
+			if rep != nil {
+				rep.Annotate(dirPacket)
+			}
+			wg.Add(1)
+			submit(dirPacket, func(ok bool) { sent(entry, ok, unlock) })
+			continue
+		}
+
+		if chunked && entry.size > syncChunkSize {
+			wg.Add(1)
+			m.sendChunks(entry, submit, func(ok bool, err error) {
+				if err != nil {
+					readFailed(entry, err, unlock)
+					wg.Done()
+					return
+				}
+				sent(entry, ok, unlock)
+			})
+			continue
+		}
+
+		content, err := ioutil.ReadFile(entry.path)
+		if err != nil {
+			readFailed(entry, err, unlock)
+			continue
+		}
+
+		syncPacket := protocol.NewSyncPacket("CREATE", entry.relPath, content)
+		if rep != nil {
+			rep.Annotate(syncPacket)
+		}
+
+		// 被发送前钩子拒绝的文件不发送，但保留在清单中
+		if !m.checkPreSend(monitorPath, syncPacket) {
+			unlock()
+			session.skip(entry.size)
+			plan.skip()
+			continue
+		}
+
+		wg.Add(1)
+		submit(syncPacket, func(ok bool) { sent(entry, ok, unlock) })
+	}
+	wg.Wait()
+
+	plan.mutex.Lock()
+	defer plan.mutex.Unlock()
+	switch {
+	case session.isCanceled():
+		// 新的会话会读取进度文件，不再改写
+		plan.closeJournal()
+	case !plan.failed && plan.done == len(plan.entries):
+		plan.closeJournal()
+		os.Remove(plan.cursorFile)
+	default:
+		plan.saveCursor(session)
+		plan.closeJournal()
+	}
+}
+
+// sendChunks 将大文件按syncChunkSize分块发送，每块在加入发送队列前才读取，内存占用受发送缓冲上限限制
+// 所有分块处理完成后调用done：ok为是否全部发送成功，err为读取失败的原因（读取失败时不再发送剩余的分块）
+func (m *Master) sendChunks(entry syncEntry, submit func(*protocol.SyncPacket, func(bool)), done func(ok bool, err error)) {
+	file, err := os.Open(entry.path)
+	if err != nil {
+		done(false, err)
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		done(false, err)
+		return
+	}
+
+	// 按打开时的大小分块，之后的修改由实时变更在本次发送完成后发送
+	size, modTime := info.Size(), info.ModTime().UnixNano()
+	var mutex sync.Mutex
+	var readErr error
+	remaining, allOK := (size+syncChunkSize-1)/syncChunkSize, true
+	chunkDone := func(ok bool) {
+		mutex.Lock()
+		remaining--
+		allOK = allOK && ok
+		last, result, err := remaining == 0, allOK, readErr
+		mutex.Unlock()
+		if last {
+			file.Close()
+			done(result, err)
+		}
+	}
+
+	for offset := int64(0); offset < size; offset += syncChunkSize {
+		n := size - offset
+		if n > syncChunkSize {
+			n = syncChunkSize
+		}
+		content := make([]byte, n)
+		if _, err := file.ReadAt(content, offset); err != nil {
+			mutex.Lock()
+			readErr = err
+			mutex.Unlock()
+			for ; offset < size; offset += syncChunkSize {
+				chunkDone(false)
+			}
+			return
+		}
+
+		packet := protocol.NewSyncPacket("CREATE", entry.relPath, content)
+		packet.Offset, packet.Size, packet.ModTime = offset, size, modTime
+		submit(packet, chunkDone)
+	}
+}
+
+// complete 记录一个条目的发送结果，发送成功的文件等待写入进度文件
+func (plan *syncPlan) complete(entry syncEntry, ok bool) {
+	plan.mutex.Lock()
+	defer plan.mutex.Unlock()
+
+	if !ok {
+		plan.failed = true
+		return
+	}
+	plan.done++
+	if !entry.dir {
+		plan.pending = append(plan.pending, sentFile{Path: entry.relPath, Size: entry.size, ModTime: entry.modTime.UnixNano()})
+	}
+}
+
+// skip 记录一个无需发送的条目
+func (plan *syncPlan) skip() {
+	plan.mutex.Lock()
+	plan.done++
+	plan.mutex.Unlock()
+}
+
+// flush 将已发送的文件写入进度文件，会话被取代后不再改写
+func (plan *syncPlan) flush(session *syncSession) {
+	plan.mutex.Lock()
+	defer plan.mutex.Unlock()
+	if len(plan.pending) > 0 && !session.isCanceled() {
+		plan.saveCursor(session)
+	}
+}
+
+// saveCursor 将已发送的文件追加到进度文件，续传时在上次的进度文件后追加（调用时需持有plan.mutex）
+func (plan *syncPlan) saveCursor(session *syncSession) {
+	if len(plan.pending) == 0 {
+		return
+	}
+	if plan.journal == nil {
+		journal, err := plan.openJournal(session)
+		if err != nil {
+			log.Printf("保存同步进度失败: %v", err)
+			return
+		}
+		plan.journal = journal
+	}
+
+	writer := bufio.NewWriter(plan.journal)
+	encoder := json.NewEncoder(writer)
+	for i := range plan.pending {
+		if err := encoder.Encode(&plan.pending[i]); err != nil {
+			log.Printf("保存同步进度失败: %v", err)
+			return
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		log.Printf("保存同步进度失败: %v", err)
+		return
+	}
+	plan.pending = plan.pending[:0]
+}
+
+// openJournal 打开进度文件：续传时追加，否则新建并写入第一行
+func (plan *syncPlan) openJournal(session *syncSession) (*os.File, error) {
+	if plan.resume != nil {
+		if journal, err := os.OpenFile(plan.cursorFile, os.O_WRONLY|os.O_APPEND, 0); err == nil {
+			return journal, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(plan.cursorFile), 0755); err != nil {
+		return nil, fmt.Errorf("创建同步进度目录失败: %v", err)
+	}
+	journal, err := os.OpenFile(plan.cursorFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cursor := syncCursor{Slave: session.slave, Path: plan.monitorPath.Path, Started: session.started}
+	if err := json.NewEncoder(journal).Encode(&cursor); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	return journal, nil
+}
+
+// closeJournal 关闭进度文件（调用时需持有plan.mutex）
+func (plan *syncPlan) closeJournal() {
+	if plan.journal != nil {
+		plan.journal.Close()
+		plan.journal = nil
+	}
+}
+
+// syncCursorPath 获取Slave在监控路径的进度文件路径，位于节点的state_dir下
+func syncCursorPath(stateDir, root, slaveAddr string) string {
+	name := strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(slaveAddr)
+	sum := sha256.Sum256([]byte(filepath.Clean(root)))
+	return filepath.Join(stateDir, syncCursorDir, name+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadSyncCursor 读取进度文件和已发送的文件，不存在、属于其他Slave或监控路径、或已过期时返回nil
+func loadSyncCursor(path, root, slaveAddr string) (*syncCursor, map[string]sentFile) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil, nil
+	}
+	var cursor syncCursor
+	if err := json.Unmarshal(scanner.Bytes(), &cursor); err != nil {
+		log.Printf("解析同步进度失败 %s: %v", path, err)
+		return nil, nil
+	}
+	if cursor.Slave != slaveAddr || cursor.Path != root || time.Since(cursor.Started) > syncCursorMaxAge {
+		return nil, nil
+	}
+
+	sent := make(map[string]sentFile)
+	for scanner.Scan() {
+		var file sentFile
+		// 中断时可能只写入了半行，忽略
+		if err := json.Unmarshal(scanner.Bytes(), &file); err != nil {
+			continue
+		}
+		sent[file.Path] = file
+	}
+	return &cursor, sent
+}
+
+// getSyncStats 获取各Slave最近一次全量同步的进度
+func (m *Master) getSyncStats() map[string]interface{} {
+	m.mutex.RLock()
+	sessions := make([]*syncSession, 0, len(m.syncs))
+	for _, session := range m.syncs {
+		sessions = append(sessions, session)
+	}
+	m.mutex.RUnlock()
+
+	stats := make(map[string]interface{}, len(sessions))
+	for _, session := range sessions {
+		stats[session.slave] = session.progress()
+	}
+	return stats
+}
+
+// handleFullSyncs 列出各Slave最近一次全量同步的进度，status为completed表示Slave已就绪
+func (m *Master) handleFullSyncs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := m.getSyncStats()
+	if slave := r.URL.Query().Get("slave"); slave != "" {
+		progress, exists := stats[slave]
+		if !exists {
+			http.Error(w, "no full sync for slave", http.StatusNotFound)
+			return
+		}
+		webserver.WriteJSON(w, http.StatusOK, progress)
+		return
+	}
+	webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"syncs": stats})
+}
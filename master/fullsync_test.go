@@ -0,0 +1,143 @@
+package master
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"xsync/config"
+)
+
+func TestSyncCursorPath(t *testing.T) {
+	base := syncCursorPath("state", "/data", "10.0.0.1:9000")
+	if dir := filepath.Dir(base); dir != filepath.Join("state", syncCursorDir) {
+		t.Errorf("进度文件目录 = %s", dir)
+	}
+	if name := filepath.Base(base); strings.ContainsAny(name, ":/\\") || !strings.HasPrefix(name, "10.0.0.1_9000-") {
+		t.Errorf("进度文件名 = %s", name)
+	}
+
+	tests := []struct {
+		root, slave string
+		same        bool
+	}{
+		{"/data/", "10.0.0.1:9000", true},
+		{"/data/./", "10.0.0.1:9000", true},
+		{"/data2", "10.0.0.1:9000", false},
+		{"/data", "10.0.0.2:9000", false},
+	}
+	for _, tt := range tests {
+		if got := syncCursorPath("state", tt.root, tt.slave); (got == base) != tt.same {
+			t.Errorf("syncCursorPath(%q, %q) = %s, 与 %s 相同应为 %v", tt.root, tt.slave, got, base, tt.same)
+		}
+	}
+}
+
+func TestSyncCursorJournal(t *testing.T) {
+	const slave = "10.0.0.1:9000"
+	root := "/data"
+	cursorFile := syncCursorPath(t.TempDir(), root, slave)
+	started := time.Now().Add(-time.Hour).Round(0)
+	modTime := time.Unix(1700000000, 0)
+
+	// 第一次同步发送两个文件后中断
+	session := &syncSession{slave: slave, started: started}
+	plan := &syncPlan{monitorPath: config.MonitorPath{Path: root}, cursorFile: cursorFile}
+	plan.complete(syncEntry{relPath: "a.txt", size: 1, modTime: modTime}, true)
+	plan.complete(syncEntry{relPath: "dir", dir: true}, true)
+	plan.complete(syncEntry{relPath: "b.txt", size: 2, modTime: modTime}, false)
+	plan.flush(session)
+	plan.complete(syncEntry{relPath: "c.txt", size: 3, modTime: modTime}, true)
+	plan.flush(session)
+	plan.closeJournal()
+
+	cursor, sent := loadSyncCursor(cursorFile, root, slave)
+	if cursor == nil || cursor.Slave != slave || !cursor.Started.Equal(started) {
+		t.Fatalf("读取进度失败: %+v", cursor)
+	}
+	want := map[string]sentFile{
+		"a.txt": {Path: "a.txt", Size: 1, ModTime: modTime.UnixNano()},
+		"c.txt": {Path: "c.txt", Size: 3, ModTime: modTime.UnixNano()},
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("已发送的文件 = %+v, 期望 %+v", sent, want)
+	}
+
+	// 续传时在原进度文件后追加，半行记录被忽略
+	f, err := os.OpenFile(cursorFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"path":"half`)
+	f.WriteString("\n")
+	f.Close()
+
+	resumed := &syncPlan{monitorPath: config.MonitorPath{Path: root}, cursorFile: cursorFile, resume: cursor, sent: sent}
+	resumed.complete(syncEntry{relPath: "b.txt", size: 2, modTime: modTime}, true)
+	resumed.flush(&syncSession{slave: slave, started: time.Now()})
+	resumed.closeJournal()
+
+	cursor, sent = loadSyncCursor(cursorFile, root, slave)
+	if cursor == nil || !cursor.Started.Equal(started) {
+		t.Fatalf("续传应保留原来的开始时间: %+v", cursor)
+	}
+	if len(sent) != 3 || sent["b.txt"].Size != 2 {
+		t.Errorf("续传后已发送的文件 = %+v", sent)
+	}
+
+	// 会话被取代后不再写入
+	canceled := &syncSession{slave: slave, started: started, canceled: true}
+	plan = &syncPlan{monitorPath: config.MonitorPath{Path: root}, cursorFile: cursorFile, resume: cursor}
+	plan.complete(syncEntry{relPath: "d.txt", size: 4, modTime: modTime}, true)
+	plan.flush(canceled)
+	plan.closeJournal()
+	if _, sent = loadSyncCursor(cursorFile, root, slave); len(sent) != 3 {
+		t.Errorf("已取消的会话不应写入进度: %+v", sent)
+	}
+}
+
+func TestLoadSyncCursorMismatch(t *testing.T) {
+	const slave = "10.0.0.1:9000"
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		slave   string
+		root    string
+	}{
+		{"文件不存在", "", slave, "/data"},
+		{"格式错误", "not json\n", slave, "/data"},
+		{"其他Slave", cursorLine(t, "10.0.0.2:9000", "/data", time.Now()), slave, "/data"},
+		{"其他监控路径", cursorLine(t, slave, "/other", time.Now()), slave, "/data"},
+		{"已过期", cursorLine(t, slave, "/data", time.Now().Add(-syncCursorMaxAge-time.Hour)), slave, "/data"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.Repeat("x", i+1)+".json")
+			if tt.content != "" {
+				if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if cursor, sent := loadSyncCursor(path, tt.root, tt.slave); cursor != nil || sent != nil {
+				t.Errorf("loadSyncCursor = %+v, %+v, 期望 nil", cursor, sent)
+			}
+		})
+	}
+}
+
+// cursorLine 生成进度文件的第一行
+func cursorLine(t *testing.T, slave, root string, started time.Time) string {
+	data, err := json.Marshal(syncCursor{Slave: slave, Path: root, Started: started})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
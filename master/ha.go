@@ -0,0 +1,643 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xsync/config"
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+	"xsync/webserver"
+)
+
+// haState 主备模式的状态
+// 两个Master互发HA_HEARTBEAT，同一时间只有主Master（active）监控文件并发送变更，
+// 同时把变更作为日志发给备用Master；主Master失联超过ha_timeout后备用Master以更大的任期接管
+type haState struct {
+	mutex      sync.Mutex
+	active     bool
+	epoch      uint64    // 已知的最大任期，主Master发送的数据包都携带该任期
+	since      time.Time // 进入当前角色的时间
+	peerID     string
+	peerEpoch  uint64
+	peerActive bool
+	peerSeen   time.Time
+	synced     uint64    // 已向对端请求追赶的任期
+	fencedAt   time.Time // 因FENCE转为备用的时间，之后收到对端心跳前不再自动接管
+	takeovers  int64
+	fences     int64 // 收到的FENCE数量
+
+	sending int32 // 正在发送心跳，避免对端不可达时堆积
+}
+
+// haFile 持久化的主备状态
+type haFile struct {
+	Epoch   uint64    `json:"epoch"`
+	Updated time.Time `json:"updated"`
+}
+
+// newHAState 读取持久化的任期，以备用身份创建主备状态，未启用主备时返回nil
+func newHAState(cfg *config.Config) (*haState, error) {
+	if cfg.HAPeer == "" {
+		return nil, nil
+	}
+
+	h := &haState{since: time.Now()}
+	data, err := ioutil.ReadFile(cfg.HAStateFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取主备状态文件失败: %v", err)
+	}
+	if err == nil {
+		var state haFile
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("解析主备状态文件失败: %v", err)
+		}
+		h.epoch = state.Epoch
+	}
+	return h, nil
+}
+
+// saveHAState 保存任期（先写临时文件再替换）
+func saveHAState(path string, epoch uint64) error {
+	data, err := json.MarshalIndent(haFile{Epoch: epoch, Updated: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// isActive 判断本节点是否为主Master（未启用主备时始终为true）
+func (m *Master) isActive() bool {
+	if m.ha == nil {
+		return true
+	}
+	m.ha.mutex.Lock()
+	defer m.ha.mutex.Unlock()
+	return m.ha.active
+}
+
+// isPeer 判断地址是否为主备模式的对端Master
+func (m *Master) isPeer(addr string) bool {
+	return m.ha != nil && addr == m.config.HAPeer
+}
+
+// withPeer 主Master把变更同时发给备用Master，返回包含对端的目标列表
+// 数据包标记所属监控路径，备用Master据此写入对应目录
+func (m *Master) withPeer(addrs []string, packet *protocol.SyncPacket, monitorPath config.MonitorPath) []string {
+	if m.ha == nil {
+		return addrs
+	}
+	packet.Source = monitorPath.Path
+	if !m.isActive() {
+		return addrs
+	}
+	return append(append([]string{}, addrs...), m.config.HAPeer)
+}
+
+// startHA 以备用身份启动主备模式
+// 首次启动的主Master等待两个心跳间隔，备用Master和曾经接管过的Master（重启后对端可能已接管）等待ha_timeout，
+// 期间未收到对端主Master的心跳则接管
+func (m *Master) startHA() {
+	m.ha.mutex.Lock()
+	epoch := m.ha.epoch
+	m.ha.mutex.Unlock()
+
+	timeout := m.config.HATimeout.Duration()
+	interval := timeout / 3
+	wait := 2 * interval
+	if m.config.HAStandby || epoch > 0 {
+		wait = timeout
+	}
+
+	m.transport.SetEpoch(epoch)
+	log.Printf("启用主备模式: 对端 %s，任期 %d，%s 后未发现主Master则接管", m.config.HAPeer, epoch, wait)
+
+	go m.runHA(interval, timeout, time.Now().Add(wait))
+}
+
+// runHA 定期向对端发送心跳，备用时检测主Master是否失联
+func (m *Master) runHA(interval, timeout time.Duration, deadline time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	m.sendHAHeartbeat()
+	for {
+		select {
+		case <-ticker.C:
+			m.sendHAHeartbeat()
+			if m.isActive() || time.Now().Before(deadline) {
+				continue
+			}
+			// 对端在线但还未接管时由主Master（未配置ha_standby的一方）接管
+			m.ha.mutex.Lock()
+			seen, peerActive, fencedAt := m.ha.peerSeen, m.ha.peerActive, m.ha.fencedAt
+			m.ha.mutex.Unlock()
+			alive := !seen.IsZero() && time.Since(seen) < timeout
+			if alive && (peerActive || m.config.HAStandby) {
+				continue
+			}
+			// 被Slave拒绝说明另有主Master在服务，只是与本节点之间不通，避免两端轮流接管
+			if !fencedAt.IsZero() && seen.Before(fencedAt) {
+				continue
+			}
+			if seen.IsZero() {
+				log.Printf("未收到对端Master %s 的心跳，接管为主Master", m.config.HAPeer)
+			} else {
+				log.Printf("对端Master %s 不是主Master或已失联 (最近心跳 %s)，接管为主Master", m.config.HAPeer, seen.Format(time.RFC3339))
+			}
+			m.takeover()
+
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// sendHAHeartbeat 向对端发送心跳（后台发送，上一次未完成时跳过）
+func (m *Master) sendHAHeartbeat() {
+	if !atomic.CompareAndSwapInt32(&m.ha.sending, 0, 1) {
+		return
+	}
+
+	m.ha.mutex.Lock()
+	heartbeat := protocol.HAHeartbeat{NodeID: m.config.NodeID, Epoch: m.ha.epoch, Active: m.ha.active, Time: time.Now()}
+	m.ha.mutex.Unlock()
+
+	packet, err := protocol.NewReportPacket("HA_HEARTBEAT", m.config.NodeID, heartbeat)
+	if err != nil {
+		atomic.StoreInt32(&m.ha.sending, 0)
+		log.Printf("创建主备心跳失败: %v", err)
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&m.ha.sending, 0)
+		if err := m.transport.Send(m.config.HAPeer, packet); err != nil {
+			log.Printf("发送主备心跳到 %s 失败: %v", m.config.HAPeer, err)
+		}
+	}()
+}
+
+// takeover 以新的任期接管为主Master：启动文件监控并通知所有Slave
+func (m *Master) takeover() {
+	m.ha.mutex.Lock()
+	epoch := m.ha.epoch
+	if m.ha.peerEpoch > epoch {
+		epoch = m.ha.peerEpoch
+	}
+	epoch++
+	if err := saveHAState(m.config.HAStateFile, epoch); err != nil {
+		m.ha.mutex.Unlock()
+		log.Printf("保存任期失败，放弃接管: %v", err)
+		return
+	}
+	m.ha.active = true
+	m.ha.epoch = epoch
+	m.ha.since = time.Now()
+	m.ha.takeovers++
+	m.ha.mutex.Unlock()
+
+	m.transport.SetEpoch(epoch)
+	log.Printf("已接管为主Master，任期 %d", epoch)
+	m.events.Publish(control.Event{Type: control.EventHA, Message: fmt.Sprintf("已接管为主Master，任期 %d", epoch)})
+
+	m.startWatchers()
+	m.sendHAHeartbeat()
+	m.announce(epoch)
+}
+
+// announce 向所有Slave发送携带新任期的心跳，Slave收到后跟随本节点并重新全量同步
+// 发送失败的Slave每个心跳间隔重试，直到成功或本节点不再是该任期的主Master
+func (m *Master) announce(epoch uint64) {
+	interval := m.config.HATimeout.Duration() / 3
+	for _, slaveAddr := range m.allSlaves() {
+		go func(slaveAddr string) {
+			for {
+				m.ha.mutex.Lock()
+				current := m.ha.active && m.ha.epoch == epoch
+				m.ha.mutex.Unlock()
+				if !current {
+					return
+				}
+
+				heartbeat := protocol.NewSyncPacket("HEARTBEAT", m.config.NodeID, nil)
+				err := m.transport.Send(slaveAddr, heartbeat)
+				if err == nil {
+					log.Printf("已通知Slave %s 新任期 %d", slaveAddr, epoch)
+					return
+				}
+				log.Printf("通知Slave %s 新任期失败: %v", slaveAddr, err)
+
+				select {
+				case <-time.After(interval):
+				case <-m.done:
+					return
+				}
+			}
+		}(slaveAddr)
+	}
+}
+
+// allSlaves 获取所有监控路径的Slave地址（去除重复）
+func (m *Master) allSlaves() []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, monitorPath := range m.getMonitorPaths() {
+		for _, slaveAddr := range monitorPath.Slaves {
+			if !seen[slaveAddr] {
+				seen[slaveAddr] = true
+				addrs = append(addrs, slaveAddr)
+			}
+		}
+	}
+	return addrs
+}
+
+// demote 转为备用Master：停止文件监控，之后只接收对端的变更
+func (m *Master) demote(reason string) {
+	m.ha.mutex.Lock()
+	if !m.ha.active {
+		m.ha.mutex.Unlock()
+		return
+	}
+	m.ha.active = false
+	m.ha.since = time.Now()
+	m.ha.synced = 0
+	m.ha.mutex.Unlock()
+
+	log.Printf("转为备用Master: %s", reason)
+	m.events.Publish(control.Event{Type: control.EventHA, Message: "转为备用Master: " + reason})
+	m.stopWatchers()
+
+	// 停止正在进行的全量同步，Slave会向新的主Master重新请求
+	m.mutex.RLock()
+	for _, session := range m.syncs {
+		session.mutex.Lock()
+		if session.status == syncRunning {
+			session.canceled = true
+		}
+		session.mutex.Unlock()
+	}
+	m.mutex.RUnlock()
+}
+
+// raiseEpoch 记录更大的任期，之后发给对端的数据包携带该任期
+func (m *Master) raiseEpoch(epoch uint64) {
+	m.ha.mutex.Lock()
+	defer m.ha.mutex.Unlock()
+	if epoch <= m.ha.epoch {
+		return
+	}
+	if err := saveHAState(m.config.HAStateFile, epoch); err != nil {
+		log.Printf("保存任期失败: %v", err)
+	}
+	m.ha.epoch = epoch
+	m.transport.SetEpoch(epoch)
+}
+
+// startWatchers 为每个监控路径启动文件监控器
+func (m *Master) startWatchers() {
+	for _, monitorPath := range m.getMonitorPaths() {
+		if err := m.startWatcher(monitorPath); err != nil {
+			log.Printf("启动文件监控失败 %s: %v", monitorPath.Path, err)
+			continue
+		}
+	}
+}
+
+// stopWatchers 停止所有文件监控器
+func (m *Master) stopWatchers() {
+	m.mutex.RLock()
+	paths := make([]string, 0, len(m.watchers))
+	for path := range m.watchers {
+		paths = append(paths, path)
+	}
+	m.mutex.RUnlock()
+
+	for _, path := range paths {
+		m.stopWatcher(path)
+	}
+}
+
+// handleHAPacket 主备模式下的数据包处理，返回true表示数据包已处理
+// 备用Master只接收对端发来的变更；主Master拒绝任期过期的对端数据
+func (m *Master) handleHAPacket(packet *protocol.SyncPacket, remoteAddr string) (bool, error) {
+	switch packet.Op {
+	case "HA_HEARTBEAT":
+		return true, m.handleHAHeartbeat(packet, remoteAddr)
+	case "FENCE":
+		return true, m.handleFence(packet, remoteAddr)
+	}
+
+	m.ha.mutex.Lock()
+	active, epoch := m.ha.active, m.ha.epoch
+	m.ha.mutex.Unlock()
+
+	if !m.isPeer(remoteAddr) || packet.Epoch == 0 {
+		// 备用Master忽略Slave的心跳和同步请求
+		return !active, nil
+	}
+	if packet.Epoch < epoch {
+		log.Printf("拒绝对端Master的过期数据包: %s %s (任期 %d < %d)", packet.Op, packet.Path, packet.Epoch, epoch)
+		go m.sendFence(remoteAddr, epoch)
+		return true, nil
+	}
+	if packet.Epoch > epoch {
+		m.demote(fmt.Sprintf("对端Master的任期 %d 大于本节点的任期 %d", packet.Epoch, epoch))
+		m.raiseEpoch(packet.Epoch)
+		active = false
+	}
+	if active {
+		return false, nil
+	}
+	if packet.Source == "" {
+		return true, nil
+	}
+	return true, m.applyJournal(packet)
+}
+
+// handleHAHeartbeat 处理对端Master的心跳
+// 两端都是主Master时任期小的一方让出，任期相同时node_id大的一方让出
+func (m *Master) handleHAHeartbeat(packet *protocol.SyncPacket, remoteAddr string) error {
+	if !m.isPeer(remoteAddr) {
+		return fmt.Errorf("忽略非对端Master的主备心跳: %s", remoteAddr)
+	}
+
+	var heartbeat protocol.HAHeartbeat
+	if err := packet.DecodeReport(&heartbeat); err != nil {
+		return err
+	}
+
+	m.ha.mutex.Lock()
+	if !m.ha.peerActive && heartbeat.Active {
+		log.Printf("对端Master %s 是主Master，任期 %d", remoteAddr, heartbeat.Epoch)
+	}
+	m.ha.peerID = heartbeat.NodeID
+	m.ha.peerEpoch = heartbeat.Epoch
+	m.ha.peerActive = heartbeat.Active
+	m.ha.peerSeen = time.Now()
+	active, epoch := m.ha.active, m.ha.epoch
+	m.ha.mutex.Unlock()
+
+	if !heartbeat.Active {
+		return nil
+	}
+	if active {
+		yield := heartbeat.Epoch > epoch || (heartbeat.Epoch == epoch && m.config.NodeID > heartbeat.NodeID)
+		if !yield {
+			log.Printf("对端Master %s 的任期 %d 已过期，通知其转为备用", remoteAddr, heartbeat.Epoch)
+			go m.sendFence(remoteAddr, epoch)
+			return nil
+		}
+		m.demote(fmt.Sprintf("对端Master %s 是任期 %d 的主Master", remoteAddr, heartbeat.Epoch))
+	}
+	m.raiseEpoch(heartbeat.Epoch)
+	m.catchUp(heartbeat.Epoch)
+	return nil
+}
+
+// catchUp 向对端主Master请求全量同步，补齐备用期间缺失的变更（每个任期一次）
+func (m *Master) catchUp(epoch uint64) {
+	m.ha.mutex.Lock()
+	if m.ha.active || m.ha.synced == epoch {
+		m.ha.mutex.Unlock()
+		return
+	}
+	m.ha.synced = epoch
+	m.ha.mutex.Unlock()
+
+	go func() {
+		log.Printf("向主Master %s 请求全量同步 (任期 %d)", m.config.HAPeer, epoch)
+		request := protocol.NewSyncPacket("SYNC_REQUEST", m.config.NodeID, nil)
+		if err := m.transport.Send(m.config.HAPeer, request); err != nil {
+			log.Printf("向主Master请求全量同步失败: %v", err)
+			m.ha.mutex.Lock()
+			if m.ha.synced == epoch {
+				m.ha.synced = 0
+			}
+			m.ha.mutex.Unlock()
+		}
+	}()
+}
+
+// handleFence 处理Slave或对端Master发来的FENCE：存在更大的任期或同一任期的另一个主Master时转为备用
+func (m *Master) handleFence(packet *protocol.SyncPacket, remoteAddr string) error {
+	var fence protocol.Fence
+	if err := packet.DecodeReport(&fence); err != nil {
+		return err
+	}
+
+	m.ha.mutex.Lock()
+	m.ha.fences++
+	active, epoch := m.ha.active, m.ha.epoch
+	m.ha.mutex.Unlock()
+
+	// 任期相同说明对方已跟随同一任期的另一个Master
+	if fence.Epoch < epoch || (fence.Epoch == epoch && !active) {
+		return nil
+	}
+	log.Printf("%s(%s) 拒绝了本节点的数据包: 其任期 %d，本节点任期 %d，当前主Master为 %s", remoteAddr, fence.NodeID, fence.Epoch, epoch, fence.Master)
+	m.demote(fmt.Sprintf("任期 %d 已被取代，重新收到对端Master的心跳前不再自动接管", epoch))
+	m.raiseEpoch(fence.Epoch)
+
+	m.ha.mutex.Lock()
+	m.ha.fencedAt = time.Now()
+	m.ha.mutex.Unlock()
+	return nil
+}
+
+// sendFence 通知过期的对端Master当前任期
+func (m *Master) sendFence(addr string, epoch uint64) {
+	fence := protocol.Fence{NodeID: m.config.NodeID, Epoch: epoch, Master: m.config.NodeID}
+	packet, err := protocol.NewReportPacket("FENCE", m.config.NodeID, fence)
+	if err != nil {
+		log.Printf("创建FENCE数据包失败: %v", err)
+		return
+	}
+	if err := m.transport.Send(addr, packet); err != nil {
+		log.Printf("发送FENCE到 %s 失败: %v", addr, err)
+	}
+}
+
+// applyJournal 备用Master应用主Master发来的变更
+func (m *Master) applyJournal(packet *protocol.SyncPacket) error {
+	monitorPath, exists := m.getMonitorPath(packet.Source)
+	if !exists {
+		return fmt.Errorf("主Master发来的变更不属于任何监控路径: %s", packet.Source)
+	}
+	if packet.Op == "MANIFEST" {
+		return m.applyJournalManifest(monitorPath, packet)
+	}
+
+	relPath, err := protocol.CleanPath(packet.Path)
+	if err != nil {
+		return err
+	}
+	fullPath := filepath.Join(monitorPath.Path, filepath.FromSlash(relPath))
+
+	switch packet.Op {
+	case "CREATE", "MODIFY":
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		if err := writeJournalFile(monitorPath.Path, fullPath, packet.Content); err != nil {
+			return fmt.Errorf("写入文件失败 %s: %v", fullPath, err)
+		}
+	case "MKDIR":
+		if err := os.MkdirAll(fullPath, 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+	case "DELETE":
+		if err := os.RemoveAll(fullPath); err != nil {
+			return fmt.Errorf("删除文件失败 %s: %v", fullPath, err)
+		}
+	default:
+		return nil
+	}
+	log.Printf("已应用主Master的变更: %s %s (%s)", packet.Op, relPath, monitorPath.Path)
+	return nil
+}
+
+// writeJournalFile 先写入元数据目录下的临时文件再替换目标文件
+// 临时文件不在监控范围内，不会被同时进行的清单清理删除
+func writeJournalFile(root, fullPath string, content []byte) error {
+	tmpDir := filepath.Join(root, watcher.MetaDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(tmpDir, "journal-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+// applyJournalManifest 备用Master删除主Master上已不存在的文件和目录
+func (m *Master) applyJournalManifest(monitorPath config.MonitorPath, packet *protocol.SyncPacket) error {
+	var manifest protocol.Manifest
+	if err := packet.DecodeReport(&manifest); err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(manifest.Files)+len(manifest.Dirs))
+	for _, path := range manifest.Files {
+		keep[path] = true
+	}
+	for _, path := range manifest.Dirs {
+		keep[path] = true
+	}
+
+	var extra []string
+	err := m.walkMonitorPath(monitorPath, func(path, relPath string, info os.FileInfo) error {
+		if keep[relPath] {
+			return nil
+		}
+		extra = append(extra, path)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("遍历目录失败: %v", err)
+	}
+
+	for _, path := range extra {
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("删除多余文件失败 %s: %v", path, err)
+		}
+	}
+	log.Printf("已按主Master的文件清单清理 %s: 删除 %d 项", monitorPath.Path, len(extra))
+	return nil
+}
+
+// sendPathManifest 向备用Master发送单个监控路径的文件清单
+func (m *Master) sendPathManifest(peerAddr string, plan *syncPlan) error {
+	manifest := &protocol.Manifest{}
+	for _, entry := range plan.entries {
+		if entry.dir {
+			manifest.Dirs = append(manifest.Dirs, entry.relPath)
+		} else {
+			manifest.Files = append(manifest.Files, entry.relPath)
+		}
+	}
+	packet, err := protocol.NewReportPacket("MANIFEST", m.config.NodeID, manifest)
+	if err != nil {
+		return err
+	}
+	packet.Source = plan.monitorPath.Path
+	return m.transport.Send(peerAddr, packet)
+}
+
+// getHAStats 获取主备状态，未启用时返回nil
+func (m *Master) getHAStats() map[string]interface{} {
+	if m.ha == nil {
+		return nil
+	}
+	m.ha.mutex.Lock()
+	defer m.ha.mutex.Unlock()
+
+	role := "standby"
+	if m.ha.active {
+		role = "active"
+	}
+	stats := map[string]interface{}{
+		"role":        role,
+		"epoch":       m.ha.epoch,
+		"since":       m.ha.since.Format(time.RFC3339),
+		"peer":        m.config.HAPeer,
+		"peer_id":     m.ha.peerID,
+		"peer_active": m.ha.peerActive,
+		"peer_epoch":  m.ha.peerEpoch,
+		"takeovers":   m.ha.takeovers,
+		"fences":      m.ha.fences,
+	}
+	if !m.ha.peerSeen.IsZero() {
+		stats["peer_seen"] = m.ha.peerSeen.Format(time.RFC3339)
+	}
+	return stats
+}
+
+// handleHA 查看主备状态
+func (m *Master) handleHA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := m.getHAStats()
+	if stats == nil {
+		stats = map[string]interface{}{"enabled": false}
+	} else {
+		stats["enabled"] = true
+	}
+	webserver.WriteJSON(w, http.StatusOK, stats)
+}
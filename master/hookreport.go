@@ -0,0 +1,61 @@
+package master
+
+import (
+	"log"
+	"time"
+
+	"xsync/control"
+	"xsync/protocol"
+)
+
+// maxHookRecords 保留的最近钩子失败报告数量
+const maxHookRecords = 50
+
+// hookRecord 一条Slave钩子失败报告
+type hookRecord struct {
+	Time     time.Time `json:"time"`
+	Slave    string    `json:"slave"`
+	NodeID   string    `json:"node_id"`
+	Hook     string    `json:"hook"`
+	Paths    []string  `json:"paths"`
+	Total    int       `json:"total"`
+	Error    string    `json:"error"`
+	Output   string    `json:"output"`
+	Duration int64     `json:"duration_ms"`
+}
+
+// handleHookReport 记录Slave报告的同步后钩子执行失败
+func (m *Master) handleHookReport(packet *protocol.SyncPacket, slaveAddr string) error {
+	var report protocol.HookReport
+	if err := packet.DecodeReport(&report); err != nil {
+		return err
+	}
+
+	log.Printf("Slave %s(%s) 钩子执行失败: %s (%d 个变更): %s", slaveAddr, report.NodeID, report.Hook, report.Total, report.Error)
+	m.stats.recordHookFailure(hookRecord{
+		Time:     report.Time,
+		Slave:    slaveAddr,
+		NodeID:   report.NodeID,
+		Hook:     report.Hook,
+		Paths:    report.Paths,
+		Total:    report.Total,
+		Error:    report.Error,
+		Output:   report.Output,
+		Duration: report.Duration,
+	})
+	m.events.Publish(control.Event{Type: control.EventHookFailed, Path: report.Hook, Slave: slaveAddr, Message: report.Error})
+	return nil
+}
+
+// recordHookFailure 记录钩子失败报告
+func (s *MasterStats) recordHookFailure(record hookRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.HookFailures++
+	s.SlaveHookFailures[record.Slave]++
+	s.RecentHookFailures = append(s.RecentHookFailures, record)
+	if len(s.RecentHookFailures) > maxHookRecords {
+		s.RecentHookFailures = s.RecentHookFailures[len(s.RecentHookFailures)-maxHookRecords:]
+	}
+}
@@ -2,103 +2,160 @@ package master
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
 
+	"xsync/config"
+	"xsync/control"
 	"xsync/protocol"
+	"xsync/replica"
 	"xsync/transport"
 	"xsync/watcher"
 	"xsync/webserver"
 )
 
-// Config 配置结构（从main包导入的类型定义）
-type Config struct {
-	NodeID       string        `yaml:"node_id"`
-	Role         string        `yaml:"role"`
-	Key          string        `yaml:"key"`
-	UDPPort      int           `yaml:"udp_port"`
-	MonitorPaths []MonitorPath `yaml:"monitor_paths"`
-	MasterAddr   string        `yaml:"master_addr"`
-	SyncPath     string        `yaml:"sync_path"`
-	WebServer    *WebConfig    `yaml:"web_server"`
-}
-
-// WebConfig Web服务配置
-type WebConfig struct {
-	Enabled   bool   `yaml:"enabled"`
-	Port      int    `yaml:"port"`
-	Username  string `yaml:"username"`
-	Password  string `yaml:"password"`
-	UploadDir string `yaml:"upload_dir"`
-}
-
-// MonitorPath Master监控路径配置
-type MonitorPath struct {
-	Path   string   `yaml:"path"`
-	Slaves []string `yaml:"slaves"`
-}
-
-// IsMaster 判断是否为Master节点
-func (c *Config) IsMaster() bool {
-	return c.Role == "master"
-}
-
-// IsSlave 判断是否为Slave节点
-func (c *Config) IsSlave() bool {
-	return c.Role == "slave"
+// watcherChanged 判断两个监控路径配置的监控器设置是否不同
+func watcherChanged(a, b config.MonitorPath) bool {
+	return !reflect.DeepEqual(a.FilterConfig(), b.FilterConfig()) ||
+		a.WatchMode != b.WatchMode || a.PollInterval != b.PollInterval || a.PollHash != b.PollHash ||
+		a.DebounceMs != b.DebounceMs || a.MaxDelayMs != b.MaxDelayMs ||
+		a.StableChecks != b.StableChecks || a.StableIntervalMs != b.StableIntervalMs ||
+		a.Bidirectional != b.Bidirectional || a.ConflictPolicy != b.ConflictPolicy ||
+		a.Batch != b.Batch || a.Target != b.Target
 }
 
 // Master 主节点
 type Master struct {
-	config    *Config
+	config    *config.Config
 	transport transport.Transport
 	watchers  map[string]*watcher.FileWatcher
+	replicas  map[string]*replica.Replica
+	preSend   map[string]*preSendEntry
 	webServer *webserver.WebServer
+	sender    *sendPool
+	syncs     map[string]*syncSession
+	ha        *haState
 	mutex     sync.RWMutex
 	done      chan bool
+	stats     *MasterStats
+	pathLocks map[string]*pathLock
+	lockMutex sync.Mutex
+	paused    map[string]*pausedPath // 监控路径 -> 暂停期间收集的变更
+	queries   *queryTable
+	events    *control.Publisher // 发布到本地控制接口的事件，为nil时不发布
+}
+
+// pathLock 单个路径的发送锁，保证同一路径的事件按顺序发送
+type pathLock struct {
+	busy    bool
+	waiters []chan struct{} // 阻塞等待的调用方（双向同步的远程变更）
+	queued  *queuedEvent    // 路径正在发送时排队的本地事件，只保留最新一次
+}
+
+// queuedEvent 等待上一次发送完成的文件事件
+type queuedEvent struct {
+	event       *watcher.FileEvent
+	monitorPath config.MonitorPath
+	changed     bool
+}
+
+// MasterStats 主节点统计信息
+type MasterStats struct {
+	ProcessedEvents int64
+	SentPackets     int64
+	FailedSends     int64
+	LastEvent       time.Time
+	SlaveFailures   map[string]int64
+	DriftReports    int64
+	SlaveDrifts     map[string]int64
+	RecentDrifts    []driftRecord
+
+	HookFailures       int64
+	SlaveHookFailures  map[string]int64
+	RecentHookFailures []hookRecord
+
+	Rejected         int64
+	RecentRejections []rejectRecord
+
+	Batches int64
+
+	Relays map[string]*relayRecord // 中继节点ID -> 最近一次报告
+
+	SlaveSeen  map[string]time.Time // Slave地址 -> 最近收到心跳或请求的时间
+	SlaveNodes map[string]string    // Slave地址 -> 节点ID
+
+	mutex sync.Mutex
 }
 
 // NewMaster 创建Master节点
-func NewMaster(cfg *Config) (*Master, error) {
+func NewMaster(cfg *config.Config) (*Master, error) {
+	return NewMasterWithTransport(cfg, transport.NewQUICTransport([]byte(cfg.Key)))
+}
+
+// NewMasterWithTransport 使用指定的传输层创建Master节点（多个同步组共用一个端口时使用）
+func NewMasterWithTransport(cfg *config.Config, transport transport.Transport) (*Master, error) {
 	if !cfg.IsMaster() {
 		return nil, fmt.Errorf("配置不是Master节点")
 	}
 
-	// 创建传输层
-	transport := transport.NewQUICTransport([]byte(cfg.Key))
-
 	m := &Master{
 		config:    cfg,
 		transport: transport,
 		watchers:  make(map[string]*watcher.FileWatcher),
+		replicas:  make(map[string]*replica.Replica),
+		preSend:   make(map[string]*preSendEntry),
+		syncs:     make(map[string]*syncSession),
 		done:      make(chan bool),
+		stats: &MasterStats{
+			SlaveFailures:     make(map[string]int64),
+			SlaveDrifts:       make(map[string]int64),
+			SlaveHookFailures: make(map[string]int64),
+			Relays:            make(map[string]*relayRecord),
+			SlaveSeen:         make(map[string]time.Time),
+			SlaveNodes:        make(map[string]string),
+		},
+		pathLocks: make(map[string]*pathLock),
+		paused:    make(map[string]*pausedPath),
+		queries:   newQueryTable(),
+	}
+	m.sender = newSendPool(m.sendToSlave, cfg.SendWorkers, cfg.SendBufferMB)
+
+	// 启用主备模式时读取持久化的任期
+	ha, err := newHAState(cfg)
+	if err != nil {
+		return nil, err
 	}
+	m.ha = ha
 
 	// 如果启用了Web服务，创建Web服务器
-	if cfg.WebServer != nil && cfg.WebServer.Enabled {
-		// 转换WebConfig类型
-		webCfg := &webserver.WebConfig{
-			Enabled:   cfg.WebServer.Enabled,
-			Port:      cfg.WebServer.Port,
-			Username:  cfg.WebServer.Username,
-			Password:  cfg.WebServer.Password,
-			UploadDir: cfg.WebServer.UploadDir,
-		}
-		ws, err := webserver.NewWebServer(webCfg)
-		if err != nil {
-			return nil, fmt.Errorf("创建Web服务器失败: %v", err)
-		}
-		m.webServer = ws
+	ws, err := m.newWebServer(cfg.WebServer)
+	if err != nil {
+		return nil, err
 	}
+	m.webServer = ws
 
 	return m, nil
 }
 
+// newWebServer 根据配置创建Web服务器并注册接口，未启用时返回nil
+func (m *Master) newWebServer(cfg *config.WebConfig) (*webserver.WebServer, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	ws, err := webserver.NewWebServer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建Web服务器失败: %v", err)
+	}
+	m.registerWebHandlers(ws)
+	return ws, nil
+}
+
 // Start 启动Master节点
 func (m *Master) Start() error {
 	log.Printf("启动Master节点: %s", m.config.NodeID)
@@ -109,37 +166,49 @@ func (m *Master) Start() error {
 	}
 
 	// 启动Web服务器（如果启用）
-	if m.webServer != nil {
-		if err := m.webServer.Start(); err != nil {
+	if ws := m.getWebServer(); ws != nil {
+		if err := ws.Start(); err != nil {
 			return fmt.Errorf("启动Web服务器失败: %v", err)
 		}
 	}
 
-	// 为每个监控路径创建文件监控器
-	for _, monitorPath := range m.config.MonitorPaths {
-		if err := m.startWatcher(monitorPath); err != nil {
-			log.Printf("启动文件监控失败 %s: %v", monitorPath.Path, err)
-			continue
-		}
+	// 为每个监控路径创建文件监控器，主备模式下接管为主Master后才开始监控
+	if m.ha != nil {
+		m.startHA()
+	} else {
+		m.startWatchers()
 	}
 
 	log.Printf("Master节点启动完成，监听端口: %d", m.config.UDPPort)
-	if m.webServer != nil {
-		log.Printf("Web服务器已启动，端口: %d", m.webServer.GetPort())
+	if ws := m.getWebServer(); ws != nil {
+		log.Printf("Web服务器已启动，端口: %d", ws.GetPort())
 	}
 	return nil
 }
 
 // startWatcher 启动文件监控器
-func (m *Master) startWatcher(monitorPath MonitorPath) error {
+func (m *Master) startWatcher(monitorPath config.MonitorPath) error {
 	// 检查路径是否存在
 	if _, err := os.Stat(monitorPath.Path); os.IsNotExist(err) {
 		return fmt.Errorf("监控路径不存在: %s", monitorPath.Path)
 	}
 
-	// 创建文件监控器（5秒防抖动）
-	fw, err := watcher.NewFileWatcher(monitorPath.Path, 5000)
+	filter, err := watcher.NewFilter(monitorPath.Path, monitorPath.FilterConfig())
+	if err != nil {
+		return fmt.Errorf("创建文件过滤器失败: %v", err)
+	}
+
+	// 双向同步需要先建立版本信息，再开始监控
+	if monitorPath.Bidirectional {
+		if err := m.openReplica(monitorPath); err != nil {
+			return err
+		}
+	}
+
+	// 创建文件监控器
+	fw, err := watcher.NewFileWatcherWithOptions(monitorPath.Path, monitorPath.WatcherOptions(filter))
 	if err != nil {
+		m.closeReplica(monitorPath.Path)
 		return fmt.Errorf("创建文件监控器失败: %v", err)
 	}
 
@@ -151,22 +220,33 @@ func (m *Master) startWatcher(monitorPath MonitorPath) error {
 	m.watchers[monitorPath.Path] = fw
 	m.mutex.Unlock()
 
-	log.Printf("启动文件监控: %s -> %v", monitorPath.Path, monitorPath.Slaves)
+	log.Printf("启动文件监控(%s): %s -> %v", fw.GetBackend(), monitorPath.Path, monitorPath.Slaves)
 
 	// 处理文件事件
-	go m.handleFileEvents(fw, monitorPath)
+	if monitorPath.Batch {
+		go m.handleBatchEvents(fw, monitorPath)
+	} else {
+		go m.handleFileEvents(fw, monitorPath)
+	}
 
 	return nil
 }
 
 // handleFileEvents 处理文件事件
-func (m *Master) handleFileEvents(fw *watcher.FileWatcher, monitorPath MonitorPath) {
+func (m *Master) handleFileEvents(fw *watcher.FileWatcher, monitorPath config.MonitorPath) {
 	for {
 		select {
 		case event, ok := <-fw.GetEventChan():
 			if !ok {
 				return
 			}
+			// 使用最新配置（热加载可能修改了Slave列表）
+			if current, exists := m.getMonitorPath(monitorPath.Path); exists {
+				monitorPath = current
+			}
+			if m.holdEvent(event, monitorPath) {
+				continue
+			}
 			m.processFileEvent(event, monitorPath)
 
 		case <-m.done:
@@ -176,43 +256,164 @@ func (m *Master) handleFileEvents(fw *watcher.FileWatcher, monitorPath MonitorPa
 }
 
 // processFileEvent 处理单个文件事件
-func (m *Master) processFileEvent(event *watcher.FileEvent, monitorPath MonitorPath) {
+func (m *Master) processFileEvent(event *watcher.FileEvent, monitorPath config.MonitorPath) {
+	m.dispatchEvent(event, monitorPath, true)
+}
+
+// dispatchEvent 将文件事件加入监控路径所有Slave的发送队列
+// changed表示本地新发生的变更（双向模式下递增版本，优先发送），全量同步时只附加当前版本
+func (m *Master) dispatchEvent(event *watcher.FileEvent, monitorPath config.MonitorPath, changed bool) {
 	log.Printf("处理文件事件: %s %s", event.Op, event.Path)
+	m.stats.recordEvent()
+	if changed {
+		m.events.Publish(control.Event{Type: control.EventChange, Op: event.Op, Path: filepath.Join(monitorPath.Path, event.Path)})
+	}
+
+	// 同一路径的上一个事件仍在发送时（超时后仍在后台发送的也算）排队等待，避免乱序，且不阻塞其他路径的事件
+	unlock := m.queuePath(filepath.Join(monitorPath.Path, event.Path), &queuedEvent{event: event, monitorPath: monitorPath, changed: changed})
+	if unlock == nil {
+		log.Printf("上一次发送尚未完成，排队等待: %s %s", event.Op, event.Path)
+		return
+	}
+	m.sendEvent(event, monitorPath, changed, unlock)
+}
 
+// sendEvent 创建同步包并加入发送队列，发送完成后调用unlock释放路径
+func (m *Master) sendEvent(event *watcher.FileEvent, monitorPath config.MonitorPath, changed bool, unlock func()) {
 	// 创建同步包
 	syncPacket, err := watcher.CreateSyncPacket(event, monitorPath.Path)
 	if err != nil {
+		unlock()
 		log.Printf("创建同步包失败: %v", err)
 		return
 	}
 
-	// 发送到所有Slave节点
-	var wg sync.WaitGroup
+	if rep := m.getReplica(monitorPath.Path); rep != nil {
+		if !changed {
+			rep.Annotate(syncPacket)
+		} else if !rep.PrepareLocal(syncPacket) {
+			unlock()
+			log.Printf("忽略远程变更引起的本地事件: %s %s", event.Op, event.Path)
+			return
+		}
+	}
+
+	if !m.checkPreSend(monitorPath, syncPacket) {
+		unlock()
+		return
+	}
+
+	priority := priorityHigh
+	if !changed {
+		priority = priorityLow
+	}
+	m.broadcast(monitorPath, syncPacket, "", priority, unlock)
+}
+
+// broadcast 将数据包加入监控路径所有Slave（跳过exclude）的发送队列，全部发送完成后调用done
+// 发送缓冲已满时阻塞，直到有数据包发送完成
+func (m *Master) broadcast(monitorPath config.MonitorPath, syncPacket *protocol.SyncPacket, exclude string, priority int, done func()) {
+	var addrs []string
 	for _, slaveAddr := range monitorPath.Slaves {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
-			m.sendToSlave(addr, syncPacket)
-		}(slaveAddr)
+		if slaveAddr != exclude {
+			addrs = append(addrs, slaveAddr)
+		}
+	}
+	addrs = m.withPeer(addrs, syncPacket, monitorPath)
+	syncPacket.Target = monitorPath.Target
+
+	m.sender.submit(addrs, syncPacket, priority, func(failed []string) {
+		done()
+		if len(failed) > 0 {
+			log.Printf("文件事件发送失败: %s %s -> %v", syncPacket.Op, syncPacket.Path, failed)
+		} else {
+			log.Printf("文件事件处理完成: %s %s", syncPacket.Op, syncPacket.Path)
+		}
+		// 全量同步的发送量大，只发布实时变更的结果
+		if priority != priorityHigh {
+			return
+		}
+		path := filepath.Join(monitorPath.Path, filepath.FromSlash(syncPacket.Path))
+		if len(failed) > 0 {
+			m.events.Publish(control.Event{Type: control.EventSendFailed, Op: syncPacket.Op, Path: path, Slave: strings.Join(failed, ",")})
+		} else {
+			m.events.Publish(control.Event{Type: control.EventSent, Op: syncPacket.Op, Path: path})
+		}
+	})
+}
+
+// lockPath 获取路径的发送锁，路径正在发送时阻塞等待，返回释放函数
+func (m *Master) lockPath(path string) func() {
+	m.lockMutex.Lock()
+	lock := m.getPathLock(path)
+	if !lock.busy {
+		lock.busy = true
+		m.lockMutex.Unlock()
+		return func() { m.unlockPath(path, lock) }
+	}
+	wait := make(chan struct{})
+	lock.waiters = append(lock.waiters, wait)
+	m.lockMutex.Unlock()
+
+	<-wait
+	return func() { m.unlockPath(path, lock) }
+}
+
+// queuePath 获取路径的发送锁，路径正在发送时不等待：记录事件并返回nil，释放时再发送
+// 排队期间同一路径的多次变更只保留最新一次（发往各次变更的Slave的并集），发送时按文件的最新状态创建同步包
+func (m *Master) queuePath(path string, queued *queuedEvent) func() {
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
+
+	lock := m.getPathLock(path)
+	if !lock.busy {
+		lock.busy = true
+		return func() { m.unlockPath(path, lock) }
+	}
+	// 被替换的事件可能发往其他Slave（如新增Slave的全量同步只发往新Slave），合并两者的Slave列表
+	if prev := lock.queued; prev != nil {
+		queued.changed = queued.changed || prev.changed
+		if extra := diffSlaves(queued.monitorPath.Slaves, prev.monitorPath.Slaves); len(extra) > 0 {
+			slaves := make([]string, 0, len(queued.monitorPath.Slaves)+len(extra))
+			slaves = append(slaves, queued.monitorPath.Slaves...)
+			queued.monitorPath.Slaves = append(slaves, extra...)
+		}
 	}
+	lock.queued = queued
+	return nil
+}
+
+// getPathLock 获取或创建路径的发送锁，调用方需持有lockMutex
+func (m *Master) getPathLock(path string) *pathLock {
+	lock, exists := m.pathLocks[path]
+	if !exists {
+		lock = &pathLock{}
+		m.pathLocks[path] = lock
+	}
+	return lock
+}
 
-	// 等待所有发送完成（最多等待10秒）
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
+// unlockPath 释放路径的发送锁：依次交给阻塞等待的调用方、排队的事件，都没有时删除
+func (m *Master) unlockPath(path string, lock *pathLock) {
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
 
-	select {
-	case <-done:
-		log.Printf("文件事件处理完成: %s %s", event.Op, event.Path)
-	case <-time.After(10 * time.Second):
-		log.Printf("文件事件处理超时: %s %s", event.Op, event.Path)
+	if len(lock.waiters) > 0 {
+		close(lock.waiters[0])
+		lock.waiters = lock.waiters[1:]
+		return
+	}
+	if queued := lock.queued; queued != nil {
+		lock.queued = nil
+		// 在发送完成的回调中调用，发送缓冲已满时会阻塞，放到单独的goroutine
+		go m.sendEvent(queued.event, queued.monitorPath, queued.changed, func() { m.unlockPath(path, lock) })
+		return
 	}
+	delete(m.pathLocks, path)
 }
 
-// sendToSlave 发送数据包到Slave节点
-func (m *Master) sendToSlave(slaveAddr string, syncPacket *protocol.SyncPacket) {
+// sendToSlave 发送数据包到Slave节点，返回是否发送成功
+func (m *Master) sendToSlave(slaveAddr string, syncPacket *protocol.SyncPacket) bool {
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
 		if err := m.transport.Send(slaveAddr, syncPacket); err != nil {
@@ -223,18 +424,69 @@ func (m *Master) sendToSlave(slaveAddr string, syncPacket *protocol.SyncPacket)
 			continue
 		}
 		log.Printf("成功发送到Slave: %s", slaveAddr)
-		return
+		m.stats.recordSend(slaveAddr, nil)
+		return true
 	}
 	log.Printf("发送到Slave最终失败: %s", slaveAddr)
+	m.stats.recordSend(slaveAddr, fmt.Errorf("发送失败"))
+	return false
+}
+
+// recordEvent 记录已处理的文件事件
+func (s *MasterStats) recordEvent() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ProcessedEvents++
+	s.LastEvent = time.Now()
+}
+
+// recordSend 记录发送结果
+func (s *MasterStats) recordSend(slaveAddr string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		s.FailedSends++
+		s.SlaveFailures[slaveAddr]++
+		return
+	}
+	s.SentPackets++
+}
+
+// recordSeen 记录收到Slave数据包的时间，心跳和同步请求的路径为Slave的节点ID
+func (s *MasterStats) recordSeen(slaveAddr string, packet *protocol.SyncPacket) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.SlaveSeen[slaveAddr] = time.Now()
+	if packet.Op == "HEARTBEAT" || packet.Op == "SYNC_REQUEST" {
+		s.SlaveNodes[slaveAddr] = packet.Path
+	}
 }
 
 // handlePacket 处理接收到的数据包（如心跳等）
 func (m *Master) handlePacket(packet *protocol.SyncPacket, remoteAddr string) error {
 	log.Printf("Master收到数据包: %s %s from %s", packet.Op, packet.Path, remoteAddr)
-	
+
+	if m.ha != nil {
+		if handled, err := m.handleHAPacket(packet, transport.ReplyAddr(packet, remoteAddr)); handled {
+			return err
+		}
+	}
+
+	m.stats.recordSeen(transport.ReplyAddr(packet, remoteAddr), packet)
+
 	switch packet.Op {
 	case "SYNC_REQUEST":
-		return m.handleSyncRequest(remoteAddr)
+		return m.handleSyncRequest(transport.ReplyAddr(packet, remoteAddr))
+	case "CREATE", "MODIFY", "DELETE", "MKDIR":
+		return m.handleRemoteChange(packet, transport.ReplyAddr(packet, remoteAddr))
+	case "DRIFT":
+		return m.handleDriftReport(packet, transport.ReplyAddr(packet, remoteAddr))
+	case "HOOK_REPORT":
+		return m.handleHookReport(packet, transport.ReplyAddr(packet, remoteAddr))
+	case "RELAY_REPORT":
+		return m.handleRelayReport(packet, transport.ReplyAddr(packet, remoteAddr))
+	case "QUERY_REPLY":
+		return m.handleQueryReply(packet)
 	case "HEARTBEAT":
 		// 心跳包，记录日志即可
 		log.Printf("收到来自 %s 的心跳", remoteAddr)
@@ -245,70 +497,108 @@ func (m *Master) handlePacket(packet *protocol.SyncPacket, remoteAddr string) er
 	}
 }
 
-// handleSyncRequest 处理同步请求
-func (m *Master) handleSyncRequest(slaveAddr string) error {
-	log.Printf("处理来自 %s 的全量同步请求", slaveAddr)
-	
-	// 为每个监控路径发送所有文件
-	for _, monitorPath := range m.config.MonitorPaths {
-		// 检查这个Slave是否在监控路径的目标列表中
-		if !m.isSlaveInPath(slaveAddr, monitorPath) {
+// handleRemoteChange 处理双向同步中Slave发来的文件变更：应用到监控路径并转发给其他Slave
+func (m *Master) handleRemoteChange(packet *protocol.SyncPacket, slaveAddr string) error {
+	monitorPath, rep := m.findReplica(slaveAddr)
+	if rep == nil {
+		return fmt.Errorf("拒绝来自 %s 的文件变更: 该Slave所在的监控路径未启用双向同步", slaveAddr)
+	}
+
+	unlock := m.lockPath(filepath.Join(monitorPath.Path, packet.Path))
+
+	result, err := rep.Apply(packet)
+	if err != nil {
+		unlock()
+		return fmt.Errorf("应用来自 %s 的变更失败: %v", slaveAddr, err)
+	}
+
+	switch {
+	case result.Applied:
+		log.Printf("已应用来自 %s 的变更: %s %s", slaveAddr, packet.Op, packet.Path)
+		m.broadcast(monitorPath, packet, slaveAddr, priorityHigh, unlock)
+	case result.Reply != nil:
+		// 本地版本胜出，发给包括发起方在内的所有Slave
+		m.broadcast(monitorPath, result.Reply, "", priorityHigh, unlock)
+	default:
+		unlock()
+	}
+	return nil
+}
+
+// findReplica 查找Slave所在的双向同步监控路径（同一Slave属于多个路径时使用第一个）
+func (m *Master) findReplica(slaveAddr string) (config.MonitorPath, *replica.Replica) {
+	for _, monitorPath := range m.getMonitorPaths() {
+		if !monitorPath.Bidirectional || !m.isSlaveInPath(slaveAddr, monitorPath) {
 			continue
 		}
-		
-		log.Printf("开始向 %s 同步路径: %s", slaveAddr, monitorPath.Path)
-		
-		// 遍历目录并发送所有文件
-		err := filepath.Walk(monitorPath.Path, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			
-			// 跳过目录
-			if info.IsDir() {
-				return nil
-			}
-			
-			// 获取相对路径
-			relPath, err := filepath.Rel(monitorPath.Path, path)
-			if err != nil {
-				return err
-			}
-			
-			// 统一使用正斜杠
-			relPath = strings.ReplaceAll(relPath, "\\", "/")
-			
-			// 读取文件内容
-			content, err := ioutil.ReadFile(path)
-			if err != nil {
-				log.Printf("读取文件失败 %s: %v", path, err)
-				return nil // 继续处理其他文件
-			}
-			
-			// 创建同步包
-			syncPacket := protocol.NewSyncPacket("CREATE", relPath, content)
-			
-			// 发送到Slave
-			if err := m.transport.Send(slaveAddr, syncPacket); err != nil {
-				log.Printf("发送文件到Slave失败 %s -> %s: %v", relPath, slaveAddr, err)
-			} else {
-				log.Printf("已发送文件到Slave: %s -> %s (%d bytes)", relPath, slaveAddr, len(content))
-			}
-			
-			return nil
-		})
-		
-		if err != nil {
-			log.Printf("遍历目录失败 %s: %v", monitorPath.Path, err)
+		if rep := m.getReplica(monitorPath.Path); rep != nil {
+			return monitorPath, rep
+		}
+	}
+	return config.MonitorPath{}, nil
+}
+
+// openReplica 打开监控路径的版本信息，并为已有文件建立初始版本
+func (m *Master) openReplica(monitorPath config.MonitorPath) error {
+	rep, err := replica.Open(monitorPath.Path, m.config.NodeID, monitorPath.ConflictPolicy, true)
+	if err != nil {
+		return fmt.Errorf("打开版本信息失败: %v", err)
+	}
+
+	tracked := 0
+	err = m.walkMonitorPath(monitorPath, func(path, relPath string, info os.FileInfo) error {
+		if !info.IsDir() && rep.Track(relPath) {
+			tracked++
 		}
+		return nil
+	})
+	if err != nil {
+		rep.Close()
+		return fmt.Errorf("遍历目录失败: %v", err)
 	}
-	
-	log.Printf("完成向 %s 的全量同步", slaveAddr)
+
+	m.mutex.Lock()
+	m.replicas[monitorPath.Path] = rep
+	m.mutex.Unlock()
+
+	log.Printf("启用双向同步: %s (新建版本 %d 个)", monitorPath.Path, tracked)
 	return nil
 }
 
+// closeReplica 保存并关闭监控路径的版本信息
+func (m *Master) closeReplica(path string) {
+	m.mutex.Lock()
+	rep, exists := m.replicas[path]
+	delete(m.replicas, path)
+	m.mutex.Unlock()
+
+	if exists {
+		if err := rep.Close(); err != nil {
+			log.Printf("保存版本信息失败 %s: %v", path, err)
+		}
+	}
+}
+
+// getReplica 获取监控路径的版本信息，未启用双向同步时返回nil
+func (m *Master) getReplica(path string) *replica.Replica {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.replicas[path]
+}
+
+// sendManifest 发送全量同步的文件清单，target为清单对应的目标名称
+func (m *Master) sendManifest(slaveAddr, target string, manifest *protocol.Manifest) error {
+	packet, err := protocol.NewReportPacket("MANIFEST", m.config.NodeID, manifest)
+	if err != nil {
+		return err
+	}
+	packet.Target = target
+	log.Printf("发送文件清单到 %s: %d 个文件, %d 个目录", slaveAddr, len(manifest.Files), len(manifest.Dirs))
+	return m.transport.Send(slaveAddr, packet)
+}
+
 // isSlaveInPath 检查Slave是否在监控路径的目标列表中
-func (m *Master) isSlaveInPath(slaveAddr string, monitorPath MonitorPath) bool {
+func (m *Master) isSlaveInPath(slaveAddr string, monitorPath config.MonitorPath) bool {
 	for _, slave := range monitorPath.Slaves {
 		if slave == slaveAddr {
 			return true
@@ -323,6 +613,7 @@ func (m *Master) Stop() error {
 
 	// 发送停止信号
 	close(m.done)
+	m.sender.close()
 
 	// 停止所有文件监控器
 	m.mutex.Lock()
@@ -332,9 +623,14 @@ func (m *Master) Stop() error {
 	}
 	m.mutex.Unlock()
 
+	// 保存版本信息
+	for _, monitorPath := range m.getMonitorPaths() {
+		m.closeReplica(monitorPath.Path)
+	}
+
 	// 停止Web服务器（如果启用）
-	if m.webServer != nil {
-		if err := m.webServer.Stop(); err != nil {
+	if ws := m.getWebServer(); ws != nil {
+		if err := ws.Stop(); err != nil {
 			log.Printf("停止Web服务器失败: %v", err)
 		} else {
 			log.Printf("Web服务器已停止")
@@ -356,21 +652,339 @@ func (m *Master) GetStats() map[string]interface{} {
 	defer m.mutex.RUnlock()
 
 	stats := map[string]interface{}{
-		"node_id":        m.config.NodeID,
-		"role":           "master",
-		"monitor_paths":  len(m.config.MonitorPaths),
+		"node_id":         m.config.NodeID,
+		"role":            "master",
+		"monitor_paths":   len(m.config.MonitorPaths),
 		"active_watchers": len(m.watchers),
-		"uptime":         time.Now().Format(time.RFC3339),
+		"uptime":          time.Now().Format(time.RFC3339),
+	}
+
+	return stats
+}
+
+// GetDetailedStats 获取详细统计信息（SIGUSR1时输出）
+func (m *Master) GetDetailedStats() map[string]interface{} {
+	stats := m.GetStats()
+
+	m.mutex.RLock()
+	watchers := make(map[string]interface{}, len(m.watchers))
+	for path, fw := range m.watchers {
+		watchers[path] = fw.GetStats()
+	}
+	paths := make(map[string][]string, len(m.config.MonitorPaths))
+	for _, monitorPath := range m.config.MonitorPaths {
+		paths[monitorPath.Path] = monitorPath.Slaves
+	}
+	replicas := make(map[string]interface{}, len(m.replicas))
+	for path, rep := range m.replicas {
+		replicas[path] = rep.GetStats()
+	}
+	m.mutex.RUnlock()
+
+	m.stats.mutex.Lock()
+	failures := make(map[string]int64, len(m.stats.SlaveFailures))
+	for addr, count := range m.stats.SlaveFailures {
+		failures[addr] = count
+	}
+	stats["processed_events"] = m.stats.ProcessedEvents
+	stats["sent_packets"] = m.stats.SentPackets
+	stats["failed_sends"] = m.stats.FailedSends
+	stats["last_event"] = m.stats.LastEvent.Format(time.RFC3339)
+	if m.stats.DriftReports > 0 {
+		drifts := make(map[string]int64, len(m.stats.SlaveDrifts))
+		for addr, count := range m.stats.SlaveDrifts {
+			drifts[addr] = count
+		}
+		stats["drift_reports"] = m.stats.DriftReports
+		stats["slave_drifts"] = drifts
+		stats["recent_drifts"] = append([]driftRecord(nil), m.stats.RecentDrifts...)
+	}
+	if m.stats.HookFailures > 0 {
+		hookFailures := make(map[string]int64, len(m.stats.SlaveHookFailures))
+		for addr, count := range m.stats.SlaveHookFailures {
+			hookFailures[addr] = count
+		}
+		stats["hook_failures"] = m.stats.HookFailures
+		stats["slave_hook_failures"] = hookFailures
+		stats["recent_hook_failures"] = append([]hookRecord(nil), m.stats.RecentHookFailures...)
+	}
+	if m.stats.Batches > 0 {
+		stats["batches"] = m.stats.Batches
+	}
+	if m.stats.Rejected > 0 {
+		stats["rejected"] = m.stats.Rejected
+		stats["recent_rejections"] = append([]rejectRecord(nil), m.stats.RecentRejections...)
+	}
+	m.stats.mutex.Unlock()
+
+	stats["slave_failures"] = failures
+	stats["watchers"] = watchers
+	stats["send_pool"] = m.sender.getStats()
+	stats["full_syncs"] = m.getSyncStats()
+	if ha := m.getHAStats(); ha != nil {
+		stats["ha"] = ha
+	}
+	if relays := m.getRelayStats(); len(relays) > 0 {
+		stats["relays"] = relays
+	}
+	stats["paths"] = paths
+	if len(replicas) > 0 {
+		stats["replicas"] = replicas
+	}
+	if ws := m.getWebServer(); ws != nil {
+		stats["web_port"] = ws.GetPort()
 	}
 
 	return stats
 }
 
+// getMonitorPaths 获取当前监控路径列表的副本
+func (m *Master) getMonitorPaths() []config.MonitorPath {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	paths := make([]config.MonitorPath, len(m.config.MonitorPaths))
+	copy(paths, m.config.MonitorPaths)
+	return paths
+}
+
+// getMonitorPath 按路径查找当前的监控路径配置
+func (m *Master) getMonitorPath(path string) (config.MonitorPath, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, monitorPath := range m.config.MonitorPaths {
+		if monitorPath.Path == path {
+			return monitorPath, true
+		}
+	}
+	return config.MonitorPath{}, false
+}
+
+// Reload 热加载配置
+// 对比新旧配置，增删文件监控器、更新Slave列表、密钥和Web服务，正在进行的发送不受影响
+func (m *Master) Reload(cfg *config.Config) error {
+	if !cfg.IsMaster() {
+		return fmt.Errorf("配置不是Master节点")
+	}
+
+	m.mutex.RLock()
+	oldCfg := m.config
+	m.mutex.RUnlock()
+
+	if cfg.NodeID != oldCfg.NodeID {
+		return fmt.Errorf("node_id不支持热加载: %s -> %s", oldCfg.NodeID, cfg.NodeID)
+	}
+	if cfg.UDPPort != oldCfg.UDPPort {
+		log.Printf("udp_port变更需要重启才能生效: %d -> %d", oldCfg.UDPPort, cfg.UDPPort)
+		cfg.UDPPort = oldCfg.UDPPort
+	}
+	if cfg.HAPeer != oldCfg.HAPeer || cfg.HAStandby != oldCfg.HAStandby ||
+		cfg.HATimeout != oldCfg.HATimeout || cfg.HAStateFile != oldCfg.HAStateFile {
+		log.Printf("ha_peer/ha_standby/ha_timeout/ha_state_file变更需要重启才能生效")
+		cfg.HAPeer, cfg.HAStandby = oldCfg.HAPeer, oldCfg.HAStandby
+		cfg.HATimeout, cfg.HAStateFile = oldCfg.HATimeout, oldCfg.HAStateFile
+	}
+	if cfg.StateDir != oldCfg.StateDir {
+		log.Printf("state_dir变更需要重启才能生效: %s -> %s", oldCfg.StateDir, cfg.StateDir)
+		cfg.StateDir = oldCfg.StateDir
+	}
+
+	// 先准备新的Web服务器，失败时不改动任何配置
+	webChanged := !oldCfg.WebServer.Equal(cfg.WebServer)
+	var ws *webserver.WebServer
+	if webChanged {
+		var err error
+		if ws, err = m.prepareWebServer(oldCfg.WebServer, cfg.WebServer); err != nil {
+			return err
+		}
+	}
+
+	oldPaths := make(map[string]config.MonitorPath, len(oldCfg.MonitorPaths))
+	for _, monitorPath := range oldCfg.MonitorPaths {
+		oldPaths[monitorPath.Path] = monitorPath
+	}
+	newPaths := make(map[string]config.MonitorPath, len(cfg.MonitorPaths))
+	for _, monitorPath := range cfg.MonitorPaths {
+		newPaths[monitorPath.Path] = monitorPath
+	}
+
+	// 校验通过后在锁内统一生效：密钥、发送参数、Web服务器和配置，之后的事件处理使用新的Slave列表
+	m.mutex.Lock()
+	if cfg.Key != oldCfg.Key {
+		m.transport.SetKey([]byte(cfg.Key))
+		log.Printf("加密密钥已更新")
+	}
+	m.sender.configure(cfg.SendWorkers, cfg.SendBufferMB)
+	var oldWeb *webserver.WebServer
+	if webChanged {
+		oldWeb = m.webServer
+		m.webServer = ws
+	}
+	m.config = cfg
+	m.mutex.Unlock()
+
+	if oldWeb != nil {
+		if err := oldWeb.Stop(); err != nil {
+			log.Printf("停止Web服务器失败: %v", err)
+		}
+	}
+	if webChanged {
+		if ws != nil {
+			log.Printf("Web服务器已重启，端口: %d", ws.GetPort())
+		} else {
+			log.Printf("Web服务器已关闭")
+		}
+	}
+
+	// 备用Master不监控文件，接管时按新配置启动
+	if !m.isActive() {
+		log.Printf("Master配置热加载完成（备用Master）")
+		return nil
+	}
+
+	// 停止已移除路径的监控器
+	for path := range oldPaths {
+		if _, exists := newPaths[path]; exists {
+			continue
+		}
+		m.stopWatcher(path)
+	}
+
+	// 启动新增路径的监控器，并向新增的Slave同步已有文件
+	for path, monitorPath := range newPaths {
+		oldPath, exists := oldPaths[path]
+		if !exists {
+			if err := m.startWatcher(monitorPath); err != nil {
+				log.Printf("启动文件监控失败 %s: %v", path, err)
+				continue
+			}
+			go m.syncToNewSlaves(monitorPath, monitorPath.Slaves)
+			continue
+		}
+
+		// 过滤规则或监控方式变化时重建监控器
+		if watcherChanged(oldPath, monitorPath) {
+			log.Printf("监控路径 %s 监控设置已变更，重建文件监控器", path)
+			m.stopWatcher(path)
+			if err := m.startWatcher(monitorPath); err != nil {
+				log.Printf("启动文件监控失败 %s: %v", path, err)
+			}
+		}
+
+		// 目标变化后Slave写入新的目录，重新发送该路径的所有文件
+		if oldPath.Target != monitorPath.Target {
+			log.Printf("监控路径 %s 目标已变更: %q -> %q", path, oldPath.Target, monitorPath.Target)
+			go m.syncToNewSlaves(monitorPath, monitorPath.Slaves)
+			continue
+		}
+
+		if added := diffSlaves(oldPath.Slaves, monitorPath.Slaves); len(added) > 0 {
+			log.Printf("监控路径 %s 新增Slave: %v", path, added)
+			go m.syncToNewSlaves(monitorPath, added)
+		}
+		if removed := diffSlaves(monitorPath.Slaves, oldPath.Slaves); len(removed) > 0 {
+			log.Printf("监控路径 %s 移除Slave: %v", path, removed)
+		}
+	}
+
+	log.Printf("Master配置热加载完成")
+	return nil
+}
+
+// stopWatcher 停止并移除指定路径的文件监控器
+func (m *Master) stopWatcher(path string) {
+	m.mutex.Lock()
+	fw, exists := m.watchers[path]
+	delete(m.watchers, path)
+	delete(m.preSend, path)
+	m.mutex.Unlock()
+
+	if exists {
+		fw.Stop()
+		log.Printf("停止文件监控: %s", path)
+	}
+	m.closeReplica(path)
+}
+
+// prepareWebServer 按新配置创建并启动Web服务器，未启用时返回nil，此时尚未替换当前的Web服务器
+// 新旧端口相同时需先停止旧服务器，新服务器启动失败则按旧配置恢复
+func (m *Master) prepareWebServer(oldCfg, cfg *config.WebConfig) (*webserver.WebServer, error) {
+	ws, err := m.newWebServer(cfg)
+	if err != nil || ws == nil {
+		return nil, err
+	}
+
+	current := m.getWebServer()
+	if current == nil || current.GetPort() != ws.GetPort() {
+		if err := ws.Start(); err != nil {
+			return nil, fmt.Errorf("启动Web服务器失败: %v", err)
+		}
+		return ws, nil
+	}
+
+	if err := current.Stop(); err != nil {
+		log.Printf("停止Web服务器失败: %v", err)
+	}
+	if err := ws.Start(); err != nil {
+		if old, rerr := m.newWebServer(oldCfg); rerr != nil {
+			log.Printf("恢复Web服务器失败: %v", rerr)
+		} else if old != nil {
+			if rerr := old.Start(); rerr != nil {
+				log.Printf("恢复Web服务器失败: %v", rerr)
+			} else {
+				m.mutex.Lock()
+				m.webServer = old
+				m.mutex.Unlock()
+			}
+		}
+		return nil, fmt.Errorf("启动Web服务器失败: %v", err)
+	}
+	return ws, nil
+}
+
+// getWebServer 获取当前的Web服务器
+func (m *Master) getWebServer() *webserver.WebServer {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.webServer
+}
+
+// syncToNewSlaves 向新加入的Slave同步监控路径下的已有文件
+func (m *Master) syncToNewSlaves(monitorPath config.MonitorPath, slaves []string) {
+	target := monitorPath
+	target.Slaves = slaves
+	if err := m.syncDirectoryToSlaves(target); err != nil {
+		log.Printf("同步目录到新增Slave失败 %s: %v", monitorPath.Path, err)
+	}
+}
+
+// diffSlaves 返回在b中但不在a中的Slave地址
+func diffSlaves(a, b []string) []string {
+	existing := make(map[string]bool, len(a))
+	for _, addr := range a {
+		existing[addr] = true
+	}
+
+	var result []string
+	for _, addr := range b {
+		if !existing[addr] {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
 // SyncInitialFiles 同步初始文件（启动时）
 func (m *Master) SyncInitialFiles() error {
+	// 主备模式下由接管流程通知Slave全量同步
+	if m.ha != nil {
+		return nil
+	}
+
 	log.Printf("开始同步初始文件...")
 
-	for _, monitorPath := range m.config.MonitorPaths {
+	for _, monitorPath := range m.getMonitorPaths() {
 		if err := m.syncDirectoryToSlaves(monitorPath); err != nil {
 			log.Printf("同步目录失败 %s: %v", monitorPath.Path, err)
 			continue
@@ -382,32 +996,62 @@ func (m *Master) SyncInitialFiles() error {
 }
 
 // syncDirectoryToSlaves 同步目录到所有Slave
-func (m *Master) syncDirectoryToSlaves(monitorPath MonitorPath) error {
+func (m *Master) syncDirectoryToSlaves(monitorPath config.MonitorPath) error {
+	return m.walkMonitorPath(monitorPath, func(path, relPath string, info os.FileInfo) error {
+		// 创建文件事件
+		event := &watcher.FileEvent{
+			Op:    "CREATE",
+			Path:  relPath,
+			IsDir: info.IsDir(),
+		}
+
+		// 处理文件事件
+		m.dispatchEvent(event, monitorPath, false)
+
+		return nil
+	})
+}
+
+// walkMonitorPath 遍历监控路径下所有需要同步的文件和目录（应用过滤规则，父目录先于子项）
+func (m *Master) walkMonitorPath(monitorPath config.MonitorPath, fn func(path, relPath string, info os.FileInfo) error) error {
+	return m.walkFiltered(monitorPath, fn, nil)
+}
+
+// walkFiltered 与walkMonitorPath相同，skipped不为nil时接收被过滤规则排除的路径（被排除的目录不再遍历其下的项）
+func (m *Master) walkFiltered(monitorPath config.MonitorPath, fn func(path, relPath string, info os.FileInfo) error, skipped func(relPath string)) error {
+	filter, err := watcher.NewFilter(monitorPath.Path, monitorPath.FilterConfig())
+	if err != nil {
+		return fmt.Errorf("创建文件过滤器失败: %v", err)
+	}
+
 	return filepath.Walk(monitorPath.Path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// 跳过目录
-		if info.IsDir() {
-			return nil
-		}
-
 		// 获取相对路径
 		relPath, err := filepath.Rel(monitorPath.Path, path)
 		if err != nil {
 			return err
 		}
 
-		// 创建文件事件
-		event := &watcher.FileEvent{
-			Op:   "CREATE",
-			Path: relPath,
+		// 统一使用正斜杠
+		relPath = strings.ReplaceAll(relPath, "\\", "/")
+		if relPath == "." {
+			return nil
 		}
 
-		// 处理文件事件
-		m.processFileEvent(event, monitorPath)
+		// 应用过滤规则，被排除的目录整体跳过
+		if !filter.Match(relPath, info) {
+			if skipped != nil {
+				skipped(relPath)
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-		return nil
+		return fn(path, relPath, info)
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,124 @@
+package master
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"xsync/config"
+	"xsync/hook"
+	"xsync/protocol"
+	"xsync/webserver"
+)
+
+// maxRejectRecords 保留的最近被拒绝变更数量
+const maxRejectRecords = 50
+
+// rejectRecord 一条被发送前钩子拒绝的变更
+type rejectRecord struct {
+	Time        time.Time `json:"time"`
+	MonitorPath string    `json:"monitor_path"`
+	Path        string    `json:"path"`
+	Op          string    `json:"op"`
+	Hook        string    `json:"hook"`
+	Reason      string    `json:"reason"`
+}
+
+// preSendEntry 监控路径的发送前检查器及创建它的配置
+type preSendEntry struct {
+	config  []hook.PreSendConfig
+	checker *hook.PreSend
+}
+
+// getPreSend 获取监控路径的发送前检查器，配置变化时重新创建
+func (m *Master) getPreSend(monitorPath config.MonitorPath) (*hook.PreSend, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, exists := m.preSend[monitorPath.Path]
+	if exists && reflect.DeepEqual(entry.config, monitorPath.PreSend) {
+		return entry.checker, nil
+	}
+
+	checker, err := hook.NewPreSend(monitorPath.Path, monitorPath.PreSend)
+	if err != nil {
+		return nil, err
+	}
+	m.preSend[monitorPath.Path] = &preSendEntry{config: monitorPath.PreSend, checker: checker}
+	return checker, nil
+}
+
+// checkPreSend 执行监控路径的发送前钩子，返回false表示变更被拒绝不应发送
+// 钩子改写内容时直接替换数据包的内容
+func (m *Master) checkPreSend(monitorPath config.MonitorPath, packet *protocol.SyncPacket) bool {
+	if len(monitorPath.PreSend) == 0 {
+		return true
+	}
+
+	checker, err := m.getPreSend(monitorPath)
+	if err != nil {
+		log.Printf("创建发送前钩子失败 %s: %v", monitorPath.Path, err)
+		return true
+	}
+
+	verdict := checker.Check(packet.Op, packet.Path, packet.Content)
+	if verdict.Rejected {
+		// 相同内容重复检查（如全量同步）时不重复记录
+		if !verdict.Cached {
+			log.Printf("发送前钩子 %s 拒绝变更: %s %s: %s", verdict.Hook, packet.Op, packet.Path, verdict.Reason)
+			m.stats.recordRejection(rejectRecord{
+				Time:        time.Now(),
+				MonitorPath: monitorPath.Path,
+				Path:        packet.Path,
+				Op:          packet.Op,
+				Hook:        verdict.Hook,
+				Reason:      verdict.Reason,
+			})
+		}
+		return false
+	}
+
+	if verdict.Transformed {
+		if !verdict.Cached {
+			log.Printf("发送前钩子改写了文件内容: %s (%d -> %d bytes)", packet.Path, len(packet.Content), len(verdict.Content))
+		}
+		packet.SetContent(verdict.Content)
+	}
+	return true
+}
+
+// recordRejection 记录被拒绝的变更
+func (s *MasterStats) recordRejection(record rejectRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Rejected++
+	s.RecentRejections = append(s.RecentRejections, record)
+	if len(s.RecentRejections) > maxRejectRecords {
+		s.RecentRejections = s.RecentRejections[len(s.RecentRejections)-maxRejectRecords:]
+	}
+}
+
+// registerWebHandlers 注册Master的Web接口
+func (m *Master) registerWebHandlers(ws *webserver.WebServer) {
+	ws.Handle("/api/rejections", m.handleRejections)
+	ws.Handle("/api/fullsync", m.handleFullSyncs)
+	ws.Handle("/api/relays", m.handleRelays)
+	ws.Handle("/api/ha", m.handleHA)
+}
+
+// handleRejections 列出最近被发送前钩子拒绝的变更
+func (m *Master) handleRejections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.stats.mutex.Lock()
+	total := m.stats.Rejected
+	records := append([]rejectRecord{}, m.stats.RecentRejections...)
+	m.stats.mutex.Unlock()
+
+	webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"total": total, "rejections": records})
+}
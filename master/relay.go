@@ -0,0 +1,88 @@
+package master
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"xsync/protocol"
+	"xsync/webserver"
+)
+
+// relayRecord 最近一次收到的中继报告
+type relayRecord struct {
+	Via      string    `json:"via"` // 报告的来源地址，多级中继时为直连Master的中继
+	Received time.Time `json:"received"`
+	protocol.RelayReport
+}
+
+// handleRelayReport 记录中继Slave报告的下游状态，下游可用性变化时输出日志
+func (m *Master) handleRelayReport(packet *protocol.SyncPacket, relayAddr string) error {
+	var report protocol.RelayReport
+	if err := packet.DecodeReport(&report); err != nil {
+		return err
+	}
+
+	m.stats.mutex.Lock()
+	previous := m.stats.Relays[report.NodeID]
+	m.stats.Relays[report.NodeID] = &relayRecord{Via: relayAddr, Received: time.Now(), RelayReport: report}
+	m.stats.mutex.Unlock()
+
+	healthy := make(map[string]bool)
+	if previous != nil {
+		for _, status := range previous.Downstream {
+			healthy[status.Addr] = status.Healthy
+		}
+	}
+	for _, status := range report.Downstream {
+		was, known := healthy[status.Addr]
+		switch {
+		case !status.Healthy && (!known || was):
+			log.Printf("中继 %s 的下游Slave不可用: %s(%s): %s", report.NodeID, status.Addr, status.NodeID, status.LastError)
+		case status.Healthy && known && !was:
+			log.Printf("中继 %s 的下游Slave已恢复: %s(%s)", report.NodeID, status.Addr, status.NodeID)
+		}
+	}
+	return nil
+}
+
+// getRelayStats 获取各中继最近一次的报告，超过3个报告间隔未更新的标记为stale
+func (m *Master) getRelayStats() []map[string]interface{} {
+	m.stats.mutex.Lock()
+	records := make([]*relayRecord, 0, len(m.stats.Relays))
+	for _, record := range m.stats.Relays {
+		records = append(records, record)
+	}
+	m.stats.mutex.Unlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].NodeID < records[j].NodeID })
+
+	relays := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		unhealthy := 0
+		for _, status := range record.Downstream {
+			if !status.Healthy {
+				unhealthy++
+			}
+		}
+		interval := time.Duration(record.Interval) * time.Second
+		relays = append(relays, map[string]interface{}{
+			"node_id":    record.NodeID,
+			"via":        record.Via,
+			"received":   record.Received.Format(time.RFC3339),
+			"stale":      interval > 0 && time.Since(record.Received) > 3*interval,
+			"unhealthy":  unhealthy,
+			"downstream": record.Downstream,
+		})
+	}
+	return relays
+}
+
+// handleRelays 列出各中继及其下游Slave的状态
+func (m *Master) handleRelays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"relays": m.getRelayStats()})
+}
@@ -0,0 +1,304 @@
+package master
+
+import (
+	"sync"
+	"time"
+
+	"xsync/protocol"
+)
+
+// 发送池的默认值
+const (
+	defaultSendWorkers  = 4   // 每个Slave同时发送的数据包数
+	defaultSendBufferMB = 256 // 等待发送的文件内容占用的内存上限（MB）
+
+	packetOverhead = 1024 // 每个数据包按内容大小之外额外计入的内存
+)
+
+// 发送优先级：文件变更优先，全量同步使用剩余的容量
+const (
+	priorityHigh = iota
+	priorityLow
+)
+
+// sendPool 按Slave分队列发送数据包
+// 每个Slave最多同时发送send_workers个包，缓冲的内容超过send_buffer_mb时入队阻塞（反压到文件监控）
+// 全量同步最多使用3/4的缓冲，并且排在文件变更之后，避免大量全量同步的文件阻塞新的变更
+type sendPool struct {
+	send    func(addr string, packet *protocol.SyncPacket) bool
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	limit   int64
+	used    int64
+	workers int
+	queues  map[string]*slaveQueue
+	closed  bool
+
+	waits    int64         // 因缓冲已满而等待的次数
+	waitTime time.Duration // 累计等待时间
+}
+
+// slaveQueue 单个Slave的发送队列
+type slaveQueue struct {
+	high, low []*sendJob
+	active    int // 正在运行的发送协程数
+	sent      int64
+	failed    int64
+}
+
+// sendJob 一个发往某个Slave的数据包
+type sendJob struct {
+	packet   *protocol.SyncPacket
+	group    *sendGroup
+	addr     string
+	priority int
+	queued   time.Time // 加入队列的时间，用于计算发送延迟
+}
+
+// sendGroup 同一数据包发往多个Slave，全部完成后释放缓冲并回调
+type sendGroup struct {
+	size    int64
+	pending int
+	failed  []string
+	done    func(failed []string)
+	skip    func() bool // 返回true时不再发送，按失败处理
+}
+
+// newSendPool 创建发送池
+func newSendPool(send func(addr string, packet *protocol.SyncPacket) bool, workers, bufferMB int) *sendPool {
+	p := &sendPool{send: send, queues: make(map[string]*slaveQueue)}
+	p.cond = sync.NewCond(&p.mutex)
+	p.configure(workers, bufferMB)
+	return p
+}
+
+// configure 设置每个Slave的并发数和缓冲上限，0使用默认值
+func (p *sendPool) configure(workers, bufferMB int) {
+	if workers <= 0 {
+		workers = defaultSendWorkers
+	}
+	if bufferMB <= 0 {
+		bufferMB = defaultSendBufferMB
+	}
+
+	p.mutex.Lock()
+	p.workers = workers
+	p.limit = int64(bufferMB) << 20
+	// 并发数调大后立即为有积压的队列补齐发送协程，不等下一次入队
+	for addr, queue := range p.queues {
+		p.spawn(addr, queue)
+	}
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+}
+
+// submit 将数据包加入各Slave的队列，所有Slave发送完成后调用done（参数为发送失败的Slave）
+// 缓冲不足时阻塞直到有数据包发送完成
+func (p *sendPool) submit(addrs []string, packet *protocol.SyncPacket, priority int, done func(failed []string)) {
+	p.submitSkippable(addrs, packet, priority, nil, done)
+}
+
+// submitSkippable 与submit相同，但轮到发送时skip返回true则直接按失败处理
+// 用于全量同步在Slave断开后丢弃已排队的数据包
+func (p *sendPool) submitSkippable(addrs []string, packet *protocol.SyncPacket, priority int, skip func() bool, done func(failed []string)) {
+	if len(addrs) == 0 {
+		if done != nil {
+			done(nil)
+		}
+		return
+	}
+
+	group := &sendGroup{
+		size:    int64(len(packet.Content)) + packetOverhead,
+		pending: len(addrs),
+		done:    done,
+		skip:    skip,
+	}
+
+	p.mutex.Lock()
+	p.acquire(group.size, priority)
+	for _, addr := range addrs {
+		queue := p.queues[addr]
+		if queue == nil {
+			queue = &slaveQueue{}
+			p.queues[addr] = queue
+		}
+		job := &sendJob{packet: packet, group: group, addr: addr, priority: priority, queued: time.Now()}
+		if priority == priorityHigh {
+			queue.high = append(queue.high, job)
+		} else {
+			queue.low = append(queue.low, job)
+		}
+		p.spawn(addr, queue)
+	}
+	p.mutex.Unlock()
+}
+
+// spawn 为有待发送任务的队列启动发送协程，直到达到并发数（调用时需持有锁）
+func (p *sendPool) spawn(addr string, queue *slaveQueue) {
+	// 运行中的协程都在发送已取出的任务，排队的每个任务最多补一个协程
+	pending := len(queue.high) + len(queue.low)
+	for n := 0; n < pending && queue.active < p.workers; n++ {
+		queue.active++
+		go p.work(addr, queue)
+	}
+}
+
+// sendAll 将数据包发送到各Slave并等待完成，返回发送失败的Slave
+func (p *sendPool) sendAll(addrs []string, packet *protocol.SyncPacket, priority int) []string {
+	result := make(chan []string, 1)
+	p.submit(addrs, packet, priority, func(failed []string) { result <- failed })
+	return <-result
+}
+
+// acquire 占用缓冲，不足时等待（调用时需持有锁）
+// 缓冲为空时总是允许，保证超过上限的单个大文件也能发送
+func (p *sendPool) acquire(size int64, priority int) {
+	limit := func() int64 {
+		if priority == priorityHigh {
+			return p.limit
+		}
+		return p.limit / 4 * 3
+	}
+
+	if p.used == 0 || p.used+size <= limit() || p.closed {
+		p.used += size
+		return
+	}
+
+	start := time.Now()
+	p.waits++
+	for p.used > 0 && p.used+size > limit() && !p.closed {
+		p.cond.Wait()
+	}
+	p.waitTime += time.Since(start)
+	p.used += size
+}
+
+// work 发送协程：优先发送文件变更，队列为空时退出
+func (p *sendPool) work(addr string, queue *slaveQueue) {
+	for {
+		p.mutex.Lock()
+		var job *sendJob
+		switch {
+		case len(queue.high) > 0:
+			job, queue.high = queue.high[0], queue.high[1:]
+		case len(queue.low) > 0:
+			job, queue.low = queue.low[0], queue.low[1:]
+		}
+		if job == nil || queue.active > p.workers {
+			if job != nil {
+				// 并发数调小后多余的协程退出，取出的任务放回队首
+				p.requeue(queue, job)
+			}
+			queue.active--
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+
+		if job.group.skip != nil && job.group.skip() {
+			p.finish(queue, job, false)
+			continue
+		}
+		ok := p.send(addr, job.packet)
+		p.finish(queue, job, ok)
+	}
+}
+
+// requeue 将任务放回队首（调用时需持有锁）
+func (p *sendPool) requeue(queue *slaveQueue, job *sendJob) {
+	if job.priority == priorityHigh {
+		queue.high = append([]*sendJob{job}, queue.high...)
+	} else {
+		queue.low = append([]*sendJob{job}, queue.low...)
+	}
+}
+
+// finish 记录一次发送结果，数据包发往所有Slave后释放缓冲
+func (p *sendPool) finish(queue *slaveQueue, job *sendJob, ok bool) {
+	group := job.group
+
+	p.mutex.Lock()
+	if ok {
+		queue.sent++
+	} else {
+		queue.failed++
+		group.failed = append(group.failed, job.addr)
+	}
+	group.pending--
+	finished := group.pending == 0
+	if finished {
+		p.used -= group.size
+		p.cond.Broadcast()
+	}
+	p.mutex.Unlock()
+
+	if finished && group.done != nil {
+		group.done(group.failed)
+	}
+}
+
+// close 停止等待缓冲，之后的任务不再阻塞
+func (p *sendPool) close() {
+	p.mutex.Lock()
+	p.closed = true
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+}
+
+// getStats 获取发送池统计信息
+func (p *sendPool) getStats() map[string]interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	queues := make(map[string]interface{}, len(p.queues))
+	for addr, queue := range p.queues {
+		queues[addr] = map[string]interface{}{
+			"queued_high": len(queue.high),
+			"queued_low":  len(queue.low),
+			"active":      queue.active,
+			"sent":        queue.sent,
+			"failed":      queue.failed,
+		}
+	}
+	return map[string]interface{}{
+		"workers":         p.workers,
+		"buffer_used":     p.used,
+		"buffer_limit":    p.limit,
+		"buffer_waits":    p.waits,
+		"buffer_wait_sec": p.waitTime.Seconds(),
+		"queues":          queues,
+	}
+}
+
+// queueStatus 单个Slave发送队列的状态
+type queueStatus struct {
+	high, low int
+	active    int
+	sent      int64
+	failed    int64
+	lag       time.Duration // 最早一个等待发送的文件变更已等待的时间
+}
+
+// getQueueStatus 获取Slave发送队列的状态
+func (p *sendPool) getQueueStatus(addr string) queueStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	queue := p.queues[addr]
+	if queue == nil {
+		return queueStatus{}
+	}
+	status := queueStatus{
+		high:   len(queue.high),
+		low:    len(queue.low),
+		active: queue.active,
+		sent:   queue.sent,
+		failed: queue.failed,
+	}
+	if len(queue.high) > 0 {
+		status.lag = time.Since(queue.high[0].queued)
+	}
+	return status
+}
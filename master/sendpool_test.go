@@ -0,0 +1,176 @@
+package master
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"xsync/protocol"
+)
+
+func TestSendPoolAcquire(t *testing.T) {
+	const limit = 1 << 20
+
+	tests := []struct {
+		name      string
+		used      int64
+		size      int64
+		priority  int
+		wantBlock bool
+	}{
+		{"缓冲为空时允许超大文件", 0, 2 * limit, priorityLow, false},
+		{"文件变更使用全部缓冲", limit / 2, limit / 2, priorityHigh, false},
+		{"文件变更超出缓冲", limit / 2, limit/2 + 1, priorityHigh, true},
+		{"全量同步只使用3/4", limit / 2, limit / 2, priorityLow, true},
+		{"全量同步在3/4以内", limit / 2, limit / 4, priorityLow, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newSendPool(nil, 1, 1)
+			p.used = tt.used
+
+			acquired := make(chan struct{})
+			go func() {
+				p.mutex.Lock()
+				p.acquire(tt.size, tt.priority)
+				p.mutex.Unlock()
+				close(acquired)
+			}()
+
+			select {
+			case <-acquired:
+				if tt.wantBlock {
+					t.Fatalf("应等待缓冲释放")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if !tt.wantBlock {
+					t.Fatalf("不应等待")
+				}
+				// 释放缓冲后继续
+				p.mutex.Lock()
+				p.used = 0
+				p.mutex.Unlock()
+				p.cond.Broadcast()
+				<-acquired
+				if p.waits != 1 {
+					t.Errorf("等待次数 = %d, 期望 1", p.waits)
+				}
+			}
+			if want := tt.size; tt.wantBlock && p.used != want {
+				t.Errorf("占用的缓冲 = %d, 期望 %d", p.used, want)
+			}
+		})
+	}
+}
+
+func TestSendPoolPriority(t *testing.T) {
+	release := make(chan struct{})
+	busy := make(chan struct{})
+	var mutex sync.Mutex
+	var order []string
+	send := func(addr string, packet *protocol.SyncPacket) bool {
+		mutex.Lock()
+		order = append(order, packet.Path)
+		mutex.Unlock()
+		if packet.Path == "first" {
+			close(busy)
+			<-release
+		}
+		return true
+	}
+
+	p := newSendPool(send, 1, 1)
+	var wg sync.WaitGroup
+	submit := func(path string, priority int) {
+		wg.Add(1)
+		p.submit([]string{"s1"}, protocol.NewSyncPacket("MODIFY", path, nil), priority, func([]string) { wg.Done() })
+	}
+
+	// 唯一的发送协程正在发送时排队，之后的文件变更先于全量同步发送
+	submit("first", priorityLow)
+	<-busy
+	submit("low1", priorityLow)
+	submit("low2", priorityLow)
+	submit("high1", priorityHigh)
+	submit("high2", priorityHigh)
+	close(release)
+	wg.Wait()
+
+	want := []string{"first", "high1", "high2", "low1", "low2"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("发送顺序 = %v, 期望 %v", order, want)
+	}
+	if p.used != 0 {
+		t.Errorf("发送完成后占用的缓冲 = %d", p.used)
+	}
+}
+
+func TestSendPoolFailed(t *testing.T) {
+	send := func(addr string, packet *protocol.SyncPacket) bool {
+		return addr != "bad"
+	}
+	p := newSendPool(send, 2, 1)
+
+	tests := []struct {
+		name   string
+		addrs  []string
+		skip   func() bool
+		failed []string
+	}{
+		{"全部成功", []string{"a", "b"}, nil, nil},
+		{"部分失败", []string{"a", "bad"}, nil, []string{"bad"}},
+		{"跳过按失败处理", []string{"a", "b"}, func() bool { return true }, []string{"a", "b"}},
+		{"没有Slave", nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		result := make(chan []string, 1)
+		p.submitSkippable(tt.addrs, protocol.NewSyncPacket("MODIFY", "f", []byte("x")), priorityHigh, tt.skip, func(failed []string) {
+			result <- failed
+		})
+		failed := <-result
+		sort.Strings(failed)
+		if !reflect.DeepEqual(failed, tt.failed) {
+			t.Errorf("%s: 失败的Slave = %v, 期望 %v", tt.name, failed, tt.failed)
+		}
+	}
+}
+
+func TestSendPoolConfigureWorkers(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	send := func(addr string, packet *protocol.SyncPacket) bool {
+		started <- struct{}{}
+		<-release
+		return true
+	}
+
+	p := newSendPool(send, 1, 1)
+	for i := 0; i < 3; i++ {
+		p.submit([]string{"s1"}, protocol.NewSyncPacket("MODIFY", "f", nil), priorityHigh, nil)
+	}
+
+	<-started
+	select {
+	case <-started:
+		t.Fatalf("并发数为1时不应同时发送两个包")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 调大并发数后排队的包立即开始发送
+	p.configure(3, 1)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("调大并发数后未启动新的发送协程")
+		}
+	}
+	if status := p.getQueueStatus("s1"); status.active != 3 || status.high != 0 {
+		t.Errorf("队列状态 = %+v", status)
+	}
+	close(release)
+}
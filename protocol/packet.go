@@ -12,10 +12,31 @@ import (
 
 // SyncPacket 同步数据包结构
 type SyncPacket struct {
-	Op       string `json:"op"`       // "CREATE"/"MODIFY"/"DELETE"
+	Op       string `json:"op"`       // "CREATE"/"MODIFY"/"DELETE"/"MKDIR"/"DRIFT"/"MANIFEST"/"HOOK_REPORT"/"BATCH_COMMIT"/"RELAY_REPORT"/"HA_HEARTBEAT"/"FENCE"/"LIST"/"VERIFY"/"QUERY_REPLY"
 	Path     string `json:"path"`     // 文件相对路径
 	Content  []byte `json:"content"`  // 文件内容（DELETE时为空）
 	Checksum uint32 `json:"checksum"` // CRC32校验
+
+	// 双向同步使用的字段
+	Origin  string            `json:"origin,omitempty"`   // 文件当前内容的来源节点ID
+	Version map[string]uint64 `json:"version,omitempty"`  // 文件的版本向量
+	ModTime int64             `json:"mod_time,omitempty"` // 文件修改时间（UnixNano）
+
+	ListenPort int `json:"listen_port,omitempty"` // 发送方的监听端口，用于回复
+
+	Batch string `json:"batch,omitempty"` // 所属批次ID，Slave暂存后在BATCH_COMMIT时一起应用
+
+	Target string `json:"target,omitempty"` // 写入的目标名称，Slave按targets映射到本地目录，为空时写入sync_path
+
+	Group string `json:"group,omitempty"` // 所属同步组，多个同步组共用一个端口时由传输层填写并校验
+
+	// Master高可用使用的字段
+	Epoch  uint64 `json:"epoch,omitempty"`  // 发送方Master的任期，Slave拒绝任期小于已知任期的数据包
+	Source string `json:"source,omitempty"` // 变更所属的监控路径，备用Master据此写入对应目录
+
+	// 大文件分块传输使用的字段（全量同步），Size大于0时Content是文件从Offset开始的一块，ModTime区分同一文件的不同传输
+	Offset int64 `json:"offset,omitempty"` // 分块在文件中的偏移
+	Size   int64 `json:"size,omitempty"`   // 文件总大小
 }
 
 // NewSyncPacket 创建新的同步包
@@ -28,9 +49,20 @@ func NewSyncPacket(op, path string, content []byte) *SyncPacket {
 	}
 }
 
+// IsChunk 判断数据包是否为大文件的一个分块
+func (p *SyncPacket) IsChunk() bool {
+	return p.Size > 0
+}
+
+// SetContent 替换数据包内容并重新计算校验和
+func (p *SyncPacket) SetContent(content []byte) {
+	p.Content = content
+	p.Checksum = crc32.ChecksumIEEE(content)
+}
+
 // Validate 验证数据包完整性
 func (p *SyncPacket) Validate() error {
-	if p.Op != "CREATE" && p.Op != "MODIFY" && p.Op != "DELETE" && p.Op != "SYNC_REQUEST" && p.Op != "SYNC_RESPONSE" && p.Op != "HEARTBEAT" {
+	if p.Op != "CREATE" && p.Op != "MODIFY" && p.Op != "DELETE" && p.Op != "MKDIR" && p.Op != "DRIFT" && p.Op != "MANIFEST" && p.Op != "HOOK_REPORT" && p.Op != "BATCH_COMMIT" && p.Op != "RELAY_REPORT" && p.Op != "HA_HEARTBEAT" && p.Op != "FENCE" && p.Op != "SYNC_REQUEST" && p.Op != "SYNC_RESPONSE" && p.Op != "HEARTBEAT" && p.Op != "LIST" && p.Op != "VERIFY" && p.Op != "QUERY_REPLY" {
 		return fmt.Errorf("无效的操作类型: %s", p.Op)
 	}
 
@@ -119,4 +151,4 @@ func DecryptPacket(encryptedData []byte, key []byte) (*SyncPacket, error) {
 	}
 
 	return &packet, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,170 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Slave本地变更（偏差）的处理策略
+const (
+	DriftRevert     = "revert"     // 恢复为Master上的版本
+	DriftQuarantine = "quarantine" // 将本地副本移入隔离目录后恢复
+	DriftAlert      = "alert"      // 只报告，不修改本地文件
+)
+
+// DriftReport Slave检测到的本地变更报告（DRIFT数据包的内容）
+type DriftReport struct {
+	NodeID string    `json:"node_id"`
+	Op     string    `json:"op"`     // 本地变更类型 CREATE/MODIFY/DELETE
+	Policy string    `json:"policy"` // Slave的处理策略 revert/quarantine/alert
+	Time   time.Time `json:"time"`
+}
+
+// HookReport Slave同步后钩子执行失败的报告（HOOK_REPORT数据包的内容）
+type HookReport struct {
+	NodeID   string    `json:"node_id"`
+	Hook     string    `json:"hook"`
+	Paths    []string  `json:"paths"` // 触发钩子的路径（最多MaxReportPaths个）
+	Total    int       `json:"total"` // 触发钩子的路径总数
+	Error    string    `json:"error"`
+	Output   string    `json:"output"`   // 命令输出或HTTP响应（截断）
+	Duration int64     `json:"duration"` // 执行耗时（毫秒）
+	Time     time.Time `json:"time"`
+}
+
+// MaxReportPaths 报告中携带的最大路径数
+const MaxReportPaths = 100
+
+// Manifest 全量同步结束时Master发送的文件清单（MANIFEST数据包的内容）
+type Manifest struct {
+	Files []string `json:"files"`
+	Dirs  []string `json:"dirs"`
+
+	// 镜像模式下Slave不删除被Master的过滤规则排除的文件（类似rsync不带--delete-excluded）
+	Filters  []ManifestFilter `json:"filters,omitempty"`  // 清单包含的各监控路径的include/exclude规则
+	Excluded []string         `json:"excluded,omitempty"` // Master遍历时排除的路径（含.xsyncignore、大小和时间限制），目录被排除时其下所有文件都受保护
+}
+
+// ManifestFilter 清单对应的一个监控路径的过滤规则
+type ManifestFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// BatchCommit 一批变更发送完成后Master发送的提交信息（BATCH_COMMIT数据包的内容）
+type BatchCommit struct {
+	ID      string   `json:"id"`
+	Entries []string `json:"entries"` // 批次包含的路径，Slave收齐后才应用
+}
+
+// RelayReport 中继Slave定期发给上游的下游节点状态（RELAY_REPORT数据包的内容）
+type RelayReport struct {
+	NodeID     string             `json:"node_id"`
+	Interval   int                `json:"interval"` // 报告间隔（秒），超过3个间隔未收到报告说明中继本身异常
+	Downstream []DownstreamStatus `json:"downstream"`
+	Time       time.Time          `json:"time"`
+}
+
+// DownstreamStatus 中继的一个下游Slave的状态
+type DownstreamStatus struct {
+	Addr      string    `json:"addr"`
+	NodeID    string    `json:"node_id,omitempty"`
+	Healthy   bool      `json:"healthy"`
+	Queued    int       `json:"queued"`
+	Sent      int64     `json:"sent"`
+	Failed    int64     `json:"failed"`
+	Dropped   int64     `json:"dropped"` // 不可用或队列已满时丢弃的数据包，恢复后通过全量同步补齐
+	FullSyncs int64     `json:"full_syncs"`
+	Drifts    int64     `json:"drifts"`
+	LastSent  time.Time `json:"last_sent"`
+	LastSeen  time.Time `json:"last_seen"` // 最近收到下游心跳或请求的时间
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// HAHeartbeat 高可用的两个Master之间互相发送的心跳（HA_HEARTBEAT数据包的内容）
+type HAHeartbeat struct {
+	NodeID string    `json:"node_id"`
+	Epoch  uint64    `json:"epoch"`
+	Active bool      `json:"active"`
+	Time   time.Time `json:"time"`
+}
+
+// Fence Slave拒绝过期Master的数据包时发回的当前任期（FENCE数据包的内容）
+type Fence struct {
+	NodeID string `json:"node_id"`
+	Epoch  uint64 `json:"epoch"`
+	Master string `json:"master"` // 发送方认为的当前主Master
+}
+
+// Query Master向Slave查询目录内容或文件哈希（LIST/VERIFY数据包的内容），查询的目标由数据包的Target指定
+// Slave通过QUERY_REPLY数据包返回QueryReply
+type Query struct {
+	ID  string `json:"id"`
+	Dir string `json:"dir,omitempty"` // LIST: 列出的目录（相对目标根目录）
+}
+
+// QueryReply Slave对查询的回复（QUERY_REPLY数据包的内容）
+type QueryReply struct {
+	ID      string            `json:"id"`
+	NodeID  string            `json:"node_id"`
+	Error   string            `json:"error,omitempty"`
+	Entries []ListEntry       `json:"entries,omitempty"` // LIST: 目录中的文件和子目录
+	Hashes  map[string]string `json:"hashes,omitempty"`  // VERIFY: 相对路径 -> 文件内容的SHA-256
+}
+
+// ListEntry 目录中的一项
+type ListEntry struct {
+	Name    string    `json:"name"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// HashFile 计算文件内容的SHA-256（十六进制），用于比较Master和Slave上的文件
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// NewReportPacket 创建报告类数据包，报告内容以JSON编码放在Content中
+func NewReportPacket(op, path string, report interface{}) (*SyncPacket, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("序列化报告失败: %v", err)
+	}
+	return NewSyncPacket(op, path, data), nil
+}
+
+// DecodeReport 解析报告类数据包的内容
+func (p *SyncPacket) DecodeReport(report interface{}) error {
+	if err := json.Unmarshal(p.Content, report); err != nil {
+		return fmt.Errorf("解析报告失败: %v", err)
+	}
+	return nil
+}
+
+// CleanPath 检查对端发来的相对路径，拒绝绝对路径和越出同步目录的路径
+func CleanPath(path string) (string, error) {
+	cleaned := filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+	if cleaned == "." || filepath.IsAbs(path) || strings.HasPrefix(path, "/") ||
+		cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("非法的同步路径: %s", path)
+	}
+	return cleaned, nil
+}
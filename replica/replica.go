@@ -0,0 +1,399 @@
+package replica
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// 冲突处理策略
+const (
+	PolicyNewest   = "newest"    // 修改时间较新的一方胜出
+	PolicyMaster   = "master"    // Master一方胜出
+	PolicyKeepBoth = "keep_both" // 较新的一方胜出，另一方另存为冲突副本
+)
+
+// conflictTimeFormat 冲突副本文件名中的时间格式
+const conflictTimeFormat = "20060102-150405"
+
+// ValidatePolicy 检查冲突处理策略是否有效（空表示默认策略newest）
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case "", PolicyNewest, PolicyMaster, PolicyKeepBoth:
+		return nil
+	}
+	return fmt.Errorf("无效的冲突处理策略: %s (可选 %s/%s/%s)", policy, PolicyNewest, PolicyMaster, PolicyKeepBoth)
+}
+
+// Result 远程变更的处理结果
+type Result struct {
+	Applied  bool                 // 本地文件已按远程变更更新
+	Conflict bool                 // 检测到并发修改
+	Reply    *protocol.SyncPacket // 本地版本胜出时需要发回对端的数据包
+}
+
+// Replica 双向同步中一个同步目录的副本状态
+type Replica struct {
+	root       string
+	nodeID     string
+	policy     string
+	isMaster   bool
+	store      *Store
+	suppressor *Suppressor
+	conflicts  int64
+	stale      int64
+	backup     func(fullPath string, deleted bool)
+	mutex      sync.Mutex // 串行化本地变更与远程变更的版本更新
+}
+
+// Open 打开同步目录的副本状态，版本信息保存在 <root>/.xsync/versions.json
+func Open(root, nodeID, policy string, isMaster bool) (*Replica, error) {
+	if err := ValidatePolicy(policy); err != nil {
+		return nil, err
+	}
+	if policy == "" {
+		policy = PolicyNewest
+	}
+
+	store, err := NewStore(filepath.Join(root, watcher.MetaDir, "versions.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Replica{
+		root:       root,
+		nodeID:     nodeID,
+		policy:     policy,
+		isMaster:   isMaster,
+		store:      store,
+		suppressor: NewSuppressor(),
+	}, nil
+}
+
+// Close 保存版本信息
+func (r *Replica) Close() error {
+	return r.store.Close()
+}
+
+// SetBackup 设置远程变更覆盖或删除本地文件前调用的备份函数
+func (r *Replica) SetBackup(backup func(fullPath string, deleted bool)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backup = backup
+}
+
+// Track 为尚无版本信息的已有文件建立初始版本，返回是否新建
+func (r *Replica) Track(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry := r.store.Get(relPath)
+	if len(entry.Version) > 0 && !entry.Deleted {
+		return false
+	}
+	r.store.Set(relPath, entry.Version.Bump(r.nodeID), false, r.nodeID)
+	return true
+}
+
+// PrepareLocal 为本地变更递增版本并附加到数据包
+// 返回false表示该事件是刚应用的远程变更引起的，不需要再发送
+func (r *Replica) PrepareLocal(packet *protocol.SyncPacket) bool {
+	relPath := filepath.ToSlash(packet.Path)
+	deleted := packet.Op == "DELETE"
+
+	if r.suppressor.Suppress(relPath, packet.Checksum, deleted) {
+		return false
+	}
+
+	packet.Origin = r.nodeID
+	if packet.Op == "MKDIR" {
+		return true
+	}
+
+	r.mutex.Lock()
+	version := r.store.Get(relPath).Version.Bump(r.nodeID)
+	r.store.Set(relPath, version, deleted, r.nodeID)
+	r.mutex.Unlock()
+
+	packet.Version = version
+	packet.ModTime = r.modTime(relPath)
+	return true
+}
+
+// Annotate 为全量同步的数据包附加当前版本（不递增）
+func (r *Replica) Annotate(packet *protocol.SyncPacket) {
+	relPath := filepath.ToSlash(packet.Path)
+	packet.Origin = r.nodeID
+	if packet.Op == "MKDIR" {
+		return
+	}
+	entry := r.store.Get(relPath)
+	if entry.Origin != "" {
+		packet.Origin = entry.Origin
+	}
+	packet.Version = entry.Version
+	packet.ModTime = r.modTime(relPath)
+}
+
+// Apply 按版本向量处理远程变更
+func (r *Replica) Apply(packet *protocol.SyncPacket) (*Result, error) {
+	relPath, err := cleanPath(packet.Path)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := filepath.Join(r.root, filepath.FromSlash(relPath))
+
+	if packet.Op == "MKDIR" {
+		if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+			return &Result{}, nil
+		}
+		r.suppressor.Add(relPath, packet.Checksum, false)
+		if err := os.MkdirAll(fullPath, 0755); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %v", err)
+		}
+		return &Result{Applied: true}, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	local := r.store.Get(relPath)
+	remote := VersionVector(packet.Version)
+	merged := remote.Merge(local.Version)
+
+	switch remote.Compare(local.Version) {
+	case Before:
+		r.stale++
+		log.Printf("忽略过期的远程变更: %s %s (远程 %s, 本地 %s)", packet.Op, relPath, remote, local.Version)
+		return &Result{}, nil
+	case Equal:
+		// 对端未携带版本时（如单向模式的Master）按普通同步处理
+		if len(remote) > 0 && !r.differs(fullPath, packet) {
+			return &Result{}, nil
+		}
+		return r.applyRemote(relPath, fullPath, packet, merged)
+	case After:
+		return r.applyRemote(relPath, fullPath, packet, merged)
+	}
+
+	// 并发修改：内容相同则只合并版本
+	if !r.differs(fullPath, packet) {
+		r.store.Set(relPath, merged, packet.Op == "DELETE", local.Origin)
+		return &Result{}, nil
+	}
+
+	r.conflicts++
+	remoteWins := r.remoteWins(fullPath, packet, local.Origin)
+	log.Printf("检测到冲突: %s (远程 %s 来自 %s, 本地 %s), 策略 %s, %s胜出",
+		relPath, remote, packet.Origin, local.Version, r.policy, winnerName(remoteWins))
+
+	if r.policy == PolicyKeepBoth {
+		if err := r.saveConflictCopy(fullPath, packet, local.Origin, remoteWins); err != nil {
+			log.Printf("保存冲突副本失败: %v", err)
+		}
+	}
+
+	if remoteWins {
+		result, err := r.applyRemote(relPath, fullPath, packet, merged)
+		if result != nil {
+			result.Conflict = true
+		}
+		return result, err
+	}
+
+	// 本地胜出：递增版本使其支配双方，并发回对端
+	version := merged.Bump(r.nodeID)
+	r.store.Set(relPath, version, local.Deleted, local.Origin)
+	reply, err := r.localPacket(relPath, fullPath)
+	if err != nil {
+		return nil, err
+	}
+	reply.Origin = local.Origin
+	if reply.Origin == "" {
+		reply.Origin = r.nodeID
+	}
+	reply.Version = version
+	return &Result{Conflict: true, Reply: reply}, nil
+}
+
+// GetStats 获取副本统计信息
+func (r *Replica) GetStats() map[string]interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return map[string]interface{}{
+		"node_id":         r.nodeID,
+		"conflict_policy": r.policy,
+		"tracked_files":   r.store.Len(),
+		"conflicts":       r.conflicts,
+		"stale_changes":   r.stale,
+	}
+}
+
+// applyRemote 写入远程变更并记录版本（调用时需持有锁）
+func (r *Replica) applyRemote(relPath, fullPath string, packet *protocol.SyncPacket, version VersionVector) (*Result, error) {
+	deleted := packet.Op == "DELETE"
+
+	// 先登记回环抑制，写入触发的本地事件不再发回
+	r.suppressor.Add(relPath, packet.Checksum, deleted)
+
+	if r.backup != nil {
+		r.backup(fullPath, deleted)
+	}
+
+	if deleted {
+		if err := os.RemoveAll(fullPath); err != nil {
+			return nil, fmt.Errorf("删除文件失败: %v", err)
+		}
+	} else if err := writeFile(fullPath, packet.Content, packet.ModTime); err != nil {
+		return nil, err
+	}
+
+	r.store.Set(relPath, version, deleted, packet.Origin)
+	return &Result{Applied: true}, nil
+}
+
+// remoteWins 判断并发修改时远程版本是否胜出
+// 双方按相同规则判断，保证各节点得到一致的结果
+func (r *Replica) remoteWins(fullPath string, packet *protocol.SyncPacket, localOrigin string) bool {
+	if r.policy == PolicyMaster {
+		return !r.isMaster
+	}
+
+	var localModTime int64
+	if info, err := os.Lstat(fullPath); err == nil {
+		localModTime = info.ModTime().UnixNano()
+	}
+
+	if packet.ModTime != localModTime {
+		return packet.ModTime > localModTime
+	}
+	if localOrigin == "" {
+		localOrigin = r.nodeID
+	}
+	return packet.Origin > localOrigin
+}
+
+// saveConflictCopy 将落败一方的内容另存为 <文件>.conflict-<节点>-<时间>
+func (r *Replica) saveConflictCopy(fullPath string, packet *protocol.SyncPacket, localOrigin string, remoteWins bool) error {
+	var content []byte
+	var node string
+	var modTime int64
+
+	if remoteWins {
+		info, err := os.Lstat(fullPath)
+		if err != nil || info.IsDir() {
+			return nil // 本地已删除，没有需要保留的内容
+		}
+		content, err = ioutil.ReadFile(fullPath)
+		if err != nil {
+			return fmt.Errorf("读取本地文件失败: %v", err)
+		}
+		node, modTime = localOrigin, info.ModTime().UnixNano()
+		if node == "" {
+			node = r.nodeID
+		}
+	} else {
+		if packet.Op == "DELETE" {
+			return nil
+		}
+		content, node, modTime = packet.Content, packet.Origin, packet.ModTime
+	}
+
+	// 文件名由落败方的节点和修改时间决定，双方生成的冲突副本相同
+	name := fmt.Sprintf("%s.conflict-%s-%s", fullPath, node, time.Unix(0, modTime).Format(conflictTimeFormat))
+	log.Printf("保存冲突副本: %s", name)
+	return writeFile(name, content, modTime)
+}
+
+// differs 判断远程变更与本地文件内容是否不同
+func (r *Replica) differs(fullPath string, packet *protocol.SyncPacket) bool {
+	info, err := os.Lstat(fullPath)
+	if packet.Op == "DELETE" {
+		return err == nil
+	}
+	if err != nil || info.IsDir() || info.Size() != int64(len(packet.Content)) {
+		return true
+	}
+	content, err := ioutil.ReadFile(fullPath)
+	return err != nil || !bytes.Equal(content, packet.Content)
+}
+
+// localPacket 根据本地文件生成数据包
+func (r *Replica) localPacket(relPath, fullPath string) (*protocol.SyncPacket, error) {
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return protocol.NewSyncPacket("DELETE", relPath, nil), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	packet := protocol.NewSyncPacket("MODIFY", relPath, content)
+	packet.ModTime = info.ModTime().UnixNano()
+	return packet, nil
+}
+
+// modTime 获取本地文件的修改时间
+func (r *Replica) modTime(relPath string) int64 {
+	if info, err := os.Lstat(filepath.Join(r.root, filepath.FromSlash(relPath))); err == nil {
+		return info.ModTime().UnixNano()
+	}
+	return 0
+}
+
+// writeFile 原子写入文件并设置修改时间
+func writeFile(fullPath string, content []byte, modTime int64) error {
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+".xsync-tmp")
+	if err := ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	if modTime > 0 {
+		t := time.Unix(0, modTime)
+		os.Chtimes(tmpPath, t, t)
+	}
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("重命名文件失败: %v", err)
+	}
+	return nil
+}
+
+// cleanPath 检查远程路径，并拒绝写入元数据目录
+func cleanPath(path string) (string, error) {
+	cleaned, err := protocol.CleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	if cleaned == watcher.MetaDir || strings.HasPrefix(cleaned, watcher.MetaDir+"/") {
+		return "", fmt.Errorf("非法的同步路径: %s", path)
+	}
+	return cleaned, nil
+}
+
+// winnerName 冲突胜出方的描述
+func winnerName(remoteWins bool) string {
+	if remoteWins {
+		return "远程版本"
+	}
+	return "本地版本"
+}
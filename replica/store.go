@@ -0,0 +1,146 @@
+package replica
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// flushInterval 版本信息落盘间隔
+const flushInterval = 2 * time.Second
+
+// Entry 单个文件的版本信息
+type Entry struct {
+	Version VersionVector `json:"version"`
+	Deleted bool          `json:"deleted,omitempty"` // 删除墓碑，防止旧版本复活
+	Origin  string        `json:"origin,omitempty"`  // 当前内容的来源节点
+}
+
+// Store 持久化的文件版本向量存储
+type Store struct {
+	path    string
+	entries map[string]*Entry
+	dirty   bool
+	mutex   sync.Mutex
+	done    chan bool
+}
+
+// NewStore 打开版本存储，文件不存在时创建空存储
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]*Entry),
+		done:    make(chan bool),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &s.entries); err != nil {
+			return nil, fmt.Errorf("解析版本文件失败 %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取版本文件失败 %s: %v", path, err)
+	}
+
+	go s.flushLoop()
+	return s, nil
+}
+
+// Get 获取文件的版本信息（不存在时返回空版本）
+func (s *Store) Get(path string) Entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry, exists := s.entries[path]; exists {
+		return Entry{Version: entry.Version.Clone(), Deleted: entry.Deleted, Origin: entry.Origin}
+	}
+	return Entry{Version: VersionVector{}}
+}
+
+// Set 设置文件的版本信息
+func (s *Store) Set(path string, version VersionVector, deleted bool, origin string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[path] = &Entry{Version: version.Clone(), Deleted: deleted, Origin: origin}
+	s.dirty = true
+}
+
+// Len 获取记录的文件数
+func (s *Store) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries)
+}
+
+// Close 落盘并停止后台刷新
+func (s *Store) Close() error {
+	close(s.done)
+	return s.Flush()
+}
+
+// Flush 将版本信息写入磁盘
+func (s *Store) Flush() error {
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s.entries)
+	s.dirty = false
+	s.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("序列化版本信息失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建版本目录失败: %v", err)
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("写入版本文件失败: %v", err)
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// flushLoop 定期落盘
+func (s *Store) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("保存版本信息失败: %v", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sortedKeys 返回排序后的节点ID
+func sortedKeys(v VersionVector) []string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// uitoa 无符号整数转字符串
+func uitoa(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,62 @@
+package replica
+
+import (
+	"sync"
+	"time"
+)
+
+// suppressTTL 回环抑制记录的有效期
+const suppressTTL = time.Minute
+
+// suppressEntry 刚应用的远程变更
+type suppressEntry struct {
+	checksum uint32
+	deleted  bool
+	expires  time.Time
+}
+
+// Suppressor 回环抑制：记录刚写入的远程变更，忽略由此触发的本地文件事件
+type Suppressor struct {
+	entries map[string]suppressEntry
+	mutex   sync.Mutex
+}
+
+// NewSuppressor 创建回环抑制器
+func NewSuppressor() *Suppressor {
+	return &Suppressor{entries: make(map[string]suppressEntry)}
+}
+
+// Add 记录已应用的远程变更
+func (s *Suppressor) Add(path string, checksum uint32, deleted bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for p, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, p)
+		}
+	}
+	s.entries[path] = suppressEntry{checksum: checksum, deleted: deleted, expires: now.Add(suppressTTL)}
+}
+
+// Suppress 判断本地事件是否由刚应用的远程变更引起
+// 同一次写入可能产生多个事件（如新目录的补充扫描），匹配后记录保留到过期
+func (s *Suppressor) Suppress(path string, checksum uint32, deleted bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.entries[path]
+	if !exists {
+		return false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, path)
+		return false
+	}
+	if entry.deleted != deleted || (!deleted && entry.checksum != checksum) {
+		// 内容不同说明本地在此之后又修改过，需要正常同步
+		return false
+	}
+	return true
+}
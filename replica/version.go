@@ -0,0 +1,87 @@
+package replica
+
+// Ordering 版本向量的比较结果
+type Ordering int
+
+const (
+	Equal      Ordering = iota // 完全相同
+	Before                     // 早于对方（对方包含本方所有修改）
+	After                      // 晚于对方（本方包含对方所有修改）
+	Concurrent                 // 并发修改，存在冲突
+)
+
+// VersionVector 版本向量：节点ID -> 该节点对文件的修改次数
+type VersionVector map[string]uint64
+
+// Compare 比较两个版本向量
+func (v VersionVector) Compare(other VersionVector) Ordering {
+	less, greater := false, false
+
+	for node, counter := range v {
+		if counter > other[node] {
+			greater = true
+		} else if counter < other[node] {
+			less = true
+		}
+	}
+	for node, counter := range other {
+		if _, exists := v[node]; !exists && counter > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return Concurrent
+	case less:
+		return Before
+	case greater:
+		return After
+	default:
+		return Equal
+	}
+}
+
+// Merge 合并两个版本向量，取每个节点的最大值
+func (v VersionVector) Merge(other VersionVector) VersionVector {
+	result := v.Clone()
+	for node, counter := range other {
+		if counter > result[node] {
+			result[node] = counter
+		}
+	}
+	return result
+}
+
+// Clone 复制版本向量
+func (v VersionVector) Clone() VersionVector {
+	result := make(VersionVector, len(v))
+	for node, counter := range v {
+		result[node] = counter
+	}
+	return result
+}
+
+// Bump 返回增加指定节点计数后的新版本向量
+func (v VersionVector) Bump(nodeID string) VersionVector {
+	result := v.Clone()
+	result[nodeID]++
+	return result
+}
+
+// String 返回版本向量的可读形式
+func (v VersionVector) String() string {
+	if len(v) == 0 {
+		return "{}"
+	}
+	s := "{"
+	first := true
+	for _, node := range sortedKeys(v) {
+		if !first {
+			s += ","
+		}
+		first = false
+		s += node + ":" + uitoa(v[node])
+	}
+	return s + "}"
+}
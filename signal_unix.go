@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadSignal 热加载配置的信号，statsSignal 输出状态信息的信号
+var (
+	reloadSignal os.Signal = syscall.SIGHUP
+	statsSignal  os.Signal = syscall.SIGUSR1
+)
+
+// notifySignals 注册关闭、热加载配置和输出状态信息的信号
+func notifySignals(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+}
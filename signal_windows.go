@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Windows平台没有SIGHUP和SIGUSR1，通过控制接口的reload和status命令热加载配置和查看状态
+var (
+	reloadSignal os.Signal
+	statsSignal  os.Signal
+)
+
+// notifySignals 注册关闭信号
+func notifySignals(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+}
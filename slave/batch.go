@@ -0,0 +1,305 @@
+package slave
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// stagingDir 批次暂存目录（相对同步目录）
+var stagingDir = filepath.Join(watcher.MetaDir, "staging")
+
+// stagedBatch 正在接收的批次，文件内容先写入暂存目录
+type stagedBatch struct {
+	id      string
+	target  string // 批次写入的目标，为空时写入sync_path
+	dir     string
+	entries map[string]*batchEntry // 路径 -> 暂存的变更
+	commit  *protocol.BatchCommit
+	timer   *time.Timer
+}
+
+// batchEntry 批次中的一个变更
+type batchEntry struct {
+	packet *protocol.SyncPacket // 不含内容
+	staged string               // 暂存的文件内容（CREATE/MODIFY）
+}
+
+// validBatchID 检查批次ID，ID会用作目录名
+func validBatchID(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id
+}
+
+// stageBatchPacket 暂存批次中的一个变更，收齐后提交
+func (s *Slave) stageBatchPacket(packet *protocol.SyncPacket) error {
+	if !validBatchID(packet.Batch) {
+		s.stats.Errors++
+		return fmt.Errorf("非法的批次ID: %s", packet.Batch)
+	}
+	relPath, err := protocol.CleanPath(packet.Path)
+	if err != nil {
+		s.stats.Errors++
+		return err
+	}
+
+	s.batchMutex.Lock()
+	defer s.batchMutex.Unlock()
+
+	batch, err := s.getBatch(packet.Batch)
+	if err != nil {
+		s.stats.Errors++
+		return err
+	}
+
+	entry := &batchEntry{}
+	if packet.Op == "CREATE" || packet.Op == "MODIFY" {
+		entry.staged = filepath.Join(batch.dir, strconv.Itoa(len(batch.entries)))
+		if err := ioutil.WriteFile(entry.staged, packet.Content, 0644); err != nil {
+			s.stats.Errors++
+			return fmt.Errorf("暂存文件失败 %s: %v", relPath, err)
+		}
+	}
+	entry.packet = &protocol.SyncPacket{
+		Op:       packet.Op,
+		Path:     relPath,
+		Target:   packet.Target,
+		Checksum: packet.Checksum,
+		Origin:   packet.Origin,
+		Version:  packet.Version,
+		ModTime:  packet.ModTime,
+	}
+	batch.entries[relPath] = entry
+
+	return s.tryCommitBatch(batch)
+}
+
+// handleBatchCommit 处理Master发送的批次提交，变更尚未收齐时等待
+func (s *Slave) handleBatchCommit(packet *protocol.SyncPacket) error {
+	var commit protocol.BatchCommit
+	if err := packet.DecodeReport(&commit); err != nil {
+		return err
+	}
+	if !validBatchID(commit.ID) {
+		s.stats.Errors++
+		return fmt.Errorf("非法的批次ID: %s", commit.ID)
+	}
+	if _, err := s.targetRoot(packet.Target); err != nil {
+		s.stats.Errors++
+		return err
+	}
+
+	s.batchMutex.Lock()
+	defer s.batchMutex.Unlock()
+
+	batch, err := s.getBatch(commit.ID)
+	if err != nil {
+		s.stats.Errors++
+		return err
+	}
+	batch.commit = &commit
+	batch.target = packet.Target
+	return s.tryCommitBatch(batch)
+}
+
+// getBatch 获取或创建批次（调用时需持有batchMutex）
+func (s *Slave) getBatch(id string) (*stagedBatch, error) {
+	if batch, exists := s.batches[id]; exists {
+		batch.timer.Reset(s.batchTimeout())
+		return batch, nil
+	}
+
+	dir := filepath.Join(s.getConfig().SyncPath, stagingDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建暂存目录失败: %v", err)
+	}
+	batch := &stagedBatch{id: id, dir: dir, entries: make(map[string]*batchEntry)}
+	batch.timer = time.AfterFunc(s.batchTimeout(), func() { s.abortBatch(id) })
+	s.batches[id] = batch
+	log.Printf("开始接收批次: %s", id)
+	return batch, nil
+}
+
+// batchTimeout 获取批次的最长等待时间
+func (s *Slave) batchTimeout() time.Duration {
+	return s.getConfig().BatchTimeout.Duration()
+}
+
+// tryCommitBatch 收到提交且所有变更都已暂存时应用批次（调用时需持有batchMutex）
+func (s *Slave) tryCommitBatch(batch *stagedBatch) error {
+	if batch.commit == nil {
+		return nil
+	}
+	for _, path := range batch.commit.Entries {
+		if _, exists := batch.entries[path]; !exists {
+			return nil
+		}
+	}
+
+	batch.timer.Stop()
+	delete(s.batches, batch.id)
+	defer os.RemoveAll(batch.dir)
+
+	start := time.Now()
+	// 发布目录切换只作用于sync_path，其他目标的批次直接在目标目录中应用
+	var err error
+	if s.getConfig().BatchSwap && batch.target == "" {
+		err = s.swapRelease(batch)
+	} else {
+		err = s.applyBatch(batch)
+	}
+	if err != nil {
+		s.stats.Errors++
+		s.events.Publish(control.Event{Type: control.EventApplyFailed, Path: batch.target, Message: fmt.Sprintf("提交批次 %s 失败: %v", batch.id, err)})
+		return fmt.Errorf("提交批次 %s 失败: %v", batch.id, err)
+	}
+
+	s.stats.BatchesApplied++
+	log.Printf("批次 %s 已提交: %d 个变更, 耗时 %v", batch.id, len(batch.entries), time.Since(start))
+	s.events.Publish(control.Event{Type: control.EventBatch, Path: batch.target, Message: fmt.Sprintf("批次 %s 已提交，%d 个变更", batch.id, len(batch.entries))})
+	return nil
+}
+
+// abortBatch 丢弃超时未收齐的批次，并重新请求全量同步
+func (s *Slave) abortBatch(id string) {
+	s.batchMutex.Lock()
+	batch, exists := s.batches[id]
+	if exists {
+		delete(s.batches, id)
+		os.RemoveAll(batch.dir)
+	}
+	s.batchMutex.Unlock()
+	if !exists {
+		return
+	}
+
+	s.stats.BatchesAborted++
+	log.Printf("批次 %s 超时未收齐(%d 个变更)，已丢弃，重新请求全量同步", id, len(batch.entries))
+	s.events.Publish(control.Event{Type: control.EventBatch, Path: batch.target, Message: fmt.Sprintf("批次 %s 超时未收齐，已丢弃", id)})
+	if err := s.RequestFullSync(); err != nil {
+		log.Printf("请求全量同步失败: %v", err)
+	}
+}
+
+// clearStaging 清理上次运行遗留的暂存目录
+func (s *Slave) clearStaging() {
+	dir := filepath.Join(s.config.SyncPath, stagingDir)
+	if _, err := os.Stat(dir); err == nil {
+		os.RemoveAll(dir)
+		log.Printf("已清理遗留的批次暂存目录")
+	}
+}
+
+// sortedEntries 按应用顺序排列批次中的变更：先建目录，再写文件，最后删除（子项先于父目录）
+func (batch *stagedBatch) sortedEntries() []*batchEntry {
+	entries := make([]*batchEntry, 0, len(batch.entries))
+	for _, entry := range batch.entries {
+		entries = append(entries, entry)
+	}
+
+	rank := func(op string) int {
+		switch op {
+		case "MKDIR":
+			return 0
+		case "DELETE":
+			return 2
+		}
+		return 1
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].packet, entries[j].packet
+		if rank(a.Op) != rank(b.Op) {
+			return rank(a.Op) < rank(b.Op)
+		}
+		if a.Op == "DELETE" {
+			return a.Path > b.Path
+		}
+		return a.Path < b.Path
+	})
+	return entries
+}
+
+// applyBatch 在同步目录中依次应用批次的变更，文件通过重命名替换
+func (s *Slave) applyBatch(batch *stagedBatch) error {
+	rep := s.getReplica()
+
+	for _, entry := range batch.sortedEntries() {
+		packet := entry.packet
+		fullPath, err := s.resolvePath(packet)
+		if err != nil {
+			log.Printf("应用批次变更失败 %s %s: %v", packet.Op, packet.Path, err)
+			continue
+		}
+
+		// 双向同步时仍按版本向量逐个应用
+		if rep != nil && packet.Target == "" {
+			if entry.staged != "" {
+				content, err := ioutil.ReadFile(entry.staged)
+				if err != nil {
+					return fmt.Errorf("读取暂存文件失败 %s: %v", packet.Path, err)
+				}
+				packet.Content = content
+			}
+			if err := s.applyVersioned(rep, packet); err != nil {
+				log.Printf("应用批次变更失败 %s %s: %v", packet.Op, packet.Path, err)
+			}
+			continue
+		}
+
+		switch packet.Op {
+		case "MKDIR":
+			err = s.handleMkdir(fullPath)
+		case "DELETE":
+			err = s.handleDelete(fullPath)
+		default:
+			err = s.commitFile(fullPath, entry.staged)
+		}
+		if err != nil {
+			log.Printf("应用批次变更失败 %s %s: %v", packet.Op, packet.Path, err)
+		}
+	}
+	return nil
+}
+
+// commitFile 用暂存文件替换同步目录中的文件
+func (s *Slave) commitFile(fullPath, staged string) error {
+	dir := filepath.Dir(fullPath)
+	if err := s.ensureDir(dir); err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("创建目录失败 %s: %v", dir, err)
+	}
+
+	content, err := ioutil.ReadFile(staged)
+	if err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("读取暂存文件失败: %v", err)
+	}
+	op := "CREATE"
+	if existingContent, err := ioutil.ReadFile(fullPath); err == nil {
+		op = "MODIFY"
+		if string(existingContent) == string(content) {
+			return nil
+		}
+	}
+
+	// 覆盖前保存历史版本
+	s.backupFile(fullPath, false)
+
+	s.suppressLocal(fullPath, content, false)
+	if err := os.Rename(staged, fullPath); err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("替换文件失败 %s: %v", fullPath, err)
+	}
+
+	s.stats.AppliedFiles++
+	s.notifyHooks(op, fullPath, false)
+	return nil
+}
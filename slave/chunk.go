@@ -0,0 +1,106 @@
+package slave
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// chunkSuffix 分块传输的大文件先写入同目录下的隐藏临时文件（默认排除规则忽略隐藏文件），收齐后替换目标文件
+const chunkSuffix = ".xsync-part"
+
+// chunkTransfer 一个正在分块接收的大文件
+type chunkTransfer struct {
+	size     int64
+	modTime  int64
+	received map[int64]bool // 已写入的分块偏移，重发的分块不重复计数
+	total    int64
+}
+
+// handleChunk 写入大文件的一个分块，收齐所有分块后替换目标文件
+// 多个发送并发时分块可能乱序到达，按偏移写入临时文件
+func (s *Slave) handleChunk(fullPath string, packet *protocol.SyncPacket) error {
+	dir := filepath.Dir(fullPath)
+	if err := s.ensureDir(dir); err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("创建目录失败 %s: %v", dir, err)
+	}
+	partPath := filepath.Join(dir, "."+filepath.Base(fullPath)+chunkSuffix)
+
+	s.chunkMutex.Lock()
+	defer s.chunkMutex.Unlock()
+
+	transfer := s.chunks[fullPath]
+	flag := os.O_WRONLY
+	if transfer == nil || transfer.size != packet.Size || transfer.modTime != packet.ModTime {
+		// 新的传输（或文件变化后重新发送）从头写入
+		transfer = &chunkTransfer{size: packet.Size, modTime: packet.ModTime, received: make(map[int64]bool)}
+		s.chunks[fullPath] = transfer
+		flag |= os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		delete(s.chunks, fullPath)
+		s.stats.Errors++
+		return fmt.Errorf("创建临时文件失败 %s: %v", partPath, err)
+	}
+	_, err = file.WriteAt(packet.Content, packet.Offset)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		delete(s.chunks, fullPath)
+		s.stats.Errors++
+		return fmt.Errorf("写入分块失败 %s: %v", partPath, err)
+	}
+
+	if !transfer.received[packet.Offset] {
+		transfer.received[packet.Offset] = true
+		transfer.total += int64(len(packet.Content))
+	}
+	if transfer.total < transfer.size {
+		return nil
+	}
+	delete(s.chunks, fullPath)
+	return s.finishChunks(fullPath, partPath, transfer.size)
+}
+
+// finishChunks 用收齐的临时文件替换目标文件，内容未变化时丢弃临时文件
+func (s *Slave) finishChunks(fullPath, partPath string, size int64) error {
+	checksum, err := watcher.HashFile(partPath)
+	if err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("读取临时文件失败 %s: %v", partPath, err)
+	}
+
+	op := "CREATE"
+	if info, err := os.Stat(fullPath); err == nil {
+		op = "MODIFY"
+		if info.Size() == size {
+			if existing, err := watcher.HashFile(fullPath); err == nil && existing == checksum {
+				os.Remove(partPath)
+				log.Printf("文件内容未变化，跳过: %s", fullPath)
+				return nil
+			}
+		}
+	}
+
+	// 覆盖前保存历史版本
+	s.backupFile(fullPath, false)
+
+	s.suppressChecksum(fullPath, checksum, false)
+	if err := os.Rename(partPath, fullPath); err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("替换文件失败 %s: %v", fullPath, err)
+	}
+
+	s.stats.AppliedFiles++
+	log.Printf("文件同步成功: %s (%d bytes，分块传输)", fullPath, size)
+	s.notifyHooks(op, fullPath, false)
+	return nil
+}
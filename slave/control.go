@@ -0,0 +1,168 @@
+package slave
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// SetEvents 设置发布到本地控制接口的事件，需在Start前调用
+func (s *Slave) SetEvents(events *control.Publisher) {
+	s.events = events
+}
+
+// HandleControl 执行本地控制接口的命令，推送、比较和暂停等命令需在Master上执行
+func (s *Slave) HandleControl(command string, args []string) (interface{}, error) {
+	switch command {
+	case "status":
+		cfg := s.getConfig()
+		return &control.Status{NodeID: cfg.NodeID, Role: "slave", Stats: s.GetDetailedStats()}, nil
+	case "resync":
+		if len(args) > 0 {
+			return nil, fmt.Errorf("Slave上的resync不接受参数，请在Master上执行 resync <slave> <路径>")
+		}
+		if err := s.RequestFullSync(); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("已向Master %s 请求全量同步", s.getMasterAddr()), nil
+	case "push", "verify", "ls", "pause", "resume":
+		return nil, fmt.Errorf("%s 命令需在Master上执行", command)
+	default:
+		return nil, fmt.Errorf("Slave不支持的命令: %s", command)
+	}
+}
+
+// publishApply 发布Master发来的文件变更的应用结果，批次中的变更在提交时发布
+func (s *Slave) publishApply(packet *protocol.SyncPacket, remoteAddr string, err error) {
+	// 分块传输的大文件只在最后一块时发布
+	if packet.Batch != "" || (packet.IsChunk() && packet.Offset+int64(len(packet.Content)) < packet.Size) {
+		return
+	}
+	switch packet.Op {
+	case "CREATE", "MODIFY", "MKDIR", "DELETE":
+	default:
+		return
+	}
+
+	event := control.Event{Type: control.EventApply, Op: packet.Op, Path: packet.Path, Slave: remoteAddr}
+	if packet.Target != "" {
+		event.Path = packet.Target + ":" + packet.Path
+	}
+	if err != nil {
+		event.Type = control.EventApplyFailed
+		event.Message = err.Error()
+	}
+	s.events.Publish(event)
+}
+
+// handleQuery 处理Master的查询（LIST列出目录、VERIFY计算文件哈希）并回复
+func (s *Slave) handleQuery(packet *protocol.SyncPacket, replyAddr string) error {
+	var query protocol.Query
+	if err := packet.DecodeReport(&query); err != nil {
+		return err
+	}
+
+	cfg := s.getConfig()
+	reply := &protocol.QueryReply{ID: query.ID, NodeID: cfg.NodeID}
+	var err error
+	switch packet.Op {
+	case "LIST":
+		reply.Entries, err = s.listDir(packet.Target, query.Dir)
+	case "VERIFY":
+		reply.Hashes, err = s.hashFiles(packet.Target)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+
+	replyPacket, err := protocol.NewReportPacket("QUERY_REPLY", cfg.NodeID, reply)
+	if err != nil {
+		return err
+	}
+	if err := s.transport.Send(replyAddr, replyPacket); err != nil {
+		return fmt.Errorf("回复查询失败 %s: %v", replyAddr, err)
+	}
+	return nil
+}
+
+// listDir 列出目标中的目录，不包含xsync元数据目录
+func (s *Slave) listDir(target, dir string) ([]protocol.ListEntry, error) {
+	root, err := s.targetRoot(target)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" && dir != "." {
+		relPath, err := protocol.CleanPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		root = filepath.Join(root, filepath.FromSlash(relPath))
+	}
+
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("读取目录失败: %v", err)
+	}
+	entries := make([]protocol.ListEntry, 0, len(infos))
+	for _, info := range infos {
+		if info.Name() == watcher.MetaDir {
+			continue
+		}
+		entries = append(entries, protocol.ListEntry{
+			Name:    info.Name(),
+			Dir:     info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return entries, nil
+}
+
+// hashFiles 计算目标中所有文件的哈希，不包含xsync元数据目录
+func (s *Slave) hashFiles(target string) (map[string]string, error) {
+	root, err := s.targetRoot(target)
+	if err != nil {
+		return nil, err
+	}
+	// 发布目录切换模式下sync_path是符号链接
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]string)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() == watcher.MetaDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		hash, err := protocol.HashFile(path)
+		if err != nil {
+			log.Printf("计算文件哈希失败 %s: %v", path, err)
+			return nil
+		}
+		hashes[filepath.ToSlash(relPath)] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("遍历目录失败: %v", err)
+	}
+	return hashes, nil
+}
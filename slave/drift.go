@@ -0,0 +1,147 @@
+package slave
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"xsync/control"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// quarantineDir 隔离目录（相对同步目录）
+var quarantineDir = filepath.Join(watcher.MetaDir, "quarantine")
+
+// handleDrift 处理同步目录中的本地变更：报告给Master，并按策略隔离本地副本
+func (s *Slave) handleDrift(event *watcher.FileEvent) {
+	cfg := s.getConfig()
+	fullPath := filepath.Join(cfg.SyncPath, event.Path)
+
+	if s.isSuppressed(event, fullPath) {
+		return
+	}
+
+	s.stats.DriftDetected++
+	log.Printf("检测到本地变更: %s %s (策略 %s)", event.Op, event.Path, cfg.DriftPolicy)
+	s.events.Publish(control.Event{Type: control.EventDrift, Op: event.Op, Path: event.Path, Message: "策略 " + cfg.DriftPolicy})
+
+	if cfg.DriftPolicy == protocol.DriftQuarantine && event.Op != "DELETE" && !event.IsDir {
+		if err := s.quarantine(cfg.SyncPath, event.Path); err != nil {
+			log.Printf("隔离本地文件失败 %s: %v", event.Path, err)
+		}
+	}
+
+	report := protocol.DriftReport{
+		NodeID: cfg.NodeID,
+		Op:     event.Op,
+		Policy: cfg.DriftPolicy,
+		Time:   time.Now(),
+	}
+	packet, err := protocol.NewReportPacket("DRIFT", event.Path, report)
+	if err != nil {
+		log.Printf("创建偏差报告失败: %v", err)
+		return
+	}
+	if err := s.transport.Send(s.getMasterAddr(), packet); err != nil {
+		s.stats.Errors++
+		log.Printf("发送偏差报告失败 %s: %v", event.Path, err)
+	}
+}
+
+// isSuppressed 判断本地事件是否由同步写入引起
+func (s *Slave) isSuppressed(event *watcher.FileEvent, fullPath string) bool {
+	s.mutex.RLock()
+	suppressor := s.suppressor
+	s.mutex.RUnlock()
+	if suppressor == nil {
+		return false
+	}
+
+	var checksum uint32
+	deleted := event.Op == "DELETE"
+	if !deleted && !event.IsDir {
+		content, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return false
+		}
+		checksum = crc32.ChecksumIEEE(content)
+	}
+	return suppressor.Suppress(filepath.ToSlash(event.Path), checksum, deleted)
+}
+
+// quarantine 将本地文件移入隔离目录 .xsync/quarantine/<路径>.<时间>
+func (s *Slave) quarantine(syncPath, relPath string) error {
+	src := filepath.Join(syncPath, relPath)
+	dst := filepath.Join(syncPath, quarantineDir, relPath+"."+time.Now().Format("20060102-150405"))
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("创建隔离目录失败: %v", err)
+	}
+
+	s.suppressLocal(src, nil, true)
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("移动文件失败: %v", err)
+	}
+
+	s.stats.Quarantined++
+	log.Printf("本地文件已隔离: %s -> %s", relPath, dst)
+	return nil
+}
+
+// suppressLocal 登记即将进行的同步写入，避免被当作本地变更
+func (s *Slave) suppressLocal(fullPath string, content []byte, deleted bool) {
+	s.suppressChecksum(fullPath, crc32.ChecksumIEEE(content), deleted)
+}
+
+// suppressChecksum 与suppressLocal相同，使用已计算的内容校验和（分块传输的大文件不读入内存）
+func (s *Slave) suppressChecksum(fullPath string, checksum uint32, deleted bool) {
+	s.mutex.RLock()
+	suppressor, syncPath := s.suppressor, s.config.SyncPath
+	s.mutex.RUnlock()
+	if suppressor == nil {
+		return
+	}
+
+	relPath, err := filepath.Rel(syncPath, fullPath)
+	if err != nil {
+		return
+	}
+	suppressor.Add(filepath.ToSlash(relPath), checksum, deleted)
+}
+
+// suppressTree 登记即将删除的目录及其下所有文件
+func (s *Slave) suppressTree(dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			s.suppressLocal(path, nil, true)
+		}
+		return nil
+	})
+}
+
+// ensureDir 逐级创建目录，并登记新建的每一级目录
+func (s *Slave) ensureDir(dir string) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("路径已存在且不是目录: %s", dir)
+		}
+		return nil
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := s.ensureDir(parent); err != nil {
+			return err
+		}
+	}
+
+	s.suppressLocal(dir, nil, false)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
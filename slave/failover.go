@@ -0,0 +1,115 @@
+package slave
+
+import (
+	"log"
+
+	"xsync/config"
+	"xsync/protocol"
+	"xsync/transport"
+)
+
+// masterAddrs 获取配置的所有Master地址（master_addr在前，去除重复）
+func masterAddrs(cfg *config.Config) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, addr := range append([]string{cfg.MasterAddr}, cfg.MasterAddrs...) {
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// getMasterAddr 获取当前跟随的Master地址，尚未收到带任期的数据包时使用配置的第一个地址
+func (s *Slave) getMasterAddr() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.masterAddrLocked()
+}
+
+// masterAddrLocked 获取当前跟随的Master地址（调用方持有锁）
+func (s *Slave) masterAddrLocked() string {
+	if s.masterAddr != "" {
+		return s.masterAddr
+	}
+	if addrs := masterAddrs(s.config); len(addrs) > 0 {
+		return addrs[0]
+	}
+	return ""
+}
+
+// resetMaster 清除已知的Master和任期（Master地址配置变更时）
+func (s *Slave) resetMaster() {
+	s.mutex.Lock()
+	s.masterAddr = ""
+	s.masterEpoch = 0
+	s.mutex.Unlock()
+}
+
+// getEpochStats 获取已知的Master任期和被拒绝的过期数据包数
+func (s *Slave) getEpochStats() (uint64, int64) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.masterEpoch, s.fenced
+}
+
+// checkEpoch 检查上游数据包携带的Master任期，返回false表示数据包应被丢弃
+// 任期小于已知任期（或同一任期但不是当前跟随的Master）的数据包来自已被取代的Master，拒绝并告知对方当前任期；
+// 任期更新时改为跟随发送方，并重新全量同步以补齐切换期间可能丢失的变更
+func (s *Slave) checkEpoch(packet *protocol.SyncPacket, remoteAddr string) bool {
+	if packet.Epoch == 0 {
+		return true
+	}
+	sender := transport.ReplyAddr(packet, remoteAddr)
+
+	s.mutex.Lock()
+	current, previous := s.masterEpoch, s.masterAddrLocked()
+	if packet.Epoch < current || (packet.Epoch == current && sender != previous) {
+		// 同一任期出现两个Master（网络分区时各自接管）时跟随先收到的一个
+		s.fenced++
+		s.mutex.Unlock()
+		log.Printf("拒绝过期Master的数据包: %s %s from %s (任期 %d，当前 %s 任期 %d)", packet.Op, packet.Path, sender, packet.Epoch, previous, current)
+		go s.sendFence(sender, current, previous)
+		return false
+	}
+	if packet.Epoch == current {
+		s.mutex.Unlock()
+		return true
+	}
+	s.masterEpoch = packet.Epoch
+	s.masterAddr = sender
+	s.mutex.Unlock()
+
+	// 启动后首次得知任期：全量同步请求已经发给了所有Master，正在接收的就是其结果；
+	// 但主备Master都未就绪时请求会被忽略，因此接管通知（HEARTBEAT）仍然触发全量同步
+	if current == 0 && packet.Op != "HEARTBEAT" {
+		if sender != previous {
+			log.Printf("跟随Master: %s (任期 %d)", sender, packet.Epoch)
+		}
+		return true
+	}
+
+	log.Printf("Master任期已更新: %d -> %d，跟随 %s", current, packet.Epoch, sender)
+	go func() {
+		if err := s.RequestFullSync(); err != nil {
+			log.Printf("请求全量同步失败: %v", err)
+		}
+	}()
+	return true
+}
+
+// sendFence 告知过期的Master当前任期，使其停止发送并转为备用
+func (s *Slave) sendFence(addr string, epoch uint64, masterAddr string) {
+	cfg := s.getConfig()
+	fence := protocol.Fence{NodeID: cfg.NodeID, Epoch: epoch, Master: masterAddr}
+	packet, err := protocol.NewReportPacket("FENCE", cfg.NodeID, fence)
+	if err != nil {
+		log.Printf("创建FENCE数据包失败: %v", err)
+		return
+	}
+	if err := s.transport.Send(addr, packet); err != nil {
+		log.Printf("发送FENCE到 %s 失败: %v", addr, err)
+	}
+}
@@ -0,0 +1,103 @@
+package slave
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"xsync/config"
+	"xsync/control"
+	"xsync/hook"
+	"xsync/protocol"
+)
+
+// startHooks 创建同步后钩子执行器
+func (s *Slave) startHooks(cfg *config.Config) error {
+	runner, err := s.newHooks(cfg)
+	if err != nil || runner == nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.hooks = runner
+	s.mutex.Unlock()
+
+	log.Printf("启用同步后钩子: %d 个", len(cfg.Hooks))
+	return nil
+}
+
+// newHooks 按配置创建同步后钩子执行器，未配置钩子时返回nil
+func (s *Slave) newHooks(cfg *config.Config) (*hook.Runner, error) {
+	if len(cfg.Hooks) == 0 {
+		return nil, nil
+	}
+	return hook.NewRunner(cfg.SyncPath, cfg.NodeID, cfg.Hooks, s.handleHookResult)
+}
+
+// stopHooks 停止同步后钩子执行器
+func (s *Slave) stopHooks() {
+	s.mutex.Lock()
+	runner := s.hooks
+	s.hooks = nil
+	s.mutex.Unlock()
+
+	if runner != nil {
+		runner.Stop()
+	}
+}
+
+// notifyHooks 通知钩子执行器一个已写入本地的变更
+func (s *Slave) notifyHooks(op, fullPath string, isDir bool) {
+	s.mutex.RLock()
+	runner, syncPath := s.hooks, s.config.SyncPath
+	s.mutex.RUnlock()
+	if runner == nil {
+		return
+	}
+
+	relPath, ok := relPathIn(syncPath, fullPath)
+	if !ok {
+		return
+	}
+	runner.Notify(op, filepath.ToSlash(relPath), isDir)
+}
+
+// handleHookResult 记录钩子执行结果，失败时报告给Master
+func (s *Slave) handleHookResult(result *hook.Result) {
+	s.stats.HooksRun++
+	if result.Err == nil {
+		log.Printf("钩子 %s 执行完成: %d 个变更, 耗时 %v", result.Hook, len(result.Changes), result.Duration)
+		return
+	}
+
+	s.stats.HookFailures++
+	log.Printf("钩子 %s 执行失败: %v, 输出: %s", result.Hook, result.Err, result.Output)
+	s.events.Publish(control.Event{Type: control.EventHookFailed, Path: result.Hook, Message: result.Err.Error()})
+
+	cfg := s.getConfig()
+	report := protocol.HookReport{
+		NodeID:   cfg.NodeID,
+		Hook:     result.Hook,
+		Total:    len(result.Changes),
+		Error:    result.Err.Error(),
+		Output:   result.Output,
+		Duration: result.Duration.Milliseconds(),
+		Time:     time.Now(),
+	}
+	for i, change := range result.Changes {
+		if i >= protocol.MaxReportPaths {
+			break
+		}
+		report.Paths = append(report.Paths, change.Path)
+	}
+
+	packet, err := protocol.NewReportPacket("HOOK_REPORT", result.Hook, report)
+	if err != nil {
+		log.Printf("创建钩子报告失败: %v", err)
+		return
+	}
+	if err := s.transport.Send(s.getMasterAddr(), packet); err != nil {
+		s.stats.Errors++
+		log.Printf("发送钩子报告失败 %s: %v", result.Hook, err)
+	}
+}
@@ -0,0 +1,216 @@
+package slave
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// handleManifest 镜像模式下根据Master的文件清单清理多余的本地文件
+func (s *Slave) handleManifest(packet *protocol.SyncPacket) error {
+	cfg := s.getConfig()
+	if !cfg.Mirror {
+		return nil
+	}
+
+	var manifest protocol.Manifest
+	if err := packet.DecodeReport(&manifest); err != nil {
+		return err
+	}
+
+	// 清单只描述其目标对应的目录
+	root, err := s.targetRoot(packet.Target)
+	if err != nil {
+		return err
+	}
+
+	local, err := s.getLocalFileList(root)
+	if err != nil {
+		return fmt.Errorf("获取本地文件列表失败: %v", err)
+	}
+
+	// 默认排除规则、本地.xsyncignore和Master的过滤规则排除的文件受保护，不会被清理
+	protect, err := newMirrorProtection(root, &manifest)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(manifest.Files))
+	for _, path := range manifest.Files {
+		keep[path] = true
+	}
+
+	// 同步后的目录树为清单与本地文件的并集（清单中的文件可能尚未写入）
+	requestedAt := s.getSyncRequestedAt()
+	total := len(keep)
+	var extra []string
+	for path := range local {
+		if keep[path] {
+			continue
+		}
+		total++
+		if protect.protected(path, false) {
+			continue
+		}
+		// 请求全量同步之后写入的文件可能是清单生成后Master新建的，保留
+		if info, err := os.Lstat(filepath.Join(root, path)); err != nil || info.ModTime().After(requestedAt) {
+			continue
+		}
+		extra = append(extra, path)
+	}
+	sort.Strings(extra)
+
+	if len(extra) > 0 {
+		maxDelete := cfg.MirrorMaxDelete
+		if len(extra)*100 > total*maxDelete {
+			s.stats.MirrorAborted++
+			return fmt.Errorf("镜像清理已中止: 需要删除 %d/%d 个文件，超过阈值 %d%%", len(extra), total, maxDelete)
+		}
+
+		trashDir := ""
+		if cfg.MirrorTrash {
+			trashDir = filepath.Join(root, watcher.MetaDir, "trash", time.Now().Format("20060102-150405"))
+		}
+		for _, path := range extra {
+			if err := s.removeExtraneous(root, path, trashDir); err != nil {
+				s.stats.Errors++
+				log.Printf("清理多余文件失败 %s: %v", path, err)
+				continue
+			}
+			s.stats.MirrorDeleted++
+		}
+	}
+
+	s.removeExtraDirs(root, manifest.Dirs, protect)
+
+	log.Printf("镜像清理完成: %s, 清单 %d 个文件, 清理 %d 个多余文件", root, len(manifest.Files), len(extra))
+	return nil
+}
+
+// mirrorProtection 镜像清理时受保护的路径
+type mirrorProtection struct {
+	local    *watcher.Filter   // 默认排除规则和本地.xsyncignore
+	master   []*watcher.Filter // Master各监控路径的include/exclude规则
+	excluded map[string]bool   // Master遍历时排除的路径
+}
+
+// newMirrorProtection 按清单携带的Master过滤规则创建镜像清理的保护规则
+func newMirrorProtection(root string, manifest *protocol.Manifest) (*mirrorProtection, error) {
+	local, err := watcher.NewFilter(root, watcher.FilterConfig{})
+	if err != nil {
+		return nil, err
+	}
+	p := &mirrorProtection{local: local, excluded: make(map[string]bool, len(manifest.Excluded))}
+	for _, mf := range manifest.Filters {
+		filter, err := watcher.NewFilter(root, watcher.FilterConfig{Include: mf.Include, Exclude: mf.Exclude})
+		if err != nil {
+			return nil, fmt.Errorf("Master的过滤规则无效: %v", err)
+		}
+		p.master = append(p.master, filter)
+	}
+	for _, path := range manifest.Excluded {
+		p.excluded[path] = true
+	}
+	return p, nil
+}
+
+// protected 判断路径是否受保护：被本地规则、Master的过滤规则排除，或自身及上级目录在Master遍历时被排除
+func (p *mirrorProtection) protected(relPath string, isDir bool) bool {
+	if p.local.Excluded(relPath, isDir) {
+		return true
+	}
+	for _, filter := range p.master {
+		if isDir && filter.Excluded(relPath, true) || !isDir && !filter.Match(relPath, nil) {
+			return true
+		}
+	}
+	for path := relPath; path != "." && path != "/"; path = filepath.ToSlash(filepath.Dir(path)) {
+		if p.excluded[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExtraneous 删除多余文件，配置了回收目录时移入回收目录
+func (s *Slave) removeExtraneous(syncPath, relPath, trashDir string) error {
+	fullPath := filepath.Join(syncPath, relPath)
+	s.suppressLocal(fullPath, nil, true)
+
+	if trashDir == "" {
+		s.backupFile(fullPath, true)
+		if err := os.Remove(fullPath); err != nil {
+			return err
+		}
+		log.Printf("删除多余文件: %s", relPath)
+		s.notifyHooks("DELETE", fullPath, false)
+		return nil
+	}
+
+	dst := filepath.Join(trashDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("创建回收目录失败: %v", err)
+	}
+	if err := os.Rename(fullPath, dst); err != nil {
+		return err
+	}
+	log.Printf("多余文件移入回收目录: %s -> %s", relPath, dst)
+	s.notifyHooks("DELETE", fullPath, false)
+	return nil
+}
+
+// removeExtraDirs 删除Master清单中不存在的空目录（子目录先于父目录）
+func (s *Slave) removeExtraDirs(syncPath string, dirs []string, protect *mirrorProtection) {
+	keep := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		keep[dir] = true
+	}
+
+	// sync_path可能是指向发布目录的符号链接
+	root, err := filepath.EvalSymlinks(syncPath)
+	if err != nil {
+		return
+	}
+
+	var extra []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == "." {
+			return nil
+		}
+		relPath = strings.ReplaceAll(relPath, "\\", "/")
+		if protect.protected(relPath, true) {
+			return filepath.SkipDir
+		}
+		if !keep[relPath] {
+			extra = append(extra, relPath)
+		}
+		return nil
+	})
+
+	sort.Sort(sort.Reverse(sort.StringSlice(extra)))
+	for _, relPath := range extra {
+		fullPath := filepath.Join(syncPath, relPath)
+		s.suppressLocal(fullPath, nil, true)
+		if err := os.Remove(fullPath); err == nil {
+			log.Printf("删除多余的空目录: %s", relPath)
+		}
+	}
+}
+
+// getSyncRequestedAt 获取最近一次请求全量同步的时间
+func (s *Slave) getSyncRequestedAt() time.Time {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.syncRequestedAt
+}
@@ -0,0 +1,508 @@
+package slave
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/config"
+	"xsync/protocol"
+	"xsync/watcher"
+)
+
+// 中继的默认值
+const (
+	relayQueueSize        = 1024             // 每个下游Slave排队的数据包上限
+	relaySendRetries      = 3                // 发送到下游的重试次数
+	relayReadyTimeout     = 5 * time.Minute  // 未收到上游文件清单时最长推迟下游全量同步的时间
+	relayHeartbeatTimeout = 90 * time.Second // 超过此时间未收到下游心跳时标记为不可用（心跳间隔30秒）
+)
+
+// relayTarget 一个下游Slave：数据包按顺序逐个发送
+type relayTarget struct {
+	addr  string
+	queue chan *protocol.SyncPacket
+	stop  chan struct{}
+
+	mutex   sync.Mutex
+	status  protocol.DownstreamStatus
+	lost    bool // 有数据包被丢弃，下游恢复后需要全量同步
+	syncing bool // 正在进行全量同步
+	pending bool // 下游请求了全量同步，等待本节点完成自身的全量同步
+}
+
+// relayState 中继的运行状态
+type relayState struct {
+	mutex     sync.Mutex
+	targets   map[string]*relayTarget
+	ready     bool                      // 已收到上游的文件清单，本地目录树完整
+	filters   []protocol.ManifestFilter // 上游清单中Master的过滤规则，随本节点的清单转发给下游
+	requested time.Time                 // 最近一次向上游请求全量同步的时间
+	stop      chan struct{}
+	interval  time.Duration
+}
+
+// startRelay 按relay_slaves创建下游队列，保留已有下游的队列和状态
+func (s *Slave) startRelay(cfg *config.Config) {
+	r := s.relay
+
+	r.mutex.Lock()
+	wanted := make(map[string]bool, len(cfg.RelaySlaves))
+	for _, addr := range cfg.RelaySlaves {
+		wanted[addr] = true
+		if _, exists := r.targets[addr]; exists {
+			continue
+		}
+		target := &relayTarget{
+			addr:   addr,
+			queue:  make(chan *protocol.SyncPacket, relayQueueSize),
+			stop:   make(chan struct{}),
+			status: protocol.DownstreamStatus{Addr: addr, Healthy: true},
+		}
+		r.targets[addr] = target
+		go s.runRelayTarget(target)
+		log.Printf("启用中继下游Slave: %s", addr)
+	}
+	for addr, target := range r.targets {
+		if !wanted[addr] {
+			close(target.stop)
+			delete(r.targets, addr)
+			log.Printf("移除中继下游Slave: %s", addr)
+		}
+	}
+
+	interval := cfg.RelayReportInterval.Duration()
+	restartReports := r.stop == nil || interval != r.interval || len(r.targets) == 0
+	if restartReports && r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	if restartReports && len(r.targets) > 0 {
+		r.stop = make(chan struct{})
+		r.interval = interval
+		go s.runRelayReports(r.stop, interval)
+	}
+	r.mutex.Unlock()
+}
+
+// stopRelay 停止所有下游队列和状态报告
+func (s *Slave) stopRelay() {
+	r := s.relay
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for addr, target := range r.targets {
+		close(target.stop)
+		delete(r.targets, addr)
+	}
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// getRelayTarget 获取下游Slave，不是下游时返回nil
+func (s *Slave) getRelayTarget(addr string) *relayTarget {
+	s.relay.mutex.Lock()
+	defer s.relay.mutex.Unlock()
+	return s.relay.targets[addr]
+}
+
+// getRelayTargets 获取所有下游Slave
+func (s *Slave) getRelayTargets() []*relayTarget {
+	s.relay.mutex.Lock()
+	defer s.relay.mutex.Unlock()
+
+	targets := make([]*relayTarget, 0, len(s.relay.targets))
+	for _, target := range s.relay.targets {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].addr < targets[j].addr })
+	return targets
+}
+
+// relayPacket 将已应用的上游数据包转发给所有下游Slave
+// 队列已满时丢弃并标记该下游，下游恢复后通过全量同步补齐
+func (s *Slave) relayPacket(packet *protocol.SyncPacket) {
+	switch packet.Op {
+	case "CREATE", "MODIFY", "DELETE", "MKDIR", "MANIFEST", "BATCH_COMMIT":
+	default:
+		return
+	}
+
+	if packet.Op == "MANIFEST" {
+		var manifest protocol.Manifest
+		if err := packet.DecodeReport(&manifest); err == nil && packet.Target == "" {
+			s.relay.mutex.Lock()
+			s.relay.filters = manifest.Filters
+			s.relay.mutex.Unlock()
+		}
+		s.setRelayReady(true)
+	}
+
+	for _, target := range s.getRelayTargets() {
+		select {
+		case target.queue <- packet:
+		default:
+			target.mutex.Lock()
+			target.status.Dropped++
+			if !target.lost {
+				log.Printf("中继队列已满，丢弃发往 %s 的数据包，恢复后重新全量同步", target.addr)
+			}
+			target.lost = true
+			target.mutex.Unlock()
+		}
+	}
+}
+
+// runRelayTarget 按顺序将队列中的数据包发送给下游Slave
+func (s *Slave) runRelayTarget(target *relayTarget) {
+	for {
+		select {
+		case packet := <-target.queue:
+			s.relaySend(target, packet)
+		case <-target.stop:
+			return
+		}
+	}
+}
+
+// relaySend 发送一个数据包到下游，多次失败后将下游标记为不可用
+// 不可用期间的数据包直接丢弃，下游的心跳或全量同步请求到达后重新全量同步
+func (s *Slave) relaySend(target *relayTarget, packet *protocol.SyncPacket) {
+	target.mutex.Lock()
+	healthy := target.status.Healthy
+	if !healthy {
+		target.status.Dropped++
+		target.lost = true
+	}
+	target.mutex.Unlock()
+	if !healthy {
+		return
+	}
+
+	var err error
+	for attempt := 1; attempt <= relaySendRetries; attempt++ {
+		if err = s.transport.Send(target.addr, packet); err == nil {
+			break
+		}
+		if attempt < relaySendRetries {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+
+	target.mutex.Lock()
+	if err == nil {
+		target.status.Sent++
+		target.status.LastSent = time.Now()
+		target.mutex.Unlock()
+		return
+	}
+	target.status.Failed++
+	target.status.LastError = err.Error()
+	target.status.Healthy = false
+	target.lost = true
+	target.mutex.Unlock()
+
+	log.Printf("转发到下游Slave失败，标记为不可用: %s: %v", target.addr, err)
+	go s.sendRelayReport()
+}
+
+// handleDownstreamPacket 处理下游Slave发来的请求和报告
+func (s *Slave) handleDownstreamPacket(target *relayTarget, packet *protocol.SyncPacket) error {
+	target.mutex.Lock()
+	target.status.LastSeen = time.Now()
+	if packet.Op == "HEARTBEAT" || packet.Op == "SYNC_REQUEST" {
+		target.status.NodeID = packet.Path
+	}
+	recovering := !target.status.Healthy || target.lost
+	target.mutex.Unlock()
+
+	switch packet.Op {
+	case "SYNC_REQUEST":
+		log.Printf("下游Slave %s 请求全量同步", target.addr)
+		s.relayFullSync(target)
+		return nil
+	case "HEARTBEAT":
+		if recovering {
+			log.Printf("下游Slave %s 已恢复，重新全量同步", target.addr)
+			s.relayFullSync(target)
+		}
+		return nil
+	case "DRIFT":
+		return s.repairDownstreamDrift(target, packet)
+	case "HOOK_REPORT", "RELAY_REPORT":
+		// 钩子失败和下一级中继的状态原样报告给上游
+		return s.transport.Send(s.getMasterAddr(), packet)
+	default:
+		return fmt.Errorf("拒绝来自下游 %s 的数据包: %s %s", target.addr, packet.Op, packet.Path)
+	}
+}
+
+// repairDownstreamDrift 用本地版本修复下游的本地变更，不经过上游
+func (s *Slave) repairDownstreamDrift(target *relayTarget, packet *protocol.SyncPacket) error {
+	var report protocol.DriftReport
+	if err := packet.DecodeReport(&report); err != nil {
+		return err
+	}
+	relPath, err := protocol.CleanPath(packet.Path)
+	if err != nil {
+		return err
+	}
+
+	target.mutex.Lock()
+	target.status.Drifts++
+	target.mutex.Unlock()
+	log.Printf("下游Slave %s(%s) 报告本地变更: %s %s (策略 %s)", target.addr, report.NodeID, report.Op, relPath, report.Policy)
+	if report.Policy == protocol.DriftAlert {
+		return nil
+	}
+
+	fullPath := filepath.Join(s.getConfig().SyncPath, filepath.FromSlash(relPath))
+	info, err := os.Stat(fullPath)
+	var repair *protocol.SyncPacket
+	switch {
+	case err != nil:
+		repair = protocol.NewSyncPacket("DELETE", relPath, nil)
+	case info.IsDir():
+		repair = protocol.NewSyncPacket("MKDIR", relPath, nil)
+	default:
+		content, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return fmt.Errorf("读取文件失败 %s: %v", relPath, err)
+		}
+		repair = protocol.NewSyncPacket("CREATE", relPath, content)
+	}
+
+	select {
+	case target.queue <- repair:
+	case <-target.stop:
+	}
+	return nil
+}
+
+// relayFullSync 将本地目录树全量同步给下游Slave，完成后发送文件清单
+// 本节点尚未完成自身的全量同步时推迟，避免下游按不完整的清单删除文件
+func (s *Slave) relayFullSync(target *relayTarget) {
+	ready := s.relayReady()
+
+	target.mutex.Lock()
+	if target.syncing {
+		target.mutex.Unlock()
+		return
+	}
+	if !ready {
+		target.pending = true
+		target.mutex.Unlock()
+		log.Printf("本节点的全量同步尚未完成，推迟下游Slave %s 的全量同步", target.addr)
+		return
+	}
+	target.syncing, target.pending = true, false
+	// 队列中的数据包都会重新发送，丢弃记录清零
+	target.status.Healthy, target.lost = true, false
+	target.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			target.mutex.Lock()
+			target.syncing = false
+			target.mutex.Unlock()
+		}()
+
+		start := time.Now()
+		files, err := s.relayTree(target)
+		if err != nil {
+			log.Printf("向下游Slave %s 全量同步失败: %v", target.addr, err)
+			return
+		}
+
+		target.mutex.Lock()
+		target.status.FullSyncs++
+		target.mutex.Unlock()
+		log.Printf("已向下游Slave %s 发送全量同步: %d 个文件, 耗时 %v", target.addr, files, time.Since(start))
+	}()
+}
+
+// relayTree 遍历同步目录，将所有文件和清单加入下游队列，返回文件数
+func (s *Slave) relayTree(target *relayTarget) (int, error) {
+	syncPath, err := filepath.EvalSymlinks(s.getConfig().SyncPath)
+	if err != nil {
+		return 0, err
+	}
+
+	enqueue := func(packet *protocol.SyncPacket) error {
+		select {
+		case target.queue <- packet:
+			return nil
+		case <-target.stop:
+			return fmt.Errorf("下游已移除")
+		}
+	}
+
+	// 转发Master的过滤规则，下游镜像清理时同样保留被排除的文件
+	s.relay.mutex.Lock()
+	manifest := &protocol.Manifest{Filters: s.relay.filters}
+	s.relay.mutex.Unlock()
+	err = filepath.Walk(syncPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// 跳过xsync元数据目录（发布目录切换模式下是符号链接）
+		if info.Name() == watcher.MetaDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(syncPath, path)
+		if err != nil {
+			return err
+		}
+		relPath = strings.ReplaceAll(relPath, "\\", "/")
+		if relPath == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			manifest.Dirs = append(manifest.Dirs, relPath)
+			return enqueue(protocol.NewSyncPacket("MKDIR", relPath, nil))
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		manifest.Files = append(manifest.Files, relPath)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("读取文件失败 %s: %v", path, err)
+			return nil
+		}
+		return enqueue(protocol.NewSyncPacket("CREATE", relPath, content))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	packet, err := protocol.NewReportPacket("MANIFEST", s.getConfig().NodeID, manifest)
+	if err != nil {
+		return 0, err
+	}
+	return len(manifest.Files), enqueue(packet)
+}
+
+// relayReady 检查本地目录树是否完整，可以作为下游的全量同步来源
+func (s *Slave) relayReady() bool {
+	s.relay.mutex.Lock()
+	defer s.relay.mutex.Unlock()
+	return s.relay.ready || time.Since(s.relay.requested) >= relayReadyTimeout
+}
+
+// setRelayReady 记录本节点全量同步的状态，完成时开始推迟的下游全量同步
+func (s *Slave) setRelayReady(ready bool) {
+	s.relay.mutex.Lock()
+	s.relay.ready = ready
+	if !ready {
+		s.relay.requested = time.Now()
+	}
+	s.relay.mutex.Unlock()
+
+	if ready {
+		s.startPendingRelaySyncs()
+	}
+}
+
+// startPendingRelaySyncs 开始被推迟的下游全量同步
+func (s *Slave) startPendingRelaySyncs() {
+	if !s.relayReady() {
+		return
+	}
+	for _, target := range s.getRelayTargets() {
+		target.mutex.Lock()
+		pending := target.pending
+		target.mutex.Unlock()
+		if pending {
+			s.relayFullSync(target)
+		}
+	}
+}
+
+// runRelayReports 定期向上游报告下游Slave的状态
+func (s *Slave) runRelayReports(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkRelayHeartbeats()
+			s.startPendingRelaySyncs()
+			s.sendRelayReport()
+		case <-stop:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// checkRelayHeartbeats 将长时间没有心跳的下游标记为不可用
+// 连接失效后发送可能仍显示成功，心跳超时时之后的变更不再发送，下游恢复后全量同步
+func (s *Slave) checkRelayHeartbeats() {
+	for _, target := range s.getRelayTargets() {
+		target.mutex.Lock()
+		lastSeen := target.status.LastSeen
+		expired := target.status.Healthy && !lastSeen.IsZero() && time.Since(lastSeen) > relayHeartbeatTimeout
+		if expired {
+			target.status.Healthy = false
+			target.status.LastError = fmt.Sprintf("超过 %v 未收到心跳", relayHeartbeatTimeout)
+			target.lost = true
+		}
+		target.mutex.Unlock()
+		if expired {
+			log.Printf("下游Slave心跳超时，标记为不可用: %s (最近心跳 %s)", target.addr, lastSeen.Format(time.RFC3339))
+		}
+	}
+}
+
+// getRelayStatus 获取所有下游Slave的状态
+func (s *Slave) getRelayStatus() []protocol.DownstreamStatus {
+	targets := s.getRelayTargets()
+	statuses := make([]protocol.DownstreamStatus, 0, len(targets))
+	for _, target := range targets {
+		target.mutex.Lock()
+		status := target.status
+		target.mutex.Unlock()
+		status.Queued = len(target.queue)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// sendRelayReport 向上游发送下游Slave的状态报告
+func (s *Slave) sendRelayReport() {
+	statuses := s.getRelayStatus()
+	if len(statuses) == 0 {
+		return
+	}
+
+	cfg := s.getConfig()
+	s.relay.mutex.Lock()
+	interval := s.relay.interval
+	s.relay.mutex.Unlock()
+
+	report := protocol.RelayReport{NodeID: cfg.NodeID, Interval: int(interval / time.Second), Downstream: statuses, Time: time.Now()}
+	packet, err := protocol.NewReportPacket("RELAY_REPORT", cfg.NodeID, report)
+	if err != nil {
+		log.Printf("创建中继报告失败: %v", err)
+		return
+	}
+	if err := s.transport.Send(s.getMasterAddr(), packet); err != nil {
+		log.Printf("发送中继报告失败: %v", err)
+	}
+}
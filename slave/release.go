@@ -0,0 +1,208 @@
+package slave
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"xsync/watcher"
+)
+
+// releasesDir 获取发布目录的存放位置：sync_path旁的 <名称>.releases
+// 各发布目录中的.xsync是指向其中共享.xsync的符号链接，历史版本和快照不随发布切换
+func releasesDir(syncPath string) string {
+	return filepath.Clean(syncPath) + ".releases"
+}
+
+// prepareReleases 确保sync_path是指向发布目录的符号链接
+// sync_path是普通目录时整体移动为第一个发布目录
+func prepareReleases(syncPath string) error {
+	syncPath = filepath.Clean(syncPath)
+	releases := releasesDir(syncPath)
+	if err := os.MkdirAll(filepath.Join(releases, watcher.MetaDir), 0755); err != nil {
+		return fmt.Errorf("创建发布目录失败: %v", err)
+	}
+
+	info, err := os.Lstat(syncPath)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err == nil && !info.IsDir() {
+		return fmt.Errorf("sync_path已存在且不是目录: %s", syncPath)
+	}
+
+	release := filepath.Join(releases, time.Now().Format("20060102-150405.000000"))
+	if err == nil {
+		// 原有的元数据移到共享位置
+		meta := filepath.Join(syncPath, watcher.MetaDir)
+		if _, err := os.Stat(meta); err == nil {
+			os.RemoveAll(filepath.Join(releases, watcher.MetaDir))
+			if err := os.Rename(meta, filepath.Join(releases, watcher.MetaDir)); err != nil {
+				return fmt.Errorf("移动元数据目录失败: %v", err)
+			}
+		}
+		if err := os.Rename(syncPath, release); err != nil {
+			return fmt.Errorf("移动同步目录失败: %v", err)
+		}
+		log.Printf("启用发布目录切换: %s 已移动到 %s", syncPath, release)
+	} else if err := os.Mkdir(release, 0755); err != nil {
+		return fmt.Errorf("创建发布目录失败: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Join("..", watcher.MetaDir), filepath.Join(release, watcher.MetaDir)); err != nil {
+		return fmt.Errorf("创建元数据链接失败: %v", err)
+	}
+	return switchRelease(syncPath, release)
+}
+
+// switchRelease 原子地将sync_path符号链接指向新的发布目录
+func switchRelease(syncPath, release string) error {
+	target, err := filepath.Rel(filepath.Dir(syncPath), release)
+	if err != nil {
+		return err
+	}
+
+	tmpLink := syncPath + ".tmp"
+	os.Remove(tmpLink)
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return fmt.Errorf("创建符号链接失败: %v", err)
+	}
+	if err := os.Rename(tmpLink, syncPath); err != nil {
+		os.Remove(tmpLink)
+		return fmt.Errorf("切换符号链接失败: %v", err)
+	}
+	return nil
+}
+
+// swapRelease 复制当前发布目录，应用批次后切换sync_path，旧发布目录按batch_swap_keep保留
+func (s *Slave) swapRelease(batch *stagedBatch) error {
+	cfg := s.getConfig()
+	syncPath := filepath.Clean(cfg.SyncPath)
+
+	current, err := filepath.EvalSymlinks(syncPath)
+	if err != nil {
+		return fmt.Errorf("解析当前发布目录失败: %v", err)
+	}
+	release := filepath.Join(releasesDir(syncPath), batch.id)
+	if err := copyTree(current, release); err != nil {
+		os.RemoveAll(release)
+		return fmt.Errorf("复制发布目录失败: %v", err)
+	}
+
+	entries := batch.sortedEntries()
+	for _, entry := range entries {
+		target := filepath.Join(release, entry.packet.Path)
+		switch entry.packet.Op {
+		case "MKDIR":
+			err = os.MkdirAll(target, 0755)
+		case "DELETE":
+			err = os.RemoveAll(target)
+		default:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Rename(entry.staged, target)
+			}
+		}
+		if err != nil {
+			os.RemoveAll(release)
+			return fmt.Errorf("应用变更失败 %s %s: %v", entry.packet.Op, entry.packet.Path, err)
+		}
+	}
+
+	if err := switchRelease(syncPath, release); err != nil {
+		os.RemoveAll(release)
+		return err
+	}
+	log.Printf("已切换发布目录: %s -> %s", syncPath, release)
+
+	for _, entry := range entries {
+		s.stats.AppliedFiles++
+		s.notifyHooks(entry.packet.Op, filepath.Join(syncPath, entry.packet.Path), entry.packet.Op == "MKDIR")
+	}
+	s.pruneReleases(syncPath, release)
+	return nil
+}
+
+// pruneReleases 删除超出batch_swap_keep的旧发布目录
+func (s *Slave) pruneReleases(syncPath, current string) {
+	keep := s.getConfig().BatchSwapKeep
+
+	releases := releasesDir(syncPath)
+	infos, err := ioutil.ReadDir(releases)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() && info.Name() != watcher.MetaDir {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for i := 0; i < len(names)-keep; i++ {
+		dir := filepath.Join(releases, names[i])
+		if dir == current {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("删除旧发布目录失败 %s: %v", dir, err)
+			continue
+		}
+		log.Printf("已删除旧发布目录: %s", dir)
+	}
+}
+
+// copyTree 复制目录树，保留文件权限和修改时间，符号链接按原样复制
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
+}
+
+// copyFile 复制单个文件
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -6,56 +6,58 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
+	"xsync/backup"
+	"xsync/config"
+	"xsync/control"
+	"xsync/hook"
 	"xsync/protocol"
+	"xsync/replica"
+	"xsync/snapshot"
 	"xsync/transport"
+	"xsync/watcher"
+	"xsync/webserver"
 )
 
-// Config 配置结构（从main包导入的类型定义）
-type Config struct {
-	NodeID       string        `yaml:"node_id"`
-	Role         string        `yaml:"role"`
-	Key          string        `yaml:"key"`
-	UDPPort      int           `yaml:"udp_port"`
-	MonitorPaths []MonitorPath `yaml:"monitor_paths"`
-	MasterAddr   string        `yaml:"master_addr"`
-	SyncPath     string        `yaml:"sync_path"`
-	WebServer    *WebConfig    `yaml:"web_server"`
-}
+// localDebounceMs 本地文件监控（双向同步、偏差检测）的防抖动时间（毫秒）
+const localDebounceMs = 1000
 
-// WebConfig Web服务配置
-type WebConfig struct {
-	Enabled   bool   `yaml:"enabled"`
-	Port      int    `yaml:"port"`
-	Username  string `yaml:"username"`
-	Password  string `yaml:"password"`
-	UploadDir string `yaml:"upload_dir"`
-}
+// Slave 从节点
+type Slave struct {
+	config     *config.Config
+	transport  transport.Transport
+	mutex      sync.RWMutex
+	done       chan bool
+	stats      *SlaveStats
+	replica    *replica.Replica
+	watcher    *watcher.FileWatcher
+	suppressor *replica.Suppressor
+	backups    *backup.Store
+	snapshots  *snapshot.Store
+	hooks      *hook.Runner
+	webServer  *webserver.WebServer
 
-// MonitorPath Master监控路径配置
-type MonitorPath struct {
-	Path   string   `yaml:"path"`
-	Slaves []string `yaml:"slaves"`
-}
+	snapshotStop chan struct{}
 
-// IsMaster 判断是否为Master节点
-func (c *Config) IsMaster() bool {
-	return c.Role == "master"
-}
+	batches    map[string]*stagedBatch
+	batchMutex sync.Mutex
 
-// IsSlave 判断是否为Slave节点
-func (c *Config) IsSlave() bool {
-	return c.Role == "slave"
-}
+	chunks     map[string]*chunkTransfer // 正在分块接收的大文件（完整路径 -> 接收状态）
+	chunkMutex sync.Mutex
 
-// Slave 从节点
-type Slave struct {
-	config    *Config
-	transport transport.Transport
-	done      chan bool
-	stats     *SlaveStats
+	relay *relayState
+
+	syncRequestedAt time.Time
+
+	masterAddr  string // 当前跟随的Master，主备切换后为任期最新的Master
+	masterEpoch uint64 // 已知的最新Master任期
+	fenced      int64  // 因任期过期被拒绝的数据包数
+
+	events *control.Publisher // 发布到本地控制接口的事件，为nil时不发布
 }
 
 // SlaveStats 从节点统计信息
@@ -63,44 +65,117 @@ type SlaveStats struct {
 	ReceivedPackets int64
 	AppliedFiles    int64
 	Errors          int64
+	DriftDetected   int64
+	Quarantined     int64
+	MirrorDeleted   int64
+	MirrorAborted   int64
+	VersionsSaved   int64
+	SnapshotsTaken  int64
+	HooksRun        int64
+	HookFailures    int64
+	BatchesApplied  int64
+	BatchesAborted  int64
 	LastSync        time.Time
 }
 
 // NewSlave 创建Slave节点
-func NewSlave(cfg *Config) (*Slave, error) {
+func NewSlave(cfg *config.Config) (*Slave, error) {
+	return NewSlaveWithTransport(cfg, transport.NewQUICTransport([]byte(cfg.Key)))
+}
+
+// NewSlaveWithTransport 使用指定的传输层创建Slave节点（多个同步组共用一个端口时使用）
+func NewSlaveWithTransport(cfg *config.Config, transport transport.Transport) (*Slave, error) {
 	if !cfg.IsSlave() {
 		return nil, fmt.Errorf("配置不是Slave节点")
 	}
 
-	// 创建传输层
-	transport := transport.NewQUICTransport([]byte(cfg.Key))
-
 	s := &Slave{
 		config:    cfg,
 		transport: transport,
 		done:      make(chan bool),
 		stats:     &SlaveStats{},
+		backups:   NewBackupStore(cfg),
+		snapshots: snapshot.NewStore(cfg.SyncPath),
+		batches:   make(map[string]*stagedBatch),
+		chunks:    make(map[string]*chunkTransfer),
+		relay:     &relayState{targets: make(map[string]*relayTarget), requested: time.Now()},
 	}
 
+	// 如果启用了Web服务，创建Web服务器
+	ws, err := s.newWebServer(cfg.WebServer)
+	if err != nil {
+		return nil, err
+	}
+	s.webServer = ws
+
 	return s, nil
 }
 
+// newWebServer 根据配置创建Web服务器并注册Slave接口，未启用时返回nil
+func (s *Slave) newWebServer(cfg *config.WebConfig) (*webserver.WebServer, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	ws, err := webserver.NewWebServer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建Web服务器失败: %v", err)
+	}
+	s.registerWebHandlers(ws)
+	return ws, nil
+}
+
 // Start 启动Slave节点
 func (s *Slave) Start() error {
 	log.Printf("启动Slave节点: %s", s.config.NodeID)
 
+	// 发布目录切换模式下sync_path是指向当前发布目录的符号链接
+	if s.config.BatchSwap {
+		if err := prepareReleases(s.config.SyncPath); err != nil {
+			return err
+		}
+	}
+
 	// 确保同步目录存在
 	if err := os.MkdirAll(s.config.SyncPath, 0755); err != nil {
 		return fmt.Errorf("创建同步目录失败: %v", err)
 	}
+	for name, root := range s.config.Targets {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return fmt.Errorf("创建目标 %s 的目录失败: %v", name, err)
+		}
+	}
+	s.clearStaging()
 
 	// 启动传输层监听
 	if err := s.transport.Listen(s.config.UDPPort, s.handleSyncPacket); err != nil {
 		return fmt.Errorf("启动传输层监听失败: %v", err)
 	}
 
+	// 启动Web服务器（如果启用）
+	if ws := s.getWebServer(); ws != nil {
+		if err := ws.Start(); err != nil {
+			return fmt.Errorf("启动Web服务器失败: %v", err)
+		}
+	}
+
+	// 双向同步或偏差检测：监控本地修改
+	if s.config.Bidirectional || s.config.DriftPolicy != "" {
+		if err := s.startLocalWatcher(s.config); err != nil {
+			return err
+		}
+	}
+
+	s.startSnapshots(s.config)
+
+	if err := s.startHooks(s.config); err != nil {
+		return err
+	}
+
+	s.startRelay(s.config)
+
 	log.Printf("Slave节点启动完成，监听端口: %d，同步目录: %s", s.config.UDPPort, s.config.SyncPath)
-	
+
 	// 启动后延迟2秒发送全量同步请求，确保Master已准备好
 	go func() {
 		time.Sleep(2 * time.Second)
@@ -108,26 +183,85 @@ func (s *Slave) Start() error {
 			log.Printf("请求全量同步失败: %v", err)
 		}
 	}()
-	
+
 	return nil
 }
 
 // handleSyncPacket 处理同步数据包
+// 作为中继时下游Slave发来的数据包单独处理，上游的变更应用后转发给下游
 func (s *Slave) handleSyncPacket(packet *protocol.SyncPacket, remoteAddr string) error {
+	if target := s.getRelayTarget(transport.ReplyAddr(packet, remoteAddr)); target != nil {
+		return s.handleDownstreamPacket(target, packet)
+	}
+
+	if !s.checkEpoch(packet, remoteAddr) {
+		return nil
+	}
+
+	// Master的查询只需回复，不应用也不转发给下游
+	switch packet.Op {
+	case "LIST", "VERIFY":
+		return s.handleQuery(packet, transport.ReplyAddr(packet, remoteAddr))
+	}
+
+	err := s.applyPacket(packet, remoteAddr)
+	s.publishApply(packet, remoteAddr, err)
+	if err != nil {
+		return err
+	}
+	s.relayPacket(packet)
+	return nil
+}
+
+// applyPacket 应用上游发来的数据包
+func (s *Slave) applyPacket(packet *protocol.SyncPacket, remoteAddr string) error {
 	s.stats.ReceivedPackets++
 	s.stats.LastSync = time.Now()
 
 	log.Printf("接收同步包: %s %s from %s", packet.Op, packet.Path, remoteAddr)
 
-	// 构建完整文件路径
-	fullPath := filepath.Join(s.config.SyncPath, packet.Path)
+	// 按数据包的目标构建完整文件路径
+	var fullPath string
+	switch packet.Op {
+	case "CREATE", "MODIFY", "MKDIR", "DELETE":
+		path, err := s.resolvePath(packet)
+		if err != nil {
+			s.stats.Errors++
+			return err
+		}
+		fullPath = path
+	}
+
+	// 批次中的变更先暂存，收到BATCH_COMMIT后一起应用
+	if packet.Batch != "" {
+		return s.stageBatchPacket(packet)
+	}
+
+	// 大文件的分块先写入临时文件，收齐后替换目标文件
+	if packet.IsChunk() && (packet.Op == "CREATE" || packet.Op == "MODIFY") {
+		return s.handleChunk(fullPath, packet)
+	}
+
+	// 双向同步时按版本向量处理sync_path中的文件变更
+	if rep := s.getReplica(); rep != nil && packet.Target == "" {
+		switch packet.Op {
+		case "CREATE", "MODIFY", "DELETE", "MKDIR":
+			return s.applyVersioned(rep, packet)
+		}
+	}
 
 	// 根据操作类型处理
 	switch packet.Op {
 	case "CREATE", "MODIFY":
 		return s.handleCreateOrModify(fullPath, packet.Content)
+	case "MKDIR":
+		return s.handleMkdir(fullPath)
 	case "DELETE":
 		return s.handleDelete(fullPath)
+	case "MANIFEST":
+		return s.handleManifest(packet)
+	case "BATCH_COMMIT":
+		return s.handleBatchCommit(packet)
 	case "SYNC_REQUEST":
 		return s.handleSyncRequest(remoteAddr)
 	case "HEARTBEAT":
@@ -139,24 +273,174 @@ func (s *Slave) handleSyncPacket(packet *protocol.SyncPacket, remoteAddr string)
 	}
 }
 
+// applyVersioned 按版本向量应用Master发来的变更，本地版本胜出时发回Master
+func (s *Slave) applyVersioned(rep *replica.Replica, packet *protocol.SyncPacket) error {
+	result, err := rep.Apply(packet)
+	if err != nil {
+		s.stats.Errors++
+		return err
+	}
+
+	if result.Applied {
+		s.stats.AppliedFiles++
+		log.Printf("文件同步成功: %s %s", packet.Op, packet.Path)
+		s.notifyHooks(packet.Op, filepath.Join(s.getConfig().SyncPath, packet.Path), packet.Op == "MKDIR")
+	}
+	if result.Reply != nil {
+		if err := s.transport.Send(s.getMasterAddr(), result.Reply); err != nil {
+			return fmt.Errorf("发送本地版本到Master失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// startLocalWatcher 启动本地文件监控
+// 双向同步时打开版本信息并把本地修改发给Master，否则按drift_policy处理本地修改
+func (s *Slave) startLocalWatcher(cfg *config.Config) error {
+	fw, rep, err := newLocalWatcher(cfg)
+	if err != nil {
+		return err
+	}
+	s.runLocalWatcher(cfg, fw, rep)
+	return nil
+}
+
+// newLocalWatcher 创建本地文件监控器，双向同步时同时打开版本信息（rep为nil表示未启用双向同步）
+func newLocalWatcher(cfg *config.Config) (*watcher.FileWatcher, *replica.Replica, error) {
+	var rep *replica.Replica
+	if cfg.Bidirectional {
+		var err error
+		rep, err = replica.Open(cfg.SyncPath, cfg.NodeID, cfg.ConflictPolicy, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("打开版本信息失败: %v", err)
+		}
+	}
+
+	fw, err := watcher.NewFileWatcher(cfg.SyncPath, localDebounceMs)
+	if err != nil {
+		if rep != nil {
+			rep.Close()
+		}
+		return nil, nil, fmt.Errorf("创建文件监控器失败: %v", err)
+	}
+	return fw, rep, nil
+}
+
+// runLocalWatcher 启动已创建的本地文件监控器并处理本地修改
+func (s *Slave) runLocalWatcher(cfg *config.Config, fw *watcher.FileWatcher, rep *replica.Replica) {
+	if rep != nil {
+		rep.SetBackup(s.backupFile)
+	}
+	fw.Start()
+
+	s.mutex.Lock()
+	s.replica = rep
+	s.watcher = fw
+	if rep == nil {
+		s.suppressor = replica.NewSuppressor()
+	}
+	s.mutex.Unlock()
+
+	go s.handleLocalEvents(fw, rep)
+
+	if rep != nil {
+		log.Printf("启用双向同步(%s): %s", fw.GetBackend(), cfg.SyncPath)
+	} else {
+		log.Printf("启用本地变更检测(%s): %s, 策略 %s", fw.GetBackend(), cfg.SyncPath, cfg.DriftPolicy)
+	}
+}
+
+// stopLocalWatcher 停止本地文件监控并保存版本信息
+func (s *Slave) stopLocalWatcher() {
+	s.mutex.Lock()
+	rep, fw := s.replica, s.watcher
+	s.replica, s.watcher, s.suppressor = nil, nil, nil
+	s.mutex.Unlock()
+
+	if fw != nil {
+		fw.Stop()
+	}
+	if rep != nil {
+		if err := rep.Close(); err != nil {
+			log.Printf("保存版本信息失败: %v", err)
+		}
+	}
+}
+
+// getReplica 获取版本信息，未启用双向同步时返回nil
+func (s *Slave) getReplica() *replica.Replica {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.replica
+}
+
+// handleLocalEvents 处理本地文件变更：双向同步时发送给Master，否则按偏差处理
+func (s *Slave) handleLocalEvents(fw *watcher.FileWatcher, rep *replica.Replica) {
+	for {
+		select {
+		case event, ok := <-fw.GetEventChan():
+			if !ok {
+				return
+			}
+			if rep != nil {
+				s.sendLocalChange(event, rep)
+			} else {
+				s.handleDrift(event)
+			}
+
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sendLocalChange 发送单个本地变更（跳过由Master同步引起的事件）
+func (s *Slave) sendLocalChange(event *watcher.FileEvent, rep *replica.Replica) {
+	cfg := s.getConfig()
+
+	syncPacket, err := watcher.CreateSyncPacket(event, cfg.SyncPath)
+	if err != nil {
+		log.Printf("创建同步包失败: %v", err)
+		return
+	}
+
+	if !rep.PrepareLocal(syncPacket) {
+		log.Printf("忽略同步引起的本地事件: %s %s", event.Op, event.Path)
+		return
+	}
+
+	if err := s.transport.Send(s.getMasterAddr(), syncPacket); err != nil {
+		s.stats.Errors++
+		log.Printf("发送本地变更到Master失败 %s %s: %v", event.Op, event.Path, err)
+		return
+	}
+	log.Printf("已发送本地变更到Master: %s %s", event.Op, event.Path)
+}
+
 // handleCreateOrModify 处理创建或修改文件
 func (s *Slave) handleCreateOrModify(fullPath string, content []byte) error {
 	// 确保父目录存在
 	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := s.ensureDir(dir); err != nil {
 		s.stats.Errors++
 		return fmt.Errorf("创建目录失败 %s: %v", dir, err)
 	}
 
 	// 检查文件是否已存在且内容相同
+	op := "CREATE"
 	if existingContent, err := ioutil.ReadFile(fullPath); err == nil {
+		op = "MODIFY"
 		if string(existingContent) == string(content) {
 			log.Printf("文件内容未变化，跳过: %s", fullPath)
 			return nil
 		}
 	}
 
+	// 覆盖前保存历史版本
+	s.backupFile(fullPath, false)
+
 	// 写入文件内容
+	s.suppressLocal(fullPath, content, false)
 	if err := ioutil.WriteFile(fullPath, content, 0644); err != nil {
 		s.stats.Errors++
 		return fmt.Errorf("写入文件失败 %s: %v", fullPath, err)
@@ -164,25 +448,62 @@ func (s *Slave) handleCreateOrModify(fullPath string, content []byte) error {
 
 	s.stats.AppliedFiles++
 	log.Printf("文件同步成功: %s (%d bytes)", fullPath, len(content))
+	s.notifyHooks(op, fullPath, false)
+	return nil
+}
+
+// handleMkdir 处理创建目录
+func (s *Slave) handleMkdir(fullPath string) error {
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		return nil
+	}
+
+	if err := s.ensureDir(fullPath); err != nil {
+		s.stats.Errors++
+		return fmt.Errorf("创建目录失败 %s: %v", fullPath, err)
+	}
+
+	s.stats.AppliedFiles++
+	log.Printf("目录同步成功: %s", fullPath)
+	s.notifyHooks("MKDIR", fullPath, true)
 	return nil
 }
 
 // handleDelete 处理删除文件
 func (s *Slave) handleDelete(fullPath string) error {
+	// 不允许删除同步根目录
+	if s.isRoot(fullPath) {
+		s.stats.Errors++
+		return fmt.Errorf("拒绝删除同步根目录: %s", fullPath)
+	}
+
 	// 检查文件是否存在
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
 		log.Printf("文件已不存在，跳过删除: %s", fullPath)
 		return nil
 	}
 
-	// 删除文件
-	if err := os.Remove(fullPath); err != nil {
+	// 删除前保存历史版本
+	s.backupFile(fullPath, true)
+
+	// 删除文件，目录（如在Master上被整体移走）连同内容一起删除
+	isDir := err == nil && info.IsDir()
+	if isDir {
+		s.suppressTree(fullPath)
+		err = os.RemoveAll(fullPath)
+	} else {
+		s.suppressLocal(fullPath, nil, true)
+		err = os.Remove(fullPath)
+	}
+	if err != nil {
 		s.stats.Errors++
 		return fmt.Errorf("删除文件失败 %s: %v", fullPath, err)
 	}
 
 	s.stats.AppliedFiles++
 	log.Printf("文件删除成功: %s", fullPath)
+	s.notifyHooks("DELETE", fullPath, isDir)
 
 	// 尝试删除空目录
 	s.cleanupEmptyDirs(filepath.Dir(fullPath))
@@ -193,7 +514,7 @@ func (s *Slave) handleDelete(fullPath string) error {
 // cleanupEmptyDirs 清理空目录
 func (s *Slave) cleanupEmptyDirs(dir string) {
 	// 不要删除根同步目录
-	if dir == s.config.SyncPath || dir == "." || dir == "/" {
+	if s.isRoot(dir) || dir == "." || dir == "/" {
 		return
 	}
 
@@ -204,6 +525,7 @@ func (s *Slave) cleanupEmptyDirs(dir string) {
 	}
 
 	// 删除空目录
+	s.suppressLocal(dir, nil, true)
 	if err := os.Remove(dir); err == nil {
 		log.Printf("删除空目录: %s", dir)
 		// 递归检查父目录
@@ -218,6 +540,18 @@ func (s *Slave) Stop() error {
 	// 发送停止信号
 	close(s.done)
 
+	s.stopLocalWatcher()
+	s.stopSnapshots()
+	s.stopHooks()
+	s.stopRelay()
+
+	// 停止Web服务器
+	if ws := s.getWebServer(); ws != nil {
+		if err := ws.Stop(); err != nil {
+			log.Printf("停止Web服务器失败: %v", err)
+		}
+	}
+
 	// 关闭传输层
 	if err := s.transport.Close(); err != nil {
 		return fmt.Errorf("关闭传输层失败: %v", err)
@@ -229,24 +563,290 @@ func (s *Slave) Stop() error {
 
 // GetStats 获取统计信息
 func (s *Slave) GetStats() map[string]interface{} {
+	cfg := s.getConfig()
 	stats := map[string]interface{}{
-		"node_id":         s.config.NodeID,
-		"role":            "slave",
-		"sync_path":       s.config.SyncPath,
+		"node_id":          cfg.NodeID,
+		"role":             "slave",
+		"sync_path":        cfg.SyncPath,
 		"received_packets": s.stats.ReceivedPackets,
-		"applied_files":   s.stats.AppliedFiles,
-		"errors":          s.stats.Errors,
-		"last_sync":       s.stats.LastSync.Format(time.RFC3339),
-		"uptime":          time.Now().Format(time.RFC3339),
+		"applied_files":    s.stats.AppliedFiles,
+		"errors":           s.stats.Errors,
+		"drift_detected":   s.stats.DriftDetected,
+		"quarantined":      s.stats.Quarantined,
+		"mirror_deleted":   s.stats.MirrorDeleted,
+		"mirror_aborted":   s.stats.MirrorAborted,
+		"versions_saved":   s.stats.VersionsSaved,
+		"snapshots_taken":  s.stats.SnapshotsTaken,
+		"hooks_run":        s.stats.HooksRun,
+		"hook_failures":    s.stats.HookFailures,
+		"batches_applied":  s.stats.BatchesApplied,
+		"batches_aborted":  s.stats.BatchesAborted,
+		"last_sync":        s.stats.LastSync.Format(time.RFC3339),
+		"uptime":           time.Now().Format(time.RFC3339),
+	}
+	if len(cfg.Targets) > 0 {
+		stats["targets"] = cfg.Targets
 	}
 
 	return stats
 }
 
+// GetDetailedStats 获取详细统计信息（SIGUSR1时输出）
+func (s *Slave) GetDetailedStats() map[string]interface{} {
+	cfg := s.getConfig()
+	stats := s.GetStats()
+	stats["master_addr"] = s.getMasterAddr()
+	if epoch, fenced := s.getEpochStats(); epoch > 0 {
+		stats["master_epoch"] = epoch
+		stats["fenced_packets"] = fenced
+	}
+	stats["udp_port"] = cfg.UDPPort
+
+	if rep := s.getReplica(); rep != nil {
+		stats["replica"] = rep.GetStats()
+	}
+
+	if relay := s.getRelayStatus(); len(relay) > 0 {
+		stats["relay"] = relay
+	}
+
+	if files, err := s.getLocalFileList(cfg.SyncPath); err == nil {
+		stats["local_files"] = len(files)
+	} else {
+		stats["local_files_error"] = err.Error()
+	}
+
+	return stats
+}
+
+// getConfig 获取当前配置
+func (s *Slave) getConfig() *config.Config {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config
+}
+
+// Reload 热加载配置
+// 支持更新密钥、Master地址和同步目录，正在处理的数据包不受影响
+func (s *Slave) Reload(cfg *config.Config) error {
+	if !cfg.IsSlave() {
+		return fmt.Errorf("配置不是Slave节点")
+	}
+
+	oldCfg := s.getConfig()
+	if cfg.NodeID != oldCfg.NodeID {
+		return fmt.Errorf("node_id不支持热加载: %s -> %s", oldCfg.NodeID, cfg.NodeID)
+	}
+	if cfg.UDPPort != oldCfg.UDPPort {
+		log.Printf("udp_port变更需要重启才能生效: %d -> %d", oldCfg.UDPPort, cfg.UDPPort)
+		cfg.UDPPort = oldCfg.UDPPort
+	}
+
+	if cfg.BatchSwap != oldCfg.BatchSwap {
+		log.Printf("batch_swap变更需要重启才能生效")
+		cfg.BatchSwap = oldCfg.BatchSwap
+	}
+
+	if cfg.SyncPath != oldCfg.SyncPath {
+		if cfg.BatchSwap {
+			if err := prepareReleases(cfg.SyncPath); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(cfg.SyncPath, 0755); err != nil {
+			return fmt.Errorf("创建同步目录失败: %v", err)
+		}
+	}
+
+	if !reflect.DeepEqual(cfg.Targets, oldCfg.Targets) {
+		for name, root := range cfg.Targets {
+			if err := os.MkdirAll(root, 0755); err != nil {
+				return fmt.Errorf("创建目标 %s 的目录失败: %v", name, err)
+			}
+		}
+	}
+
+	// 先准备新的钩子执行器、本地监控和Web服务器，任一失败时恢复原来的状态，不改动当前配置
+	hooksChanged := !reflect.DeepEqual(cfg.Hooks, oldCfg.Hooks) || cfg.SyncPath != oldCfg.SyncPath || cfg.NodeID != oldCfg.NodeID
+	var runner *hook.Runner
+	if hooksChanged {
+		var err error
+		if runner, err = s.newHooks(cfg); err != nil {
+			return err
+		}
+	}
+
+	// 本地监控设置或同步目录变化时重建本地监控，版本信息需先由原监控保存后才能重新打开
+	localChanged := cfg.Bidirectional != oldCfg.Bidirectional || cfg.ConflictPolicy != oldCfg.ConflictPolicy ||
+		cfg.DriftPolicy != oldCfg.DriftPolicy || cfg.SyncPath != oldCfg.SyncPath
+	localEnabled := cfg.Bidirectional || cfg.DriftPolicy != ""
+	restoreLocal := func() {
+		if oldCfg.Bidirectional || oldCfg.DriftPolicy != "" {
+			if err := s.startLocalWatcher(oldCfg); err != nil {
+				log.Printf("恢复本地文件监控失败: %v", err)
+			}
+		}
+	}
+	var fw *watcher.FileWatcher
+	var rep *replica.Replica
+	if localChanged {
+		s.stopLocalWatcher()
+		if localEnabled {
+			var err error
+			if fw, rep, err = newLocalWatcher(cfg); err != nil {
+				restoreLocal()
+				return err
+			}
+		}
+	}
+
+	webChanged := !oldCfg.WebServer.Equal(cfg.WebServer)
+	var ws *webserver.WebServer
+	if webChanged {
+		var err error
+		if ws, err = s.prepareWebServer(oldCfg.WebServer, cfg.WebServer); err != nil {
+			if localChanged {
+				if fw != nil {
+					fw.Stop()
+				}
+				if rep != nil {
+					rep.Close()
+				}
+				restoreLocal()
+			}
+			return err
+		}
+	}
+
+	// 全部准备成功后统一生效
+	if cfg.Key != oldCfg.Key {
+		s.transport.SetKey([]byte(cfg.Key))
+		log.Printf("加密密钥已更新")
+	}
+
+	// 快照间隔或同步目录变化时重启定期快照
+	snapshotChanged := cfg.SnapshotInterval != oldCfg.SnapshotInterval || cfg.SyncPath != oldCfg.SyncPath
+	if snapshotChanged {
+		s.stopSnapshots()
+	}
+
+	s.mutex.Lock()
+	s.config = cfg
+	s.backups = NewBackupStore(cfg)
+	if cfg.SyncPath != oldCfg.SyncPath {
+		s.snapshots = snapshot.NewStore(cfg.SyncPath)
+	}
+	oldRunner, oldWeb := s.hooks, s.webServer
+	if hooksChanged {
+		s.hooks = runner
+	}
+	if webChanged {
+		s.webServer = ws
+	}
+	s.mutex.Unlock()
+
+	if cfg.SyncPath != oldCfg.SyncPath {
+		log.Printf("同步目录变更: %s -> %s", oldCfg.SyncPath, cfg.SyncPath)
+	}
+	if !reflect.DeepEqual(cfg.Targets, oldCfg.Targets) {
+		log.Printf("目标目录变更: %v -> %v", oldCfg.Targets, cfg.Targets)
+	}
+	if hooksChanged {
+		if oldRunner != nil {
+			oldRunner.Stop()
+		}
+		if runner != nil {
+			log.Printf("启用同步后钩子: %d 个", len(cfg.Hooks))
+		}
+	}
+	if webChanged {
+		if oldWeb != nil {
+			if err := oldWeb.Stop(); err != nil {
+				log.Printf("停止Web服务器失败: %v", err)
+			}
+		}
+		if ws != nil {
+			log.Printf("Web服务器已重启，端口: %d", ws.GetPort())
+		} else {
+			log.Printf("Web服务器已关闭")
+		}
+	}
+	if fw != nil {
+		s.runLocalWatcher(cfg, fw, rep)
+	}
+
+	if snapshotChanged {
+		s.startSnapshots(cfg)
+	}
+
+	s.startRelay(cfg)
+
+	// Master地址或同步目录变化后重新请求全量同步
+	mastersChanged := !reflect.DeepEqual(masterAddrs(cfg), masterAddrs(oldCfg))
+	if mastersChanged {
+		s.resetMaster()
+	}
+	if mastersChanged || cfg.SyncPath != oldCfg.SyncPath {
+		log.Printf("Master地址或同步目录已变更，重新请求全量同步")
+		go func() {
+			if err := s.RequestFullSync(); err != nil {
+				log.Printf("请求全量同步失败: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("Slave配置热加载完成")
+	return nil
+}
+
+// prepareWebServer 按新配置创建并启动Web服务器，未启用时返回nil，此时尚未替换当前的Web服务器
+// 新旧端口相同时需先停止旧服务器，新服务器启动失败则按旧配置恢复
+func (s *Slave) prepareWebServer(oldCfg, cfg *config.WebConfig) (*webserver.WebServer, error) {
+	ws, err := s.newWebServer(cfg)
+	if err != nil || ws == nil {
+		return nil, err
+	}
+
+	current := s.getWebServer()
+	if current == nil || current.GetPort() != ws.GetPort() {
+		if err := ws.Start(); err != nil {
+			return nil, fmt.Errorf("启动Web服务器失败: %v", err)
+		}
+		return ws, nil
+	}
+
+	if err := current.Stop(); err != nil {
+		log.Printf("停止Web服务器失败: %v", err)
+	}
+	if err := ws.Start(); err != nil {
+		if old, rerr := s.newWebServer(oldCfg); rerr != nil {
+			log.Printf("恢复Web服务器失败: %v", rerr)
+		} else if old != nil {
+			if rerr := old.Start(); rerr != nil {
+				log.Printf("恢复Web服务器失败: %v", rerr)
+			} else {
+				s.mutex.Lock()
+				s.webServer = old
+				s.mutex.Unlock()
+			}
+		}
+		return nil, fmt.Errorf("启动Web服务器失败: %v", err)
+	}
+	return ws, nil
+}
+
+// getWebServer 获取当前的Web服务器
+func (s *Slave) getWebServer() *webserver.WebServer {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.webServer
+}
+
 // SendHeartbeat 发送心跳到Master（可选功能）
 func (s *Slave) SendHeartbeat() error {
-	heartbeat := protocol.NewSyncPacket("HEARTBEAT", s.config.NodeID, nil)
-	return s.transport.Send(s.config.MasterAddr, heartbeat)
+	cfg := s.getConfig()
+	heartbeat := protocol.NewSyncPacket("HEARTBEAT", cfg.NodeID, nil)
+	return s.transport.Send(s.getMasterAddr(), heartbeat)
 }
 
 // StartHeartbeat 启动心跳定时器
@@ -268,10 +868,31 @@ func (s *Slave) StartHeartbeat(interval time.Duration) {
 }
 
 // RequestFullSync 请求全量同步
+// 配置了多个Master且尚不知道哪个是主Master时同时请求其他Master，备用Master会忽略该请求
 func (s *Slave) RequestFullSync() error {
-	log.Printf("请求全量同步从Master: %s", s.config.MasterAddr)
-	syncRequest := protocol.NewSyncPacket("SYNC_REQUEST", s.config.NodeID, nil)
-	return s.transport.Send(s.config.MasterAddr, syncRequest)
+	cfg := s.getConfig()
+	masterAddr := s.getMasterAddr()
+	log.Printf("请求全量同步从Master: %s", masterAddr)
+	s.events.Publish(control.Event{Type: control.EventFullSync, Slave: masterAddr, Message: "请求全量同步"})
+
+	s.mutex.Lock()
+	s.syncRequestedAt = time.Now()
+	epoch := s.masterEpoch
+	s.mutex.Unlock()
+	s.setRelayReady(false)
+
+	syncRequest := protocol.NewSyncPacket("SYNC_REQUEST", cfg.NodeID, nil)
+	for _, addr := range masterAddrs(cfg) {
+		if addr == masterAddr || epoch > 0 {
+			continue
+		}
+		go func(addr string) {
+			if err := s.transport.Send(addr, syncRequest); err != nil {
+				log.Printf("请求全量同步失败 %s: %v", addr, err)
+			}
+		}(addr)
+	}
+	return s.transport.Send(masterAddr, syncRequest)
 }
 
 // handleSyncRequest 处理同步请求（实际上这个方法在Slave中不会被调用，因为Slave不接收SYNC_REQUEST）
@@ -280,18 +901,30 @@ func (s *Slave) handleSyncRequest(remoteAddr string) error {
 	return nil
 }
 
-// getLocalFileList 获取本地文件列表
-func (s *Slave) getLocalFileList() (map[string]bool, error) {
+// getLocalFileList 获取根目录（sync_path或目标目录）下的本地文件列表
+func (s *Slave) getLocalFileList(root string) (map[string]bool, error) {
 	files := make(map[string]bool)
-	
-	err := filepath.Walk(s.config.SyncPath, func(path string, info os.FileInfo, err error) error {
+	syncPath, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(syncPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		
+
+		// 跳过xsync元数据目录（发布目录切换模式下是符号链接）
+		if info.Name() == watcher.MetaDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		if !info.IsDir() {
 			// 获取相对路径
-			relPath, err := filepath.Rel(s.config.SyncPath, path)
+			relPath, err := filepath.Rel(syncPath, path)
 			if err != nil {
 				return err
 			}
@@ -301,6 +934,6 @@ func (s *Slave) getLocalFileList() (map[string]bool, error) {
 		}
 		return nil
 	})
-	
+
 	return files, err
-}
\ No newline at end of file
+}
@@ -0,0 +1,206 @@
+package slave
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"xsync/config"
+	"xsync/snapshot"
+	"xsync/webserver"
+)
+
+// SnapshotRetention 根据配置获取快照保留策略
+func SnapshotRetention(cfg *config.Config) snapshot.Retention {
+	return snapshot.Retention{
+		KeepLast:   cfg.SnapshotKeepLast,
+		KeepHourly: cfg.SnapshotKeepHourly,
+		KeepDaily:  cfg.SnapshotKeepDaily,
+	}
+}
+
+// startSnapshots 按snapshot_interval定期创建快照
+func (s *Slave) startSnapshots(cfg *config.Config) {
+	if cfg.SnapshotInterval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	s.mutex.Lock()
+	s.snapshotStop = stop
+	s.mutex.Unlock()
+
+	interval := cfg.SnapshotInterval.Duration()
+	log.Printf("启用定期快照: %s, 间隔 %v", cfg.SyncPath, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.TakeSnapshot(); err != nil {
+					s.stats.Errors++
+					log.Printf("创建快照失败: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSnapshots 停止定期快照
+func (s *Slave) stopSnapshots() {
+	s.mutex.Lock()
+	stop := s.snapshotStop
+	s.snapshotStop = nil
+	s.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+}
+
+// getSnapshots 获取快照存储
+func (s *Slave) getSnapshots() *snapshot.Store {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.snapshots
+}
+
+// TakeSnapshot 创建快照并按保留策略清理旧快照，内容与最近一个快照相同时返回nil
+func (s *Slave) TakeSnapshot() (*snapshot.Manifest, error) {
+	cfg := s.getConfig()
+	store := s.getSnapshots()
+
+	manifest, err := store.Take()
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil {
+		s.stats.SnapshotsTaken++
+		log.Printf("已创建快照 %s: %d 个文件", manifest.ID, len(manifest.Files))
+	}
+
+	if removed, err := store.Prune(SnapshotRetention(cfg)); err != nil {
+		log.Printf("清理旧快照失败: %v", err)
+	} else if removed > 0 {
+		log.Printf("已清理 %d 个旧快照", removed)
+	}
+	return manifest, nil
+}
+
+// RestoreSnapshot 将同步目录恢复到快照（ID、latest或时间），返回修改的文件数
+// 被修改的文件先按versioning保存历史版本，恢复写入不会被当作本地变更
+func (s *Slave) RestoreSnapshot(spec string) (int, error) {
+	syncPath := s.getConfig().SyncPath
+	store := s.getSnapshots()
+
+	manifest, err := store.Find(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	return store.Restore(manifest, func(relPath string, content []byte, deleted bool) {
+		fullPath := filepath.Join(syncPath, filepath.FromSlash(relPath))
+		s.backupFile(fullPath, deleted)
+		s.suppressLocal(fullPath, content, deleted)
+	})
+}
+
+// DiffSnapshots 比较两个快照（to为current时与当前目录比较）
+func DiffSnapshots(store *snapshot.Store, from, to string) ([]snapshot.Change, error) {
+	fromManifest, err := store.Find(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var toManifest *snapshot.Manifest
+	if to == "" || to == "current" {
+		toManifest, err = store.Current()
+	} else {
+		toManifest, err = store.Find(to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Diff(fromManifest, toManifest), nil
+}
+
+// registerSnapshotHandlers 注册快照相关的Web接口
+func (s *Slave) registerSnapshotHandlers(ws *webserver.WebServer) {
+	ws.Handle("/api/snapshots", s.handleSnapshots)
+	ws.Handle("/api/snapshots/diff", s.handleSnapshotDiff)
+	ws.Handle("/api/snapshots/restore", s.handleSnapshotRestore)
+}
+
+// handleSnapshots GET列出快照，POST立即创建快照
+func (s *Slave) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		summaries, err := s.getSnapshots().List()
+		if err != nil {
+			webserver.WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"snapshots": summaries})
+	case http.MethodPost:
+		manifest, err := s.TakeSnapshot()
+		if err != nil {
+			webserver.WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if manifest == nil {
+			webserver.WriteJSON(w, http.StatusOK, map[string]string{"status": "unchanged"})
+			return
+		}
+		webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"status": "created", "id": manifest.ID, "files": len(manifest.Files)})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSnapshotDiff 比较两个快照，to为空时与当前目录比较
+func (s *Slave) handleSnapshotDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少from参数"})
+		return
+	}
+
+	changes, err := DiffSnapshots(s.getSnapshots(), from, to)
+	if err != nil {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"from": from, "to": to, "changes": changes})
+}
+
+// handleSnapshotRestore 将同步目录恢复到快照
+func (s *Slave) handleSnapshotRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少id参数"})
+		return
+	}
+
+	changed, err := s.RestoreSnapshot(id)
+	if err != nil {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("恢复快照失败: %v", err)})
+		return
+	}
+	webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"id": id, "status": "restored", "changed": changed})
+}
@@ -0,0 +1,59 @@
+package slave
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"xsync/protocol"
+)
+
+// targetRoot 获取目标对应的本地根目录：未指定目标时为sync_path，其余必须在targets中配置
+func (s *Slave) targetRoot(target string) (string, error) {
+	cfg := s.getConfig()
+	if target == "" {
+		return cfg.SyncPath, nil
+	}
+	root, ok := cfg.Targets[target]
+	if !ok {
+		return "", fmt.Errorf("拒绝写入未授权的目标: %s", target)
+	}
+	return root, nil
+}
+
+// resolvePath 获取数据包在本地的完整路径，拒绝未授权的目标和越出根目录的路径
+func (s *Slave) resolvePath(packet *protocol.SyncPacket) (string, error) {
+	root, err := s.targetRoot(packet.Target)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := protocol.CleanPath(packet.Path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(relPath)), nil
+}
+
+// isRoot 判断路径是否为sync_path或某个目标的根目录（不允许删除）
+func (s *Slave) isRoot(path string) bool {
+	cfg := s.getConfig()
+	path = filepath.Clean(path)
+	if path == filepath.Clean(cfg.SyncPath) {
+		return true
+	}
+	for _, root := range cfg.Targets {
+		if path == filepath.Clean(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// relPathIn 计算path相对root的路径，path不在root中时返回false（历史版本和钩子只作用于sync_path）
+func relPathIn(root, path string) (string, bool) {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return relPath, true
+}
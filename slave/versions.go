@@ -0,0 +1,134 @@
+package slave
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"xsync/backup"
+	"xsync/config"
+	"xsync/webserver"
+)
+
+// NewBackupStore 根据配置创建历史版本存储，未启用版本保留时返回nil
+func NewBackupStore(cfg *config.Config) *backup.Store {
+	if !cfg.Versioning {
+		return nil
+	}
+	return backup.NewStore(cfg.SyncPath, cfg.VersionsKeep, time.Duration(cfg.VersionsDays)*24*time.Hour)
+}
+
+// getBackups 获取历史版本存储
+func (s *Slave) getBackups() *backup.Store {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.backups
+}
+
+// backupFile 覆盖或删除前保存文件的当前内容，目录则保存其下所有文件
+func (s *Slave) backupFile(fullPath string, deleted bool) {
+	store := s.getBackups()
+	if store == nil {
+		return
+	}
+	syncPath := s.getConfig().SyncPath
+
+	filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, ok := relPathIn(syncPath, path)
+		if !ok {
+			return nil
+		}
+		if err := store.Save(filepath.ToSlash(relPath), deleted); err != nil {
+			log.Printf("保存历史版本失败 %s: %v", relPath, err)
+			return nil
+		}
+		s.stats.VersionsSaved++
+		return nil
+	})
+}
+
+// RestoreVersion 将文件恢复为指定的历史版本
+func (s *Slave) RestoreVersion(relPath, id string) error {
+	store := s.getBackups()
+	if store == nil {
+		return fmt.Errorf("未启用版本保留(versioning)")
+	}
+
+	content, err := store.Read(relPath, id)
+	if err != nil {
+		return err
+	}
+
+	// 偏差检测时恢复操作不应被当作本地变更
+	fullPath := filepath.Join(s.getConfig().SyncPath, filepath.FromSlash(relPath))
+	if err := s.ensureDir(filepath.Dir(fullPath)); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	s.suppressLocal(fullPath, content, false)
+	return store.Restore(relPath, id)
+}
+
+// registerWebHandlers 注册Slave的Web接口
+func (s *Slave) registerWebHandlers(ws *webserver.WebServer) {
+	ws.Handle("/api/versions", s.handleListVersions)
+	ws.Handle("/api/versions/restore", s.handleRestoreVersion)
+	s.registerSnapshotHandlers(ws)
+}
+
+// handleListVersions 列出文件的历史版本，未指定path时列出所有有历史版本的文件
+func (s *Slave) handleListVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := s.getBackups()
+	if store == nil {
+		webserver.WriteJSON(w, http.StatusNotFound, map[string]string{"error": "未启用版本保留(versioning)"})
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		paths, err := store.Paths()
+		if err != nil {
+			webserver.WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"paths": paths})
+		return
+	}
+
+	versions, err := store.List(path)
+	if err != nil {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	webserver.WriteJSON(w, http.StatusOK, map[string]interface{}{"path": path, "versions": versions})
+}
+
+// handleRestoreVersion 将文件恢复为指定的历史版本
+func (s *Slave) handleRestoreVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, id := r.URL.Query().Get("path"), r.URL.Query().Get("id")
+	if path == "" || id == "" {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少path或id参数"})
+		return
+	}
+
+	if err := s.RestoreVersion(path, id); err != nil {
+		webserver.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	webserver.WriteJSON(w, http.StatusOK, map[string]string{"path": path, "id": id, "status": "restored"})
+}
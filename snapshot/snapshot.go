@@ -0,0 +1,646 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xsync/watcher"
+)
+
+// idFormat 快照ID的时间格式
+const idFormat = "20060102-150405"
+
+// File 快照中的一个文件
+type File struct {
+	Hash    string      `json:"hash"` // 内容的SHA-256，对应blobs中的文件
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime int64       `json:"mtime"` // 修改时间（Unix纳秒）
+}
+
+// Manifest 快照清单：某一时刻同步目录中的所有文件和目录
+type Manifest struct {
+	ID    string          `json:"id"`
+	Time  time.Time       `json:"time"`
+	Files map[string]File `json:"files"`
+	Dirs  []string        `json:"dirs"`
+}
+
+// Summary 快照摘要
+type Summary struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Files int       `json:"files"`
+	Size  int64     `json:"size"` // 文件总大小（去重前）
+}
+
+// Change 两个快照之间的一处差异
+type Change struct {
+	Op   string `json:"op"` // added/removed/modified
+	Path string `json:"path"`
+}
+
+// Retention 快照保留策略，三项都为0时保留所有快照
+type Retention struct {
+	KeepLast   int // 保留最近N个快照
+	KeepHourly int // 保留最近N个小时中每小时的最后一个快照
+	KeepDaily  int // 保留最近N天中每天的最后一个快照
+}
+
+// BeforeFunc 恢复快照修改本地文件前的回调，content为即将写入的内容
+type BeforeFunc func(relPath string, content []byte, deleted bool)
+
+// Store 快照存储
+// 文件内容按SHA-256去重保存在 <root>/.xsync/snapshots/blobs，清单保存在 manifests/<ID>.json
+type Store struct {
+	root        string
+	blobDir     string
+	manifestDir string
+	mutex       sync.Mutex
+}
+
+// NewStore 创建快照存储
+func NewStore(root string) *Store {
+	dir := filepath.Join(root, watcher.MetaDir, "snapshots")
+	return &Store{
+		root:        root,
+		blobDir:     filepath.Join(dir, "blobs"),
+		manifestDir: filepath.Join(dir, "manifests"),
+	}
+}
+
+// Take 创建快照，目录内容与最近一个快照相同时不创建，返回nil
+func (s *Store) Take() (*Manifest, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	latest, err := s.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := s.scan(latest, true)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && sameContent(latest, manifest) {
+		return nil, nil
+	}
+
+	// 同一秒内的多个快照ID加序号区分
+	now := time.Now()
+	manifest.ID, manifest.Time = now.Format(idFormat), now
+	for i := 1; fileExists(s.manifestPath(manifest.ID)); i++ {
+		manifest.ID = fmt.Sprintf("%s-%d", now.Format(idFormat), i)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAtomic(s.manifestPath(manifest.ID), data, 0644); err != nil {
+		return nil, fmt.Errorf("保存快照清单失败: %v", err)
+	}
+	return manifest, nil
+}
+
+// Current 扫描同步目录的当前状态（不保存文件内容）
+func (s *Store) Current() (*Manifest, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	latest, err := s.latest()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := s.scan(latest, false)
+	if err != nil {
+		return nil, err
+	}
+	manifest.ID, manifest.Time = "current", time.Now()
+	return manifest, nil
+}
+
+// List 列出所有快照（新快照在前）
+func (s *Store) List() ([]Summary, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	manifests, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Summary, 0, len(manifests))
+	for _, manifest := range manifests {
+		summary := Summary{ID: manifest.ID, Time: manifest.Time, Files: len(manifest.Files)}
+		for _, file := range manifest.Files {
+			summary.Size += file.Size
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// Find 按ID、"latest"或时间（2006-01-02T15:04[:05]，取该时间及之前的最后一个快照）查找快照
+func (s *Store) Find(spec string) (*Manifest, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if spec == "latest" {
+		latest, err := s.latest()
+		if err == nil && latest == nil {
+			err = fmt.Errorf("没有快照")
+		}
+		return latest, err
+	}
+
+	if manifest, err := s.load(spec); err == nil {
+		return manifest, nil
+	}
+
+	var at time.Time
+	var err error
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if at, err = time.ParseInLocation(layout, spec, time.Local); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("快照不存在: %s", spec)
+	}
+
+	manifests, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range manifests {
+		if !manifest.Time.After(at) {
+			return manifest, nil
+		}
+	}
+	return nil, fmt.Errorf("%s 之前没有快照", spec)
+}
+
+// Diff 比较两个快照，返回从from到to的变化
+func Diff(from, to *Manifest) []Change {
+	var changes []Change
+	for path, file := range to.Files {
+		old, ok := from.Files[path]
+		if !ok {
+			changes = append(changes, Change{Op: "added", Path: path})
+		} else if old.Hash != file.Hash || old.Mode != file.Mode {
+			changes = append(changes, Change{Op: "modified", Path: path})
+		}
+	}
+	for path := range from.Files {
+		if _, ok := to.Files[path]; !ok {
+			changes = append(changes, Change{Op: "removed", Path: path})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// Restore 将同步目录恢复到快照时的状态，返回修改的文件数
+// 写入快照中内容不同的文件，删除快照中没有的文件和目录（.xsync目录除外）
+func (s *Store) Restore(manifest *Manifest, before BeforeFunc) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, err := s.scan(manifest, false)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+
+	keep := make(map[string]bool, len(manifest.Dirs))
+	for _, dir := range manifest.Dirs {
+		keep[dir] = true
+	}
+
+	for _, dir := range manifest.Dirs {
+		fullPath := filepath.Join(s.root, filepath.FromSlash(dir))
+		if info, err := os.Lstat(fullPath); err == nil {
+			if info.IsDir() {
+				continue
+			}
+			// 快照后目录被文件替换，先移除文件
+			if before != nil {
+				before(dir, nil, true)
+			}
+			os.Remove(fullPath)
+		}
+		if before != nil {
+			before(dir, nil, false)
+		}
+		if err := os.MkdirAll(fullPath, 0755); err != nil {
+			return changed, fmt.Errorf("创建目录失败 %s: %v", dir, err)
+		}
+	}
+
+	paths := make([]string, 0, len(manifest.Files))
+	for path := range manifest.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		file := manifest.Files[path]
+		if old, ok := current.Files[path]; ok && old.Hash == file.Hash && old.Mode == file.Mode {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(s.blobPath(file.Hash))
+		if err != nil {
+			return changed, fmt.Errorf("读取快照内容失败 %s: %v", path, err)
+		}
+		if before != nil {
+			before(path, content, false)
+		}
+
+		fullPath := filepath.Join(s.root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return changed, fmt.Errorf("创建目录失败: %v", err)
+		}
+		// 同一路径上的目录（快照后文件被目录替换）先移除
+		if info, err := os.Lstat(fullPath); err == nil && info.IsDir() {
+			if err := os.RemoveAll(fullPath); err != nil {
+				return changed, err
+			}
+		}
+		if err := writeAtomic(fullPath, content, file.Mode.Perm()); err != nil {
+			return changed, fmt.Errorf("恢复文件失败 %s: %v", path, err)
+		}
+		modTime := time.Unix(0, file.ModTime)
+		os.Chtimes(fullPath, modTime, modTime)
+		changed++
+	}
+
+	for path := range current.Files {
+		if _, ok := manifest.Files[path]; ok || keep[path] {
+			continue
+		}
+		if before != nil {
+			before(path, nil, true)
+		}
+		if err := os.Remove(filepath.Join(s.root, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+			return changed, fmt.Errorf("删除文件失败 %s: %v", path, err)
+		}
+		changed++
+	}
+
+	// 删除快照中没有的目录（子目录先于父目录）
+	sort.Sort(sort.Reverse(sort.StringSlice(current.Dirs)))
+	for _, dir := range current.Dirs {
+		if keep[dir] {
+			continue
+		}
+		if before != nil {
+			before(dir, nil, true)
+		}
+		os.Remove(filepath.Join(s.root, filepath.FromSlash(dir)))
+	}
+
+	log.Printf("同步目录已恢复到快照 %s: 修改 %d 个文件", manifest.ID, changed)
+	return changed, nil
+}
+
+// Prune 按保留策略删除旧快照并清理不再引用的内容，返回删除的快照数
+func (s *Store) Prune(retention Retention) (int, error) {
+	if retention.KeepLast <= 0 && retention.KeepHourly <= 0 && retention.KeepDaily <= 0 {
+		return 0, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	manifests, err := s.loadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool)
+	for i, manifest := range manifests {
+		if i < retention.KeepLast {
+			keep[manifest.ID] = true
+		}
+	}
+	keepBuckets(manifests, retention.KeepHourly, "2006010215", keep)
+	keepBuckets(manifests, retention.KeepDaily, "20060102", keep)
+
+	removed := 0
+	referenced := make(map[string]bool)
+	for _, manifest := range manifests {
+		if !keep[manifest.ID] {
+			if err := os.Remove(s.manifestPath(manifest.ID)); err != nil {
+				return removed, err
+			}
+			removed++
+			continue
+		}
+		for _, file := range manifest.Files {
+			referenced[file.Hash] = true
+		}
+	}
+
+	if removed > 0 {
+		s.collectGarbage(referenced)
+	}
+	return removed, nil
+}
+
+// keepBuckets 按时间分桶，保留最近n个桶中各自最新的快照（manifests需按时间从新到旧排列）
+func keepBuckets(manifests []*Manifest, n int, layout string, keep map[string]bool) {
+	last := ""
+	for _, manifest := range manifests {
+		if n <= 0 {
+			return
+		}
+		bucket := manifest.Time.Format(layout)
+		if bucket == last {
+			continue
+		}
+		last = bucket
+		keep[manifest.ID] = true
+		n--
+	}
+}
+
+// collectGarbage 删除没有被任何快照引用的内容（调用时需持有锁）
+func (s *Store) collectGarbage(referenced map[string]bool) {
+	filepath.Walk(s.blobDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if !referenced[info.Name()] {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// scan 遍历同步目录生成清单，大小和修改时间与base中相同的文件沿用其哈希
+// store为true时把新内容保存到blobs（调用时需持有锁）
+func (s *Store) scan(base *Manifest, store bool) (*Manifest, error) {
+	manifest := &Manifest{Files: make(map[string]File)}
+
+	// 同步目录可能是指向发布目录的符号链接
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if info.IsDir() {
+			if relPath == watcher.MetaDir {
+				return filepath.SkipDir
+			}
+			manifest.Dirs = append(manifest.Dirs, relPath)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file := File{Size: info.Size(), Mode: info.Mode().Perm(), ModTime: info.ModTime().UnixNano()}
+		if base != nil {
+			if old, ok := base.Files[relPath]; ok && old.Size == file.Size && old.ModTime == file.ModTime &&
+				(!store || fileExists(s.blobPath(old.Hash))) {
+				file.Hash = old.Hash
+			}
+		}
+		if file.Hash == "" {
+			if file.Hash, err = s.hashFile(path, store); err != nil {
+				return fmt.Errorf("读取文件失败 %s: %v", relPath, err)
+			}
+		}
+		manifest.Files[relPath] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// hashFile 计算文件内容的SHA-256，store为true时同时保存到blobs（已存在时跳过）
+func (s *Store) hashFile(path string, store bool) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	hasher := sha256.New()
+	if !store {
+		if _, err := io.Copy(hasher, in); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+
+	// 边计算哈希边写入临时文件，完成后按哈希重命名
+	if err := os.MkdirAll(s.blobDir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(s.blobDir, ".blob-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(io.MultiWriter(hasher, tmp), in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	blobPath := s.blobPath(sum)
+	if fileExists(blobPath) {
+		return sum, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return "", err
+	}
+	return sum, os.Rename(tmp.Name(), blobPath)
+}
+
+// latest 获取最近一个快照，没有快照时返回nil（调用时需持有锁）
+func (s *Store) latest() (*Manifest, error) {
+	ids, err := s.ids()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return s.load(ids[0])
+}
+
+// loadAll 加载所有快照（新快照在前，调用时需持有锁）
+func (s *Store) loadAll() ([]*Manifest, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]*Manifest, 0, len(ids))
+	for _, id := range ids {
+		manifest, err := s.load(id)
+		if err != nil {
+			log.Printf("跳过无法读取的快照 %s: %v", id, err)
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].Time.After(manifests[j].Time)
+	})
+	return manifests, nil
+}
+
+// ids 列出所有快照ID（新快照在前）
+func (s *Store) ids() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.manifestDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if id := strings.TrimSuffix(entry.Name(), ".json"); !entry.IsDir() && id != entry.Name() && validID(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// load 加载快照清单
+func (s *Store) load(id string) (*Manifest, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("无效的快照ID: %s", id)
+	}
+	data, err := ioutil.ReadFile(s.manifestPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("快照不存在: %s", id)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析快照清单失败 %s: %v", id, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]File)
+	}
+	return &manifest, nil
+}
+
+// manifestPath 获取快照清单路径
+func (s *Store) manifestPath(id string) string {
+	return filepath.Join(s.manifestDir, id+".json")
+}
+
+// blobPath 获取内容文件路径 blobs/<哈希前2位>/<哈希>
+func (s *Store) blobPath(sum string) string {
+	if len(sum) < 2 {
+		return filepath.Join(s.blobDir, sum)
+	}
+	return filepath.Join(s.blobDir, sum[:2], sum)
+}
+
+// validID 判断快照ID格式是否有效（时间，可带序号）
+func validID(id string) bool {
+	if len(id) < len(idFormat) {
+		return false
+	}
+	if _, err := time.Parse(idFormat, id[:len(idFormat)]); err != nil {
+		return false
+	}
+	rest := id[len(idFormat):]
+	if rest == "" {
+		return true
+	}
+	if rest[0] != '-' || len(rest) == 1 {
+		return false
+	}
+	for _, c := range rest[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sameContent 判断两个清单的文件内容和目录是否相同
+func sameContent(a, b *Manifest) bool {
+	if len(a.Files) != len(b.Files) || len(a.Dirs) != len(b.Dirs) {
+		return false
+	}
+	for path, file := range a.Files {
+		other, ok := b.Files[path]
+		if !ok || other.Hash != file.Hash || other.Mode != file.Mode {
+			return false
+		}
+	}
+	dirs := make(map[string]bool, len(a.Dirs))
+	for _, dir := range a.Dirs {
+		dirs[dir] = true
+	}
+	for _, dir := range b.Dirs {
+		if !dirs[dir] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeAtomic 先写临时文件再重命名
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".xsync-tmp")
+	if err := ioutil.WriteFile(tmpPath, data, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
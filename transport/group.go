@@ -0,0 +1,80 @@
+package transport
+
+import (
+	"fmt"
+
+	"xsync/protocol"
+)
+
+// GroupTransport 同步组的传输器
+// 多个同步组共用QUICTransport的UDP端口和到对端的连接，各自使用独立的密钥、任期和数据包处理函数
+type GroupTransport struct {
+	qt   *QUICTransport
+	name string
+}
+
+// Group 注册同步组并返回其传输器，同名的同步组会被替换
+func (qt *QUICTransport) Group(name string, key []byte) *GroupTransport {
+	qt.keyMutex.Lock()
+	qt.groups[name] = &groupEntry{key: key}
+	qt.keyMutex.Unlock()
+	return &GroupTransport{qt: qt, name: name}
+}
+
+// Send 使用同步组的密钥和任期发送数据包，对端按组名交给同名同步组处理
+func (gt *GroupTransport) Send(addr string, packet *protocol.SyncPacket) error {
+	gt.qt.keyMutex.RLock()
+	entry, ok := gt.qt.groups[gt.name]
+	var key []byte
+	var epoch uint64
+	if ok {
+		key, epoch = entry.key, entry.epoch
+	}
+	gt.qt.keyMutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("同步组 %s 已关闭", gt.name)
+	}
+	return gt.qt.send(addr, packet, gt.name, key, epoch)
+}
+
+// Listen 设置同步组的数据包处理函数，共用的端口尚未监听时启动监听
+func (gt *GroupTransport) Listen(port int, handler PacketHandler) error {
+	gt.qt.keyMutex.Lock()
+	entry, ok := gt.qt.groups[gt.name]
+	if ok {
+		entry.handler = handler
+	}
+	gt.qt.keyMutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("同步组 %s 已关闭", gt.name)
+	}
+	return gt.qt.listen(port)
+}
+
+// SetKey 更新同步组的加密密钥
+func (gt *GroupTransport) SetKey(key []byte) {
+	gt.qt.keyMutex.Lock()
+	if entry, ok := gt.qt.groups[gt.name]; ok {
+		entry.key = key
+	}
+	gt.qt.keyMutex.Unlock()
+}
+
+// SetEpoch 设置同步组之后发送的数据包携带的任期，0表示保留数据包原有的任期
+func (gt *GroupTransport) SetEpoch(epoch uint64) {
+	gt.qt.keyMutex.Lock()
+	if entry, ok := gt.qt.groups[gt.name]; ok {
+		entry.epoch = epoch
+	}
+	gt.qt.keyMutex.Unlock()
+}
+
+// Close 注销同步组，之后收到的该组数据包被丢弃；共用的端口和连接由QUICTransport.Close关闭
+func (gt *GroupTransport) Close() error {
+	gt.qt.keyMutex.Lock()
+	delete(gt.qt.groups, gt.name)
+	gt.qt.keyMutex.Unlock()
+	return nil
+}
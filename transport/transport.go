@@ -4,14 +4,17 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -23,16 +26,36 @@ import (
 type Transport interface {
 	Send(addr string, packet *protocol.SyncPacket) error
 	Listen(port int, handler PacketHandler) error
+	SetKey(key []byte)
+	SetEpoch(epoch uint64)
 	Close() error
 }
 
 // PacketHandler 数据包处理函数
 type PacketHandler func(packet *protocol.SyncPacket, remoteAddr string) error
 
+const (
+	groupFlag    = 1 << 31 // 长度字段最高位置1表示帧以同步组名开头
+	maxGroupName = 255     // 同步组名的最大长度（字节）
+)
+
+// groupEntry 共用传输端点的同步组
+type groupEntry struct {
+	key     []byte
+	epoch   uint64
+	handler PacketHandler
+}
+
 // QUICTransport QUIC传输实现
 type QUICTransport struct {
 	key       []byte
+	epoch     uint64
+	handler   PacketHandler          // 未分组数据包的处理函数
+	groups    map[string]*groupEntry // 同步组名 -> 密钥、任期和处理函数
+	keyMutex  sync.RWMutex
 	listener  *quic.Listener
+	udp       *quic.Transport
+	port      int
 	conns     map[string]quic.Connection
 	connMutex sync.RWMutex
 	ctx       context.Context
@@ -44,6 +67,7 @@ func NewQUICTransport(key []byte) *QUICTransport {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &QUICTransport{
 		key:    key,
+		groups: make(map[string]*groupEntry),
 		conns:  make(map[string]quic.Connection),
 		ctx:    ctx,
 		cancel: cancel,
@@ -52,8 +76,26 @@ func NewQUICTransport(key []byte) *QUICTransport {
 
 // Send 发送数据包
 func (qt *QUICTransport) Send(addr string, packet *protocol.SyncPacket) error {
+	return qt.send(addr, packet, "", qt.getKey(), qt.getEpoch())
+}
+
+// send 使用指定同步组的密钥和任期发送数据包，group为空时发送未分组的数据包
+func (qt *QUICTransport) send(addr string, packet *protocol.SyncPacket, group string, key []byte, epoch uint64) error {
+	// 附带本地监听端口、任期和同步组，便于对端回复、拒绝过期Master和校验组名（复制一份，避免并发发送时修改共享的数据包）
+	if (qt.port > 0 && packet.ListenPort != qt.port) || (epoch > 0 && packet.Epoch != epoch) || packet.Group != group {
+		copied := *packet
+		if qt.port > 0 {
+			copied.ListenPort = qt.port
+		}
+		if epoch > 0 {
+			copied.Epoch = epoch
+		}
+		copied.Group = group
+		packet = &copied
+	}
+
 	// 加密数据包
-	encryptedData, err := packet.Encrypt(qt.key)
+	encryptedData, err := packet.Encrypt(key)
 	if err != nil {
 		return fmt.Errorf("加密数据包失败: %v", err)
 	}
@@ -70,6 +112,18 @@ func (qt *QUICTransport) Send(addr string, packet *protocol.SyncPacket) error {
 		return fmt.Errorf("打开流失败: %v", err)
 	}
 	defer stream.Close()
+	// 不读取对端的数据，放弃接收方向使流能被释放，否则并发流的配额耗尽后无法打开新流
+	defer stream.CancelRead(0)
+
+	// 同步组的帧以明文组名开头（长度字段最高位置1，低位为组名长度），接收方据此选择密钥
+	if group != "" {
+		header := make([]byte, 4+len(group))
+		binary.BigEndian.PutUint32(header, groupFlag|uint32(len(group)))
+		copy(header[4:], group)
+		if _, err := stream.Write(header); err != nil {
+			return fmt.Errorf("发送同步组名失败: %v", err)
+		}
+	}
 
 	// 发送数据长度
 	lengthBytes := make([]byte, 4)
@@ -87,10 +141,55 @@ func (qt *QUICTransport) Send(addr string, packet *protocol.SyncPacket) error {
 		return fmt.Errorf("发送数据失败: %v", err)
 	}
 
-	log.Printf("发送数据包到 %s: %s %s", addr, packet.Op, packet.Path)
+	if group != "" {
+		log.Printf("发送数据包到 %s [%s]: %s %s", addr, group, packet.Op, packet.Path)
+	} else {
+		log.Printf("发送数据包到 %s: %s %s", addr, packet.Op, packet.Path)
+	}
 	return nil
 }
 
+// SetKey 更新加密密钥（配置热加载时使用，已建立的连接不受影响）
+func (qt *QUICTransport) SetKey(key []byte) {
+	qt.keyMutex.Lock()
+	qt.key = key
+	qt.keyMutex.Unlock()
+}
+
+// SetEpoch 设置之后发送的数据包携带的任期，0表示保留数据包原有的任期（Slave转发时使用）
+func (qt *QUICTransport) SetEpoch(epoch uint64) {
+	qt.keyMutex.Lock()
+	qt.epoch = epoch
+	qt.keyMutex.Unlock()
+}
+
+// ReplyAddr 根据数据包中的监听端口计算对端的回复地址
+// remoteAddr为连接的源地址（主动连接方使用临时端口），数据包未携带端口时原样返回
+func ReplyAddr(packet *protocol.SyncPacket, remoteAddr string) string {
+	if packet.ListenPort <= 0 {
+		return remoteAddr
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(packet.ListenPort))
+}
+
+// getEpoch 获取当前任期
+func (qt *QUICTransport) getEpoch() uint64 {
+	qt.keyMutex.RLock()
+	defer qt.keyMutex.RUnlock()
+	return qt.epoch
+}
+
+// getKey 获取当前加密密钥
+func (qt *QUICTransport) getKey() []byte {
+	qt.keyMutex.RLock()
+	defer qt.keyMutex.RUnlock()
+	return qt.key
+}
+
 // getConnection 获取或创建到指定地址的连接
 func (qt *QUICTransport) getConnection(addr string) (quic.Connection, error) {
 	qt.connMutex.RLock()
@@ -140,28 +239,57 @@ func (qt *QUICTransport) monitorConnection(addr string, conn quic.Connection) {
 	log.Printf("连接已断开: %s", addr)
 }
 
-// Listen 监听指定端口
+// Listen 监听指定端口，处理未分组的数据包
 func (qt *QUICTransport) Listen(port int, handler PacketHandler) error {
+	qt.keyMutex.Lock()
+	qt.handler = handler
+	qt.keyMutex.Unlock()
+	return qt.listen(port)
+}
+
+// listen 启动端口监听，已在同一端口监听时直接返回（多个同步组共用一个端口）
+func (qt *QUICTransport) listen(port int) error {
+	// 重启后用相同的密钥回复无状态重置，对端立即关闭指向旧进程的连接，而不是继续向其发送直到超时
+	resetKey := quic.StatelessResetKey(sha256.Sum256(append([]byte("xsync-stateless-reset:"), qt.getKey()...)))
+
+	qt.connMutex.Lock()
+	defer qt.connMutex.Unlock()
+	if qt.listener != nil {
+		if port != qt.port {
+			return fmt.Errorf("传输层已在端口 %d 监听，不能再监听端口 %d", qt.port, port)
+		}
+		return nil
+	}
+
 	tlsConfig := generateTLSConfig()
 
-	listener, err := quic.ListenAddr(fmt.Sprintf(":%d", port), tlsConfig, &quic.Config{
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return fmt.Errorf("启动QUIC监听失败: %v", err)
+	}
+
+	udp := &quic.Transport{Conn: udpConn, StatelessResetKey: &resetKey}
+	listener, err := udp.Listen(tlsConfig, &quic.Config{
 		KeepAlivePeriod: 30 * time.Second,
 	})
 	if err != nil {
+		udp.Close()
 		return fmt.Errorf("启动QUIC监听失败: %v", err)
 	}
 
 	qt.listener = listener
+	qt.udp = udp
+	qt.port = port
 	log.Printf("QUIC服务器监听端口: %d", port)
 
 	// 处理连接
-	go qt.acceptConnections(handler)
+	go qt.acceptConnections()
 
 	return nil
 }
 
 // acceptConnections 接受连接
-func (qt *QUICTransport) acceptConnections(handler PacketHandler) {
+func (qt *QUICTransport) acceptConnections() {
 	for {
 		select {
 		case <-qt.ctx.Done():
@@ -176,13 +304,13 @@ func (qt *QUICTransport) acceptConnections(handler PacketHandler) {
 				continue
 			}
 
-			go qt.handleConnection(conn, handler)
+			go qt.handleConnection(conn)
 		}
 	}
 }
 
 // handleConnection 处理连接
-func (qt *QUICTransport) handleConnection(conn quic.Connection, handler PacketHandler) {
+func (qt *QUICTransport) handleConnection(conn quic.Connection) {
 	remoteAddr := conn.RemoteAddr().String()
 	log.Printf("接受新连接: %s", remoteAddr)
 
@@ -202,14 +330,16 @@ func (qt *QUICTransport) handleConnection(conn quic.Connection, handler PacketHa
 				continue
 			}
 
-			go qt.handleStream(stream, handler, remoteAddr)
+			go qt.handleStream(stream, remoteAddr)
 		}
 	}
 }
 
 // handleStream 处理数据流
-func (qt *QUICTransport) handleStream(stream quic.Stream, handler PacketHandler, remoteAddr string) {
+func (qt *QUICTransport) handleStream(stream quic.Stream, remoteAddr string) {
 	defer stream.Close()
+	// 读完数据包后不再等待流结束标记，放弃接收方向以释放流
+	defer stream.CancelRead(0)
 
 	// 读取数据长度
 	lengthBytes := make([]byte, 4)
@@ -218,6 +348,36 @@ func (qt *QUICTransport) handleStream(stream quic.Stream, handler PacketHandler,
 		return
 	}
 
+	// 读取同步组名
+	group := ""
+	if word := binary.BigEndian.Uint32(lengthBytes); word&groupFlag != 0 {
+		nameLength := int(word &^ groupFlag)
+		if nameLength <= 0 || nameLength > maxGroupName {
+			log.Printf("无效的同步组名长度: %d", nameLength)
+			return
+		}
+		name := make([]byte, nameLength)
+		if _, err := io.ReadFull(stream, name); err != nil {
+			log.Printf("读取同步组名失败: %v", err)
+			return
+		}
+		group = string(name)
+		if _, err := io.ReadFull(stream, lengthBytes); err != nil {
+			log.Printf("读取数据长度失败: %v", err)
+			return
+		}
+	}
+
+	key, handler := qt.route(group)
+	if handler == nil {
+		if group != "" {
+			log.Printf("丢弃来自 %s 的数据包: 本节点未配置同步组 %s", remoteAddr, group)
+		} else {
+			log.Printf("丢弃来自 %s 的数据包: 本节点只接收同步组的数据包", remoteAddr)
+		}
+		return
+	}
+
 	dataLength := int(lengthBytes[0])<<24 | int(lengthBytes[1])<<16 | int(lengthBytes[2])<<8 | int(lengthBytes[3])
 	if dataLength <= 0 || dataLength > 100*1024*1024 { // 限制最大100MB
 		log.Printf("无效的数据长度: %d", dataLength)
@@ -232,13 +392,23 @@ func (qt *QUICTransport) handleStream(stream quic.Stream, handler PacketHandler,
 	}
 
 	// 解密数据包
-	packet, err := protocol.DecryptPacket(encryptedData, qt.key)
+	packet, err := protocol.DecryptPacket(encryptedData, key)
 	if err != nil {
 		log.Printf("解密数据包失败: %v", err)
 		return
 	}
 
-	log.Printf("接收数据包从 %s: %s %s", remoteAddr, packet.Op, packet.Path)
+	// 组名是明文，以加密内容中的组名为准，防止被改写后投递到其他同步组
+	if packet.Group != group {
+		log.Printf("丢弃来自 %s 的数据包: 同步组不匹配 (帧头 %q，数据包 %q)", remoteAddr, group, packet.Group)
+		return
+	}
+
+	if group != "" {
+		log.Printf("接收数据包从 %s [%s]: %s %s", remoteAddr, group, packet.Op, packet.Path)
+	} else {
+		log.Printf("接收数据包从 %s: %s %s", remoteAddr, packet.Op, packet.Path)
+	}
 
 	// 处理数据包
 	if err := handler(packet, remoteAddr); err != nil {
@@ -246,6 +416,19 @@ func (qt *QUICTransport) handleStream(stream quic.Stream, handler PacketHandler,
 	}
 }
 
+// route 获取同步组的密钥和处理函数，group为空表示未分组的数据包，未注册时handler为nil
+func (qt *QUICTransport) route(group string) ([]byte, PacketHandler) {
+	qt.keyMutex.RLock()
+	defer qt.keyMutex.RUnlock()
+	if group == "" {
+		return qt.key, qt.handler
+	}
+	if entry, ok := qt.groups[group]; ok {
+		return entry.key, entry.handler
+	}
+	return nil, nil
+}
+
 // Close 关闭传输器
 func (qt *QUICTransport) Close() error {
 	qt.cancel()
@@ -259,7 +442,8 @@ func (qt *QUICTransport) Close() error {
 
 	// 关闭监听器
 	if qt.listener != nil {
-		return qt.listener.Close()
+		qt.listener.Close()
+		return qt.udp.Close()
 	}
 
 	return nil
@@ -298,12 +482,12 @@ func generateSelfSignedCert() (tls.Certificate, error) {
 			StreetAddress: []string{""},
 			PostalCode:    []string{""},
 		},
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().Add(365 * 24 * time.Hour), // 1年有效期
-		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		DNSNames:     []string{"localhost"},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(365 * 24 * time.Hour), // 1年有效期
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:    []string{"localhost"},
 	}
 
 	// 生成证书
@@ -317,4 +501,4 @@ func generateSelfSignedCert() (tls.Certificate, error) {
 		Certificate: [][]byte{certDER},
 		PrivateKey:  priv,
 	}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// closeWriteNotifier 基于inotify IN_CLOSE_WRITE的写入完成通知
+// fsnotify不暴露该事件，因此单独使用一个inotify实例只监听写入完成
+type closeWriteNotifier struct {
+	file    *os.File
+	fd      int
+	dirs    map[int]string
+	mutex   sync.Mutex
+	onClose func(fullPath string)
+}
+
+// newCloseWriteNotifier 创建写入完成通知器
+func newCloseWriteNotifier(onClose func(fullPath string)) (*closeWriteNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &closeWriteNotifier{
+		// 非阻塞fd交给运行时轮询器，Close时可唤醒阻塞的Read
+		file:    os.NewFile(uintptr(fd), "inotify-close-write"),
+		fd:      fd,
+		dirs:    make(map[int]string),
+		onClose: onClose,
+	}
+	go n.readLoop()
+
+	return n, nil
+}
+
+// add 为目录添加写入完成监控
+func (n *closeWriteNotifier) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_ONLYDIR)
+	if err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	n.dirs[wd] = dir
+	n.mutex.Unlock()
+	return nil
+}
+
+// close 关闭通知器
+func (n *closeWriteNotifier) close() {
+	n.file.Close()
+}
+
+// readLoop 读取inotify事件
+func (n *closeWriteNotifier) readLoop() {
+	buf := make([]byte, syscall.SizeofInotifyEvent*4096)
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			return // 已关闭
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			if nameEnd > count {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			offset = nameEnd
+
+			n.mutex.Lock()
+			dir, exists := n.dirs[int(raw.Wd)]
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				delete(n.dirs, int(raw.Wd))
+			}
+			n.mutex.Unlock()
+
+			if exists && name != "" && raw.Mask&syscall.IN_CLOSE_WRITE != 0 {
+				n.onClose(filepath.Join(dir, name))
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package watcher
+
+import "fmt"
+
+// closeWriteNotifier 非Linux平台不支持写入完成通知
+type closeWriteNotifier struct{}
+
+// newCloseWriteNotifier 非Linux平台返回错误
+func newCloseWriteNotifier(onClose func(fullPath string)) (*closeWriteNotifier, error) {
+	return nil, fmt.Errorf("当前平台不支持写入完成通知")
+}
+
+// add 空实现
+func (n *closeWriteNotifier) add(dir string) error {
+	return nil
+}
+
+// close 空实现
+func (n *closeWriteNotifier) close() {}
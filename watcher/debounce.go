@@ -0,0 +1,236 @@
+package watcher
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// defaultStableInterval 默认稳定性采样间隔
+	defaultStableInterval = time.Second
+	// closeWriteDelay 收到写入完成通知后的发送延迟，用于合并紧随其后的chmod/rename
+	closeWriteDelay = 100 * time.Millisecond
+	// closeWriteWindow 写入完成通知先于文件事件到达时的有效期
+	closeWriteWindow = time.Second
+)
+
+// pendingEvent 等待发送的事件
+type pendingEvent struct {
+	op        string
+	path      string
+	timer     *time.Timer
+	firstSeen time.Time
+	size      int64
+	modTime   time.Time
+	stable    int  // 连续未变化的采样次数
+	closed    bool // 已收到写入完成通知
+}
+
+// debounceEvent 防抖动事件处理
+// 每个路径只保留一个待发事件，同一窗口内的事件序列合并为最终效果
+func (fw *FileWatcher) debounceEvent(op, path string) {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.stopped {
+		return
+	}
+
+	// 合并到已有的待发事件，重新开始计时（不超过最大延迟）
+	if pending, exists := fw.debouncer[path]; exists {
+		merged := coalesceOp(pending.op, op)
+		if merged == "" {
+			// 创建后又删除，相当于什么都没发生
+			pending.timer.Stop()
+			delete(fw.debouncer, path)
+			return
+		}
+		// 文件与上次采样相同（如轮询重复报告尚未发出的变化）时不重新计时，否则轮询间隔短于稳定性检查时永远不会发送
+		if merged == pending.op && fw.unchanged(pending) {
+			return
+		}
+		pending.op = merged
+		pending.stable = 0
+		pending.closed = false
+		fw.sample(pending)
+		pending.timer.Reset(fw.delayFor(pending))
+		return
+	}
+
+	// 已同步过的路径再次创建（如rename覆盖），对Slave而言是修改
+	if op == "CREATE" && fw.isKnown(path) {
+		op = "MODIFY"
+	}
+
+	// 创建新的定时器
+	pending := &pendingEvent{op: op, path: path, firstSeen: time.Now()}
+	fw.sample(pending)
+
+	// 写入完成通知可能先于文件事件到达，关闭后未再修改则视为已写完
+	delay := fw.delayFor(pending)
+	if closedAt, exists := fw.closedAt[path]; exists {
+		if op != "DELETE" && time.Since(closedAt) < closeWriteWindow && !pending.modTime.After(closedAt) {
+			pending.closed = true
+			delay = closeWriteDelay
+		}
+	}
+
+	pending.timer = time.AfterFunc(delay, func() {
+		fw.firePending(path)
+	})
+	fw.debouncer[path] = pending
+}
+
+// coalesceOp 合并同一路径上先后发生的两个操作，返回空字符串表示相互抵消
+//
+//	CREATE + MODIFY = CREATE    CREATE + DELETE = (无)
+//	MODIFY + MODIFY = MODIFY    MODIFY + DELETE = DELETE
+//	DELETE + CREATE = MODIFY    DELETE + DELETE = DELETE
+func coalesceOp(prev, next string) string {
+	switch prev {
+	case "CREATE":
+		if next == "DELETE" {
+			return ""
+		}
+		return "CREATE"
+	case "MODIFY":
+		if next == "DELETE" {
+			return "DELETE"
+		}
+		return "MODIFY"
+	case "DELETE":
+		if next == "DELETE" {
+			return "DELETE"
+		}
+		return "MODIFY"
+	}
+	return next
+}
+
+// delayFor 计算事件的防抖延迟，持续变化的文件最迟在firstSeen+maxDelay时发送
+func (fw *FileWatcher) delayFor(pending *pendingEvent) time.Duration {
+	delay := time.Duration(fw.debounceMs) * time.Millisecond
+	if fw.maxDelay > 0 {
+		if remaining := fw.maxDelay - time.Since(pending.firstSeen); remaining < delay {
+			delay = remaining
+		}
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// sample 记录文件当前的大小和修改时间
+func (fw *FileWatcher) sample(pending *pendingEvent) {
+	if pending.op == "DELETE" {
+		return
+	}
+	if info, err := os.Lstat(filepath.Join(fw.basePath, pending.path)); err == nil {
+		pending.size = info.Size()
+		pending.modTime = info.ModTime()
+	}
+}
+
+// unchanged 判断文件的大小和修改时间是否与上次采样相同（调用时需持有锁）
+func (fw *FileWatcher) unchanged(pending *pendingEvent) bool {
+	if pending.op == "DELETE" {
+		return true
+	}
+	info, err := os.Lstat(filepath.Join(fw.basePath, pending.path))
+	return err == nil && info.Size() == pending.size && info.ModTime().Equal(pending.modTime)
+}
+
+// firePending 防抖定时器到期：确认写入完成后发送事件
+func (fw *FileWatcher) firePending(path string) {
+	fw.mutex.Lock()
+	pending, exists := fw.debouncer[path]
+	if !exists || fw.stopped {
+		fw.mutex.Unlock()
+		return
+	}
+
+	// 文件仍在写入时推迟发送（已收到写入完成通知或超过最大延迟时除外）
+	if pending.op != "DELETE" && !pending.closed && !fw.isStable(pending) {
+		if fw.maxDelay <= 0 || time.Since(pending.firstSeen) < fw.maxDelay {
+			pending.timer.Reset(fw.stableInterval)
+			fw.mutex.Unlock()
+			return
+		}
+		log.Printf("文件持续变化超过最大延迟，强制发送: %s", pending.path)
+	}
+
+	delete(fw.debouncer, path)
+	fw.mutex.Unlock()
+
+	event := &FileEvent{Op: pending.op, Path: pending.path}
+	if pending.op != "DELETE" {
+		info, err := os.Lstat(filepath.Join(fw.basePath, pending.path))
+		switch {
+		case err == nil:
+			event.IsDir = info.IsDir()
+		case !os.IsNotExist(err):
+		case fw.isKnown(pending.path):
+			// 文件已不存在（如写入已删除文件的延迟事件），按最终效果发送删除
+			event.Op = "DELETE"
+		default:
+			return
+		}
+	}
+
+	if fw.emit(event) {
+		fw.updateKnown(event.Op, pending.path)
+		return
+	}
+
+	// 事件通道已满时不丢弃，标记所在目录待重新扫描（已知状态未更新，扫描时会补发）
+	if !fw.isStopped() {
+		log.Printf("事件通道已满，标记目录待重新扫描: %s %s", pending.op, pending.path)
+		fw.markDirty(filepath.Dir(pending.path))
+	}
+}
+
+// isStable 采样文件状态，判断是否已连续stableChecks次未变化（调用时需持有锁）
+func (fw *FileWatcher) isStable(pending *pendingEvent) bool {
+	info, err := os.Lstat(filepath.Join(fw.basePath, pending.path))
+	if err != nil || info.IsDir() {
+		return true
+	}
+
+	if info.Size() == pending.size && info.ModTime().Equal(pending.modTime) {
+		pending.stable++
+	} else {
+		pending.stable = 0
+		pending.size = info.Size()
+		pending.modTime = info.ModTime()
+	}
+
+	return pending.stable >= fw.stableChecks
+}
+
+// onCloseWrite 收到写入完成通知，尽快发送该文件的待发事件
+func (fw *FileWatcher) onCloseWrite(fullPath string) {
+	relPath, err := filepath.Rel(fw.basePath, fullPath)
+	if err != nil {
+		return
+	}
+
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if pending, exists := fw.debouncer[relPath]; exists && pending.op != "DELETE" {
+		pending.closed = true
+		pending.timer.Reset(closeWriteDelay)
+	}
+
+	// 记录关闭时间，供尚未到达的文件事件使用
+	now := time.Now()
+	for path, closedAt := range fw.closedAt {
+		if now.Sub(closedAt) >= closeWriteWindow {
+			delete(fw.closedAt, path)
+		}
+	}
+	fw.closedAt[relPath] = now
+}
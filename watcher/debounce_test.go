@@ -0,0 +1,27 @@
+package watcher
+
+import "testing"
+
+func TestCoalesceOp(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       string
+	}{
+		{"CREATE", "MODIFY", "CREATE"},
+		{"CREATE", "CREATE", "CREATE"},
+		{"CREATE", "DELETE", ""},
+		{"MODIFY", "MODIFY", "MODIFY"},
+		{"MODIFY", "CREATE", "MODIFY"},
+		{"MODIFY", "DELETE", "DELETE"},
+		{"DELETE", "CREATE", "MODIFY"},
+		{"DELETE", "MODIFY", "MODIFY"},
+		{"DELETE", "DELETE", "DELETE"},
+		{"", "MODIFY", "MODIFY"},
+	}
+
+	for _, tt := range tests {
+		if got := coalesceOp(tt.prev, tt.next); got != tt.want {
+			t.Errorf("coalesceOp(%q, %q) = %q, 期望 %q", tt.prev, tt.next, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package watcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IgnoreFileName 目录内的过滤规则文件名（gitignore语法）
+const IgnoreFileName = ".xsyncignore"
+
+// MetaDir 同步目录下存放xsync元数据（版本信息等）的目录，始终不参与同步
+const MetaDir = ".xsync"
+
+// defaultExcludes 默认排除规则：隐藏文件和编辑器临时文件
+var defaultExcludes = []string{".*", "*~"}
+
+// FilterConfig 过滤规则配置
+type FilterConfig struct {
+	Include []string      // 包含规则，非空时文件必须匹配其中之一
+	Exclude []string      // 排除规则（gitignore语法，支持!取反）
+	MinSize int64         // 最小文件大小（字节），0表示不限制
+	MaxSize int64         // 最大文件大小（字节），0表示不限制
+	MaxAge  time.Duration // 只同步该时长内修改过的文件，0表示不限制
+}
+
+// rule 单条过滤规则
+type rule struct {
+	pattern  string
+	base     string // 规则所在目录（相对监控根目录，根目录为空）
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	re       *regexp.Regexp
+}
+
+// Filter 文件过滤器
+// 规则按顺序匹配，最后一条匹配的规则生效；被排除目录下的所有文件均被排除
+type Filter struct {
+	basePath string
+	config   FilterConfig
+	rules    []*rule
+	include  []*rule
+	ignores  map[string][]*rule
+	mutex    sync.RWMutex
+}
+
+// NewFilter 创建文件过滤器
+func NewFilter(basePath string, cfg FilterConfig) (*Filter, error) {
+	f := &Filter{
+		basePath: basePath,
+		config:   cfg,
+		ignores:  make(map[string][]*rule),
+	}
+
+	patterns := append(append([]string{}, defaultExcludes...), cfg.Exclude...)
+	for _, pattern := range patterns {
+		r, err := parseRule(pattern, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			f.rules = append(f.rules, r)
+		}
+	}
+
+	for _, pattern := range cfg.Include {
+		r, err := parseRule(pattern, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			f.include = append(f.include, r)
+		}
+	}
+
+	return f, nil
+}
+
+// ValidatePattern 检查过滤规则语法是否有效
+func ValidatePattern(pattern string) error {
+	_, err := parseRule(pattern, "")
+	return err
+}
+
+// Match 判断文件是否需要同步（relPath为相对监控根目录的路径）
+func (f *Filter) Match(relPath string, info os.FileInfo) bool {
+	relPath = normalizePath(relPath)
+	if relPath == "" {
+		return true
+	}
+
+	isDir := info != nil && info.IsDir()
+	if f.Excluded(relPath, isDir) {
+		return false
+	}
+
+	// 目录只受排除规则约束
+	if isDir {
+		return true
+	}
+
+	if len(f.include) > 0 && !matchAny(f.include, relPath, false) {
+		return false
+	}
+
+	if info != nil {
+		if f.config.MinSize > 0 && info.Size() < f.config.MinSize {
+			return false
+		}
+		if f.config.MaxSize > 0 && info.Size() > f.config.MaxSize {
+			return false
+		}
+		if f.config.MaxAge > 0 && time.Since(info.ModTime()) > f.config.MaxAge {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Excluded 判断路径是否被排除规则排除（包括祖先目录被排除的情况）
+func (f *Filter) Excluded(relPath string, isDir bool) bool {
+	relPath = normalizePath(relPath)
+	if relPath == "" {
+		return false
+	}
+
+	parts := strings.Split(relPath, "/")
+	if parts[0] == MetaDir {
+		return true
+	}
+	for i := 1; i < len(parts); i++ {
+		if f.excludedSelf(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return f.excludedSelf(relPath, isDir)
+}
+
+// Matcher 按gitignore语法匹配路径，最后匹配的规则生效，目录匹配时其下所有文件都匹配
+type Matcher struct {
+	rules []*rule
+}
+
+// NewMatcher 创建路径匹配器
+func NewMatcher(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, pattern := range patterns {
+		r, err := parseRule(pattern, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m, nil
+}
+
+// Match 判断路径是否匹配（relPath为相对根目录的路径）
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	relPath = normalizePath(relPath)
+	if relPath == "" {
+		return false
+	}
+
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchSelf(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.matchSelf(relPath, isDir)
+}
+
+// matchSelf 只根据规则判断路径本身是否匹配
+func (m *Matcher) matchSelf(relPath string, isDir bool) bool {
+	matched := false
+	for _, r := range m.rules {
+		if r.match(relPath, isDir) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// Invalidate 使目录的.xsyncignore缓存失效（文件变更时调用）
+func (f *Filter) Invalidate(relDir string) {
+	relDir = normalizePath(relDir)
+
+	f.mutex.Lock()
+	delete(f.ignores, relDir)
+	f.mutex.Unlock()
+}
+
+// Reset 清空所有.xsyncignore缓存
+func (f *Filter) Reset() {
+	f.mutex.Lock()
+	f.ignores = make(map[string][]*rule)
+	f.mutex.Unlock()
+}
+
+// IsIgnoreFile 判断路径是否为过滤规则文件
+func IsIgnoreFile(relPath string) bool {
+	return path.Base(normalizePath(relPath)) == IgnoreFileName
+}
+
+// excludedSelf 只根据规则判断路径本身是否被排除
+func (f *Filter) excludedSelf(relPath string, isDir bool) bool {
+	excluded := false
+	apply := func(rules []*rule) {
+		for _, r := range rules {
+			if r.match(relPath, isDir) {
+				excluded = !r.negate
+			}
+		}
+	}
+
+	apply(f.rules)
+
+	// 从根目录到父目录依次应用.xsyncignore规则
+	dir := path.Dir(relPath)
+	if dir == "." {
+		dir = ""
+	}
+	apply(f.ignoreRules(""))
+	if dir != "" {
+		parts := strings.Split(dir, "/")
+		for i := 1; i <= len(parts); i++ {
+			apply(f.ignoreRules(strings.Join(parts[:i], "/")))
+		}
+	}
+
+	return excluded
+}
+
+// ignoreRules 获取目录下.xsyncignore中的规则（带缓存）
+func (f *Filter) ignoreRules(relDir string) []*rule {
+	f.mutex.RLock()
+	rules, exists := f.ignores[relDir]
+	f.mutex.RUnlock()
+	if exists {
+		return rules
+	}
+
+	rules = f.loadIgnoreFile(relDir)
+
+	f.mutex.Lock()
+	f.ignores[relDir] = rules
+	f.mutex.Unlock()
+	return rules
+}
+
+// loadIgnoreFile 读取目录下的.xsyncignore文件
+func (f *Filter) loadIgnoreFile(relDir string) []*rule {
+	file, err := os.Open(filepath.Join(f.basePath, filepath.FromSlash(relDir), IgnoreFileName))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []*rule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		r, err := parseRule(scanner.Text(), relDir)
+		if err != nil || r == nil {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// match 判断规则是否匹配路径
+func (r *rule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = strings.TrimPrefix(relPath, r.base+"/")
+	}
+
+	if r.anchored {
+		return r.re.MatchString(relPath)
+	}
+	return r.re.MatchString(path.Base(relPath))
+}
+
+// matchAny 判断是否有任意规则匹配
+func matchAny(rules []*rule, relPath string, isDir bool) bool {
+	for _, r := range rules {
+		if r.match(relPath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRule 解析一行gitignore风格的规则，空行和注释返回nil
+func parseRule(line, base string) (*rule, error) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil, nil
+	}
+
+	r := &rule{pattern: pattern, base: base}
+
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "\\!") || strings.HasPrefix(pattern, "\\#") {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	// 包含斜杠的规则相对于规则所在目录匹配，否则匹配任意层级的文件名
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	if pattern == "" {
+		return nil, fmt.Errorf("无效的过滤规则: %q", line)
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+	if err != nil {
+		return nil, fmt.Errorf("无效的过滤规则 %q: %v", line, err)
+	}
+	r.re = re
+
+	return r, nil
+}
+
+// globToRegexp 将glob模式转换为正则表达式，支持 * ? [...] 和 **
+func globToRegexp(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" 匹配零个或多个目录
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// normalizePath 统一使用正斜杠并去掉首尾多余部分
+func normalizePath(relPath string) string {
+	relPath = strings.ReplaceAll(relPath, "\\", "/")
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "." {
+		return ""
+	}
+	return relPath
+}
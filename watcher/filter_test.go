@@ -0,0 +1,212 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "dir/a.log", false},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"?", "/", false},
+		{"[abc].go", "b.go", true},
+		{"[abc].go", "d.go", false},
+		{"[!abc].go", "d.go", true},
+		{"[!abc].go", "a.go", false},
+		{"[a", "[a", true},
+		{"a.b", "axb", false},
+		{"**/build", "build", true},
+		{"**/build", "a/b/build", true},
+		{"src/**", "src/a/b.go", true},
+		{"src/**", "other/a.go", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/c", false},
+	}
+
+	for _, tt := range tests {
+		re := regexp.MustCompile("^" + globToRegexp(tt.pattern) + "$")
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("globToRegexp(%q) 匹配 %q = %v, 期望 %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		config FilterConfig
+		path   string
+		isDir  bool
+		want   bool
+	}{
+		{"普通文件", FilterConfig{}, "a.txt", false, true},
+		{"隐藏文件", FilterConfig{}, ".env", false, false},
+		{"隐藏目录下的文件", FilterConfig{}, ".git/config", false, false},
+		{"临时文件", FilterConfig{}, "a.txt~", false, false},
+		{"元数据目录", FilterConfig{}, MetaDir + "/versions/a", false, false},
+		{"排除扩展名", FilterConfig{Exclude: []string{"*.log"}}, "logs/a.log", false, false},
+		{"取反排除", FilterConfig{Exclude: []string{"*.log", "!keep.log"}}, "keep.log", false, true},
+		{"排除目录", FilterConfig{Exclude: []string{"build/"}}, "build/out/a.o", false, false},
+		{"目录规则不匹配文件", FilterConfig{Exclude: []string{"build/"}}, "build", false, true},
+		{"锚定规则", FilterConfig{Exclude: []string{"/tmp"}}, "sub/tmp", false, true},
+		{"锚定规则匹配根目录", FilterConfig{Exclude: []string{"/tmp"}}, "tmp", false, false},
+		{"包含规则", FilterConfig{Include: []string{"*.go"}}, "main.go", false, true},
+		{"不匹配包含规则", FilterConfig{Include: []string{"*.go"}}, "README.md", false, false},
+		{"目录不受包含规则约束", FilterConfig{Include: []string{"*.go"}}, "docs", true, true},
+		{"根目录", FilterConfig{Exclude: []string{"*"}}, "", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(t.TempDir(), tt.config)
+			if err != nil {
+				t.Fatalf("创建过滤器失败: %v", err)
+			}
+			var info os.FileInfo
+			if tt.isDir {
+				info = dirInfo{}
+			}
+			if got := f.Match(tt.path, info); got != tt.want {
+				t.Errorf("Match(%q) = %v, 期望 %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, IgnoreFileName), []byte("# 注释\n*.tmp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", IgnoreFileName), []byte("!keep.tmp\n/local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewFilter(dir, FilterConfig{})
+	if err != nil {
+		t.Fatalf("创建过滤器失败: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.tmp", false},
+		{"sub/a.tmp", false},
+		{"sub/keep.tmp", true},
+		{"keep.tmp", false},
+		{"sub/local", false},
+		{"sub/x/local", true},
+		{"local", true},
+	}
+	for _, tt := range tests {
+		if got := f.Match(tt.path, nil); got != tt.want {
+			t.Errorf("Match(%q) = %v, 期望 %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFilterSize(t *testing.T) {
+	f, err := NewFilter(t.TempDir(), FilterConfig{MinSize: 10, MaxSize: 100, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("创建过滤器失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		info os.FileInfo
+		want bool
+	}{
+		{"大小在范围内", fileInfo{size: 50, modTime: time.Now()}, true},
+		{"小于最小值", fileInfo{size: 5, modTime: time.Now()}, false},
+		{"大于最大值", fileInfo{size: 500, modTime: time.Now()}, false},
+		{"修改时间过早", fileInfo{size: 50, modTime: time.Now().Add(-2 * time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		if got := f.Match("a.txt", tt.info); got != tt.want {
+			t.Errorf("%s: Match = %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+	for _, pattern := range []string{"/", "!", "[z-a]"} {
+		if err := ValidatePattern(pattern); err == nil {
+			t.Errorf("ValidatePattern(%q) 应返回错误", pattern)
+		}
+	}
+	for _, pattern := range []string{"", "# 注释", "*.go", "\\!important"} {
+		if err := ValidatePattern(pattern); err != nil {
+			t.Errorf("ValidatePattern(%q) 返回错误: %v", pattern, err)
+		}
+	}
+}
+
+// fileInfo 测试用的文件信息
+type fileInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return "a.txt" }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return 0644 }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// dirInfo 测试用的目录信息
+type dirInfo struct{}
+
+func (di dirInfo) Name() string       { return "dir" }
+func (di dirInfo) Size() int64        { return 0 }
+func (di dirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (di dirInfo) ModTime() time.Time { return time.Now() }
+func (di dirInfo) IsDir() bool        { return true }
+func (di dirInfo) Sys() interface{}   { return nil }
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{nil, "a.txt", false, false},
+		{[]string{"*.txt"}, "a.txt", false, true},
+		{[]string{"*.txt"}, "docs/a.txt", false, true},
+		{[]string{"*.txt", "!b.txt"}, "b.txt", false, false},
+		{[]string{"docs/"}, "docs", true, true},
+		{[]string{"docs/"}, "docs", false, false},
+		{[]string{"docs/"}, "docs/sub/a.md", false, true},
+		{[]string{"/conf/*.yaml"}, "conf/a.yaml", false, true},
+		{[]string{"/conf/*.yaml"}, "x/conf/a.yaml", false, false},
+		{[]string{"**/*.go"}, "a/b/c.go", false, true},
+		{[]string{"*"}, "", true, false},
+	}
+
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.patterns)
+		if err != nil {
+			t.Fatalf("NewMatcher(%q) 失败: %v", tt.patterns, err)
+		}
+		if got := m.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("NewMatcher(%q).Match(%q, %v) = %v, 期望 %v", tt.patterns, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
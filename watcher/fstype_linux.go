@@ -0,0 +1,30 @@
+//go:build linux
+
+package watcher
+
+import "syscall"
+
+// 远程/用户态文件系统的statfs魔数
+var remoteFSMagic = map[int64]string{
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x517B:     "smb",
+	0x65735546: "fuse",
+	0x564C:     "ncp",
+	0x73757245: "coda",
+	0x47504653: "gpfs",
+	0x0BD00BD0: "lustre",
+	0x00C36400: "ceph",
+}
+
+// remoteFSType 判断路径是否位于inotify无法感知远端修改的文件系统上
+func remoteFSType(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	// 32位平台上Type是int32，cifs等大于0x7FFFFFFF的魔数会被符号扩展，先转为uint32
+	name, remote := remoteFSMagic[int64(uint32(st.Type))]
+	return name, remote
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package watcher
+
+// remoteFSType 非Linux平台不检测文件系统类型
+func remoteFSType(path string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,164 @@
+package watcher
+
+import (
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultPollInterval 默认轮询间隔
+const defaultPollInterval = 10 * time.Second
+
+// fileState 文件状态快照
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+	Hash    uint32
+}
+
+// poller 轮询监控器，定期扫描目录树并与最后已知状态比较
+type poller struct {
+	fw       *FileWatcher
+	interval time.Duration
+}
+
+// newPoller 创建轮询监控器
+func newPoller(fw *FileWatcher, interval time.Duration) *poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	log.Printf("启动轮询监控: %s (间隔 %v)", fw.basePath, interval)
+	return &poller{
+		fw:       fw,
+		interval: interval,
+	}
+}
+
+// loop 轮询循环
+func (p *poller) loop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// 每轮重新读取.xsyncignore
+			p.fw.filter.Reset()
+			p.fw.rescan("")
+		case <-p.fw.done:
+			return
+		}
+	}
+}
+
+// scanTree 扫描监控目录下的子树，返回相对路径到文件状态的映射（应用过滤规则）
+func (fw *FileWatcher) scanTree(relRoot string, hash bool) (map[string]fileState, error) {
+	state := make(map[string]fileState)
+	root := filepath.Join(fw.basePath, filepath.FromSlash(relRoot))
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// 扫描过程中被删除的文件忽略即可
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		relPath, err := filepath.Rel(fw.basePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = strings.ReplaceAll(relPath, "\\", "/")
+		if relPath == "." {
+			return nil
+		}
+
+		if !fw.filter.Match(relPath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fs := fileState{
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		}
+		if hash && !info.IsDir() {
+			if sum, err := HashFile(path); err == nil {
+				fs.Hash = sum
+			}
+		}
+		state[relPath] = fs
+
+		return nil
+	})
+
+	return state, err
+}
+
+// diffStates 比较两次扫描结果，返回按路径排序的变化事件
+// 删除在前（子项先于父目录），新建在后（父目录先于子项）
+func diffStates(previous, current map[string]fileState) []*FileEvent {
+	var created, modified, deleted []string
+
+	for path, cur := range current {
+		prev, exists := previous[path]
+		switch {
+		case !exists:
+			created = append(created, path)
+		case prev.IsDir != cur.IsDir:
+			deleted = append(deleted, path)
+			created = append(created, path)
+		case cur.IsDir:
+			// 目录本身的mtime变化由子项事件体现
+		case prev.Size != cur.Size || !prev.ModTime.Equal(cur.ModTime) || prev.Hash != cur.Hash:
+			modified = append(modified, path)
+		}
+	}
+	for path := range previous {
+		if _, exists := current[path]; !exists {
+			deleted = append(deleted, path)
+		}
+	}
+
+	sort.Strings(created)
+	sort.Strings(modified)
+	sort.Sort(sort.Reverse(sort.StringSlice(deleted)))
+
+	events := make([]*FileEvent, 0, len(created)+len(modified)+len(deleted))
+	for _, path := range deleted {
+		events = append(events, &FileEvent{Op: "DELETE", Path: path})
+	}
+	for _, path := range created {
+		events = append(events, &FileEvent{Op: "CREATE", Path: path, IsDir: current[path].IsDir})
+	}
+	for _, path := range modified {
+		events = append(events, &FileEvent{Op: "MODIFY", Path: path})
+	}
+	return events
+}
+
+// HashFile 计算文件内容的CRC32（按块读取，不会把整个文件读入内存）
+func HashFile(path string) (uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, file); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
@@ -0,0 +1,174 @@
+package watcher
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rescanDelay 溢出后等待突发写入平息再扫描的时间
+const rescanDelay = time.Second
+
+// markDirty 标记子树因事件溢出待重新扫描（relDir为空表示整个监控目录）
+func (fw *FileWatcher) markDirty(relDir string) {
+	fw.dirtyMutex.Lock()
+	fw.overflows++
+	fw.dirtyMutex.Unlock()
+
+	fw.scheduleRescan(relDir)
+}
+
+// scheduleRescan 安排子树稍后重新扫描
+func (fw *FileWatcher) scheduleRescan(relDir string) {
+	fw.dirtyMutex.Lock()
+	defer fw.dirtyMutex.Unlock()
+
+	fw.dirty[normalizePath(relDir)] = true
+
+	if fw.rescanScheduled {
+		return
+	}
+	fw.rescanScheduled = true
+	time.AfterFunc(rescanDelay, fw.runRescan)
+}
+
+// runRescan 重新扫描所有被标记的子树
+func (fw *FileWatcher) runRescan() {
+	fw.dirtyMutex.Lock()
+	dirty := fw.dirty
+	fw.dirty = make(map[string]bool)
+	fw.dirtyMutex.Unlock()
+
+	for _, root := range collapseDirs(dirty) {
+		if fw.isStopped() {
+			return
+		}
+		fw.rescan(root)
+	}
+
+	// 扫描期间又有新的溢出，继续安排下一轮
+	fw.dirtyMutex.Lock()
+	defer fw.dirtyMutex.Unlock()
+	if len(fw.dirty) > 0 && !fw.isStopped() {
+		time.AfterFunc(rescanDelay, fw.runRescan)
+		return
+	}
+	fw.rescanScheduled = false
+}
+
+// rescan 扫描子树并与最后已知状态对账，差异事件与监控事件一样经过防抖和写入完成检查
+// 已知状态在事件发出时更新，未发出的差异（如事件通道已满）在下次扫描时再次补发
+func (fw *FileWatcher) rescan(relRoot string) {
+	fw.rescanMutex.Lock()
+	defer fw.rescanMutex.Unlock()
+
+	// 先添加监控再扫描，扫描之后新建的文件由监控事件覆盖，不会遗漏
+	if fw.watcher != nil {
+		root := filepath.Join(fw.basePath, filepath.FromSlash(relRoot))
+		if err := fw.addRecursive(root); err != nil && !os.IsNotExist(err) {
+			log.Printf("添加目录监控失败 %s: %v", root, err)
+		}
+	}
+
+	current, err := fw.scanTree(relRoot, fw.hash)
+	if err != nil {
+		log.Printf("重新扫描失败 %s/%s: %v", fw.basePath, relRoot, err)
+		fw.markDirty(relRoot)
+		return
+	}
+
+	fw.stateMutex.Lock()
+	previous := make(map[string]fileState)
+	for path, state := range fw.known {
+		if inSubtree(path, relRoot) {
+			previous[path] = state
+		}
+	}
+	fw.stateMutex.Unlock()
+
+	events := diffStates(previous, current)
+	for _, event := range events {
+		if fw.isStopped() {
+			return
+		}
+		fw.debounceEvent(event.Op, event.Path)
+	}
+
+	fw.dirtyMutex.Lock()
+	fw.rescans++
+	fw.dirtyMutex.Unlock()
+
+	if len(events) > 0 || fw.poller == nil {
+		log.Printf("重新扫描完成 %s [%s]: %d 个变化", fw.basePath, relRoot, len(events))
+	}
+}
+
+// updateKnown 根据已发出的事件更新最后已知状态
+func (fw *FileWatcher) updateKnown(op, relPath string) {
+	relPath = normalizePath(relPath)
+
+	fw.stateMutex.Lock()
+	defer fw.stateMutex.Unlock()
+
+	if op == "DELETE" {
+		for path := range fw.known {
+			if inSubtree(path, relPath) {
+				delete(fw.known, path)
+			}
+		}
+		return
+	}
+
+	info, err := os.Lstat(filepath.Join(fw.basePath, filepath.FromSlash(relPath)))
+	if err != nil {
+		return
+	}
+	state := fileState{Size: info.Size(), ModTime: info.ModTime(), IsDir: info.IsDir()}
+	if fw.hash && !info.IsDir() {
+		if sum, err := HashFile(filepath.Join(fw.basePath, filepath.FromSlash(relPath))); err == nil {
+			state.Hash = sum
+		}
+	}
+	fw.known[relPath] = state
+}
+
+// isKnown 判断路径是否在最后已知状态中（即已同步给Slave）
+func (fw *FileWatcher) isKnown(relPath string) bool {
+	fw.stateMutex.Lock()
+	defer fw.stateMutex.Unlock()
+
+	_, exists := fw.known[normalizePath(relPath)]
+	return exists
+}
+
+// inSubtree 判断路径是否位于子树内（root为空表示整个目录树）
+func inSubtree(path, root string) bool {
+	return root == "" || path == root || strings.HasPrefix(path, root+"/")
+}
+
+// collapseDirs 去掉已被祖先目录覆盖的子树，返回排序后的根列表
+func collapseDirs(dirs map[string]bool) []string {
+	roots := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		roots = append(roots, dir)
+	}
+	sort.Strings(roots)
+
+	var result []string
+	for _, dir := range roots {
+		covered := false
+		for _, root := range result {
+			if inSubtree(dir, root) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollapseDirs(t *testing.T) {
+	tests := []struct {
+		dirs []string
+		want []string
+	}{
+		{[]string{"a"}, []string{"a"}},
+		{[]string{"a/b", "a", "c"}, []string{"a", "c"}},
+		{[]string{"a/b", "a/c", "ab"}, []string{"a/b", "a/c", "ab"}},
+		{[]string{"x/y", "", "z"}, []string{""}},
+	}
+
+	for _, tt := range tests {
+		dirs := make(map[string]bool)
+		for _, dir := range tt.dirs {
+			dirs[dir] = true
+		}
+		if got := collapseDirs(dirs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("collapseDirs(%q) = %q, 期望 %q", tt.dirs, got, tt.want)
+		}
+	}
+}
+
+func TestDiffStates(t *testing.T) {
+	now := time.Now()
+	file := func(size int64, hash uint32) fileState {
+		return fileState{Size: size, ModTime: now, Hash: hash}
+	}
+	dir := fileState{IsDir: true, ModTime: now}
+
+	tests := []struct {
+		name     string
+		previous map[string]fileState
+		current  map[string]fileState
+		want     []FileEvent
+	}{
+		{
+			name:     "无变化",
+			previous: map[string]fileState{"a": file(1, 1), "d": dir},
+			current:  map[string]fileState{"a": file(1, 1), "d": {IsDir: true, ModTime: now.Add(time.Second)}},
+			want:     []FileEvent{},
+		},
+		{
+			name:     "新建目录先于子项",
+			previous: map[string]fileState{},
+			current:  map[string]fileState{"d/f": file(1, 1), "d": dir},
+			want:     []FileEvent{{Op: "CREATE", Path: "d", IsDir: true}, {Op: "CREATE", Path: "d/f"}},
+		},
+		{
+			name:     "删除子项先于目录",
+			previous: map[string]fileState{"d": dir, "d/f": file(1, 1)},
+			current:  map[string]fileState{},
+			want:     []FileEvent{{Op: "DELETE", Path: "d/f"}, {Op: "DELETE", Path: "d"}},
+		},
+		{
+			name:     "大小、时间或内容变化",
+			previous: map[string]fileState{"a": file(1, 1), "b": file(1, 1), "c": file(1, 1)},
+			current:  map[string]fileState{"a": file(2, 1), "b": {Size: 1, ModTime: now.Add(time.Second), Hash: 1}, "c": file(1, 2)},
+			want:     []FileEvent{{Op: "MODIFY", Path: "a"}, {Op: "MODIFY", Path: "b"}, {Op: "MODIFY", Path: "c"}},
+		},
+		{
+			name:     "文件变为目录",
+			previous: map[string]fileState{"x": file(1, 1)},
+			current:  map[string]fileState{"x": dir},
+			want:     []FileEvent{{Op: "DELETE", Path: "x"}, {Op: "CREATE", Path: "x", IsDir: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []FileEvent{}
+			for _, event := range diffStates(tt.previous, tt.current) {
+				got = append(got, *event)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffStates = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
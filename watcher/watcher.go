@@ -1,12 +1,12 @@
 package watcher
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -16,45 +16,196 @@ import (
 
 // FileEvent 文件事件
 type FileEvent struct {
-	Op   string // "CREATE", "MODIFY", "DELETE"
-	Path string // 文件路径
+	Op    string // "CREATE", "MODIFY", "DELETE"
+	Path  string // 文件路径
+	IsDir bool   // 是否为目录（DELETE时无法确定，始终为false）
 }
 
+// 监控后端类型
+const (
+	BackendAuto     = "auto"     // 优先使用fsnotify，远程文件系统或初始化失败时使用轮询
+	BackendFsnotify = "fsnotify" // 基于inotify/kqueue等系统通知
+	BackendPoll     = "poll"     // 定期扫描目录树
+)
+
 // FileWatcher 文件监控器
 type FileWatcher struct {
 	watcher    *fsnotify.Watcher
+	poller     *poller
+	backend    string
 	basePath   string
 	eventChan  chan *FileEvent
-	debouncer  map[string]*time.Timer
+	debouncer  map[string]*pendingEvent
 	mutex      sync.RWMutex
 	done       chan bool
 	debounceMs int
+	filter     *Filter
+	closeWrite *closeWriteNotifier
+	closedAt   map[string]time.Time
+
+	// 写入完成检测
+	maxDelay       time.Duration
+	stableChecks   int
+	stableInterval time.Duration
+	stopped        bool
+	sendMutex      sync.RWMutex
+
+	// 最后已知的目录树状态，用于溢出后的对账扫描
+	known       map[string]fileState
+	hash        bool
+	stateMutex  sync.Mutex
+	rescanMutex sync.Mutex
+
+	// 待重新扫描的子树
+	dirty           map[string]bool
+	rescanScheduled bool
+	overflows       int64
+	rescans         int64
+	dirtyMutex      sync.Mutex
+}
+
+// Options 文件监控器选项
+type Options struct {
+	DebounceMs   int           // 防抖动时间（毫秒）
+	Filter       *Filter       // 文件过滤器，为nil时使用默认规则
+	Backend      string        // 监控后端: auto/fsnotify/poll，默认auto
+	PollInterval time.Duration // 轮询间隔，默认10秒
+	PollHash     bool          // 轮询时比较文件内容哈希（可发现mtime未变化的修改）
+
+	MaxDelay       time.Duration // 持续写入的文件最长延迟多久必须发送一次，0表示不限制
+	StableChecks   int           // 发送前要求大小和修改时间连续N次采样不变，默认1
+	StableInterval time.Duration // 稳定性采样间隔，默认1秒
 }
 
 // NewFileWatcher 创建文件监控器
 func NewFileWatcher(basePath string, debounceMs int) (*FileWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, fmt.Errorf("创建fsnotify监控器失败: %v", err)
+	return NewFileWatcherWithOptions(basePath, Options{DebounceMs: debounceMs})
+}
+
+// NewFileWatcherWithOptions 按选项创建文件监控器
+func NewFileWatcherWithOptions(basePath string, opts Options) (*FileWatcher, error) {
+	filter := opts.Filter
+	if filter == nil {
+		var err error
+		if filter, err = NewFilter(basePath, FilterConfig{}); err != nil {
+			return nil, err
+		}
 	}
 
 	fw := &FileWatcher{
-		watcher:    watcher,
 		basePath:   basePath,
 		eventChan:  make(chan *FileEvent, 100),
-		debouncer:  make(map[string]*time.Timer),
+		debouncer:  make(map[string]*pendingEvent),
+		closedAt:   make(map[string]time.Time),
 		done:       make(chan bool),
-		debounceMs: debounceMs,
+		debounceMs: opts.DebounceMs,
+		filter:     filter,
+		hash:       opts.PollHash,
+		dirty:      make(map[string]bool),
+
+		maxDelay:       opts.MaxDelay,
+		stableChecks:   opts.StableChecks,
+		stableInterval: opts.StableInterval,
+	}
+	if fw.stableChecks <= 0 {
+		fw.stableChecks = 1
+	}
+	if fw.stableInterval <= 0 {
+		fw.stableInterval = defaultStableInterval
 	}
 
-	// 递归添加目录监控
-	if err := fw.addRecursive(basePath); err != nil {
-		return nil, fmt.Errorf("添加目录监控失败: %v", err)
+	backend := opts.Backend
+	if backend == "" {
+		backend = BackendAuto
 	}
 
+	switch backend {
+	case BackendPoll:
+	case BackendAuto:
+		// 网络/用户态文件系统上inotify收不到其他主机的修改
+		if fsType, remote := remoteFSType(basePath); remote {
+			log.Printf("监控路径位于%s文件系统，使用轮询监控: %s", fsType, basePath)
+			backend = BackendPoll
+			break
+		}
+		if err := fw.initFsnotify(); err != nil {
+			log.Printf("fsnotify初始化失败，回退为轮询监控 %s: %v", basePath, err)
+			backend = BackendPoll
+			break
+		}
+		backend = BackendFsnotify
+	case BackendFsnotify:
+		if err := fw.initFsnotify(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("未知的监控后端: %s", backend)
+	}
+
+	if backend == BackendPoll {
+		fw.poller = newPoller(fw, opts.PollInterval)
+	}
+	fw.backend = backend
+
+	// 记录初始状态
+	known, err := fw.scanTree("", fw.hash)
+	if err != nil {
+		fw.closeWatchers()
+		return nil, fmt.Errorf("扫描监控目录失败: %v", err)
+	}
+	fw.known = known
+
 	return fw, nil
 }
 
+// initFsnotify 创建fsnotify监控器并递归添加目录
+func (fw *FileWatcher) initFsnotify() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建fsnotify监控器失败: %v", err)
+	}
+	fw.watcher = watcher
+
+	// 写入完成通知（IN_CLOSE_WRITE），不支持时只依赖防抖动和稳定性检查
+	if cw, err := newCloseWriteNotifier(fw.onCloseWrite); err == nil {
+		fw.closeWrite = cw
+	} else {
+		log.Printf("写入完成通知不可用，使用稳定性检查: %v", err)
+	}
+
+	// 递归添加目录监控
+	if err := fw.addRecursive(fw.basePath); err != nil {
+		fw.closeWatchers()
+		fw.watcher, fw.closeWrite = nil, nil
+		return fmt.Errorf("添加目录监控失败: %v", err)
+	}
+
+	return nil
+}
+
+// addWatch 为目录添加监控
+func (fw *FileWatcher) addWatch(dir string) error {
+	if err := fw.watcher.Add(dir); err != nil {
+		return err
+	}
+	if fw.closeWrite != nil {
+		if err := fw.closeWrite.add(dir); err != nil {
+			log.Printf("添加写入完成监控失败 %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// closeWatchers 关闭系统通知监控器
+func (fw *FileWatcher) closeWatchers() {
+	if fw.watcher != nil {
+		fw.watcher.Close()
+	}
+	if fw.closeWrite != nil {
+		fw.closeWrite.close()
+	}
+}
+
 // addRecursive 递归添加目录监控
 func (fw *FileWatcher) addRecursive(path string) error {
 	return filepath.Walk(path, func(walkPath string, info os.FileInfo, err error) error {
@@ -63,7 +214,15 @@ func (fw *FileWatcher) addRecursive(path string) error {
 		}
 
 		if info.IsDir() {
-			if err := fw.watcher.Add(walkPath); err != nil {
+			// 跳过被排除的目录
+			if relPath, err := filepath.Rel(fw.basePath, walkPath); err == nil && fw.filter.Excluded(relPath, true) {
+				return filepath.SkipDir
+			}
+			if err := fw.addWatch(walkPath); err != nil {
+				// 遍历过程中目录被删除
+				if os.IsNotExist(err) {
+					return filepath.SkipDir
+				}
 				return fmt.Errorf("添加目录监控失败 %s: %v", walkPath, err)
 			}
 			log.Printf("添加目录监控: %s", walkPath)
@@ -75,6 +234,10 @@ func (fw *FileWatcher) addRecursive(path string) error {
 
 // Start 启动文件监控
 func (fw *FileWatcher) Start() {
+	if fw.poller != nil {
+		go fw.poller.loop()
+		return
+	}
 	go fw.watchLoop()
 }
 
@@ -92,6 +255,12 @@ func (fw *FileWatcher) watchLoop() {
 			if !ok {
 				return
 			}
+			// 内核事件队列溢出，无法确定丢失了哪些事件，重新扫描整个目录树
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				log.Printf("文件监控事件队列溢出，将重新扫描: %s", fw.basePath)
+				fw.markDirty("")
+				continue
+			}
 			log.Printf("文件监控错误: %v", err)
 
 		case <-fw.done:
@@ -102,28 +271,45 @@ func (fw *FileWatcher) watchLoop() {
 
 // handleEvent 处理文件事件
 func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
-	// 过滤临时文件和隐藏文件
-	filename := filepath.Base(event.Name)
-	if strings.HasPrefix(filename, ".") || strings.HasSuffix(filename, "~") {
-		return
-	}
-
 	// 获取相对路径
 	relPath, err := filepath.Rel(fw.basePath, event.Name)
 	if err != nil {
 		log.Printf("获取相对路径失败: %v", err)
 		return
 	}
+	if relPath == "." {
+		return // 监控根目录本身的事件
+	}
+
+	// 过滤规则文件变更后使缓存失效
+	if IsIgnoreFile(relPath) {
+		fw.filter.Invalidate(filepath.Dir(relPath))
+	}
+
+	// 应用过滤规则（删除事件无法获取文件信息，只按路径判断）
+	info, _ := os.Lstat(event.Name)
+	if info == nil {
+		if fw.filter.Excluded(relPath, false) {
+			return
+		}
+	} else if !fw.filter.Match(relPath, info) {
+		return
+	}
 
 	// 处理不同类型的事件
 	var op string
 	switch {
 	case event.Op&fsnotify.Create == fsnotify.Create:
 		op = "CREATE"
-		// 如果是新创建的目录，添加监控
-		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-			fw.watcher.Add(event.Name)
-			log.Printf("添加新目录监控: %s", event.Name)
+		// 新创建的目录（如cp -r、git clone）在添加监控前可能已有内容，
+		// 安排对该子树先递归添加监控再扫描，补发已存在内容的CREATE事件
+		if info != nil && info.IsDir() {
+			if err := fw.addWatch(event.Name); err != nil {
+				log.Printf("添加新目录监控失败 %s: %v", event.Name, err)
+			} else {
+				log.Printf("添加新目录监控: %s", event.Name)
+			}
+			fw.scheduleRescan(relPath)
 		}
 	case event.Op&fsnotify.Write == fsnotify.Write:
 		op = "MODIFY"
@@ -139,31 +325,32 @@ func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
 	fw.debounceEvent(op, relPath)
 }
 
-// debounceEvent 防抖动事件处理
-func (fw *FileWatcher) debounceEvent(op, path string) {
-	fw.mutex.Lock()
-	defer fw.mutex.Unlock()
-
-	key := fmt.Sprintf("%s:%s", op, path)
+// emit 发送事件到事件通道，通道已满时立即返回false
+func (fw *FileWatcher) emit(event *FileEvent) bool {
+	fw.sendMutex.RLock()
+	defer fw.sendMutex.RUnlock()
 
-	// 取消之前的定时器
-	if timer, exists := fw.debouncer[key]; exists {
-		timer.Stop()
+	// 监控器已停止，事件通道即将关闭
+	if fw.isStopped() {
+		return false
 	}
 
-	// 创建新的定时器
-	fw.debouncer[key] = time.AfterFunc(time.Duration(fw.debounceMs)*time.Millisecond, func() {
-		fw.mutex.Lock()
-		delete(fw.debouncer, key)
-		fw.mutex.Unlock()
+	select {
+	case fw.eventChan <- event:
+		return true
+	default:
+		return false
+	}
+}
 
-		// 发送事件
-		select {
-		case fw.eventChan <- &FileEvent{Op: op, Path: path}:
-		default:
-			log.Printf("事件通道已满，丢弃事件: %s %s", op, path)
-		}
-	})
+// isStopped 判断监控器是否已停止
+func (fw *FileWatcher) isStopped() bool {
+	select {
+	case <-fw.done:
+		return true
+	default:
+		return false
+	}
 }
 
 // GetEventChan 获取事件通道
@@ -173,9 +360,64 @@ func (fw *FileWatcher) GetEventChan() <-chan *FileEvent {
 
 // Stop 停止文件监控
 func (fw *FileWatcher) Stop() {
+	fw.mutex.Lock()
+	if fw.stopped {
+		fw.mutex.Unlock()
+		return
+	}
+	fw.stopped = true
+
+	// 取消所有未触发的防抖定时器
+	for key, pending := range fw.debouncer {
+		pending.timer.Stop()
+		delete(fw.debouncer, key)
+	}
+
 	close(fw.done)
-	fw.watcher.Close()
+	fw.mutex.Unlock()
+
+	fw.closeWatchers()
+
+	// 等待正在发送的事件退出后再关闭通道
+	fw.sendMutex.Lock()
 	close(fw.eventChan)
+	fw.sendMutex.Unlock()
+}
+
+// GetStats 获取监控器统计信息
+func (fw *FileWatcher) GetStats() map[string]interface{} {
+	fw.mutex.RLock()
+	defer fw.mutex.RUnlock()
+
+	stats := map[string]interface{}{
+		"base_path":      fw.basePath,
+		"backend":        fw.backend,
+		"pending_events": len(fw.debouncer),
+		"queued_events":  len(fw.eventChan),
+	}
+	if fw.watcher != nil {
+		stats["watched_dirs"] = len(fw.watcher.WatchList())
+	}
+	if fw.poller != nil {
+		stats["poll_interval"] = fw.poller.interval.String()
+	}
+
+	fw.stateMutex.Lock()
+	stats["tracked_files"] = len(fw.known)
+	fw.stateMutex.Unlock()
+
+	fw.dirtyMutex.Lock()
+	stats["overflows"] = fw.overflows
+	stats["rescans"] = fw.rescans
+	stats["dirty_dirs"] = len(fw.dirty)
+	fw.dirtyMutex.Unlock()
+
+	return stats
+}
+
+// GetBackend 获取实际使用的监控后端
+func (fw *FileWatcher) GetBackend() string {
+	return fw.backend
 }
 
 // CreateSyncPacket 根据文件事件创建同步包
@@ -186,6 +428,12 @@ func CreateSyncPacket(event *FileEvent, basePath string) (*protocol.SyncPacket,
 	// 对于CREATE和MODIFY操作，读取文件内容
 	if event.Op == "CREATE" || event.Op == "MODIFY" {
 		fullPath := filepath.Join(basePath, event.Path)
+
+		// 目录只同步结构
+		if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+			return protocol.NewSyncPacket("MKDIR", event.Path, nil), nil
+		}
+
 		content, err = ioutil.ReadFile(fullPath)
 		if err != nil {
 			return nil, fmt.Errorf("读取文件失败 %s: %v", fullPath, err)
@@ -193,4 +441,4 @@ func CreateSyncPacket(event *FileEvent, basePath string) (*protocol.SyncPacket,
 	}
 
 	return protocol.NewSyncPacket(event.Op, event.Path, content), nil
-}
\ No newline at end of file
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -12,38 +13,24 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
-)
 
-// WebConfig Web服务配置
-type WebConfig struct {
-	Enabled   bool   `yaml:"enabled"`
-	Port      int    `yaml:"port"`
-	Username  string `yaml:"username"`
-	Password  string `yaml:"password"`
-	UploadDir string `yaml:"upload_dir"`
-}
+	"xsync/config"
+)
 
 // WebServer Web服务器
 type WebServer struct {
-	config   *WebConfig
-	server   *http.Server
+	config    *config.WebConfig
+	server    *http.Server
+	mux       *http.ServeMux
 	uploadDir string
 }
 
 // NewWebServer 创建Web服务器
-func NewWebServer(cfg *WebConfig) (*WebServer, error) {
+func NewWebServer(cfg *config.WebConfig) (*WebServer, error) {
 	if cfg == nil || !cfg.Enabled {
 		return nil, fmt.Errorf("Web服务未启用")
 	}
 
-	// 设置默认值
-	if cfg.Port == 0 {
-		cfg.Port = 8081
-	}
-	if cfg.UploadDir == "" {
-		cfg.UploadDir = "uploads"
-	}
-
 	// 创建上传目录
 	uploadDir, err := filepath.Abs(cfg.UploadDir)
 	if err != nil {
@@ -61,9 +48,10 @@ func NewWebServer(cfg *WebConfig) (*WebServer, error) {
 
 	// 设置路由
 	mux := http.NewServeMux()
-	mux.HandleFunc("/uploads/", ws.handleDownload)  // 下载不需要认证
-	mux.HandleFunc("/upload", ws.basicAuth(ws.handleUpload))  // 上传需要认证
+	mux.HandleFunc("/uploads/", ws.handleDownload)           // 下载不需要认证
+	mux.HandleFunc("/upload", ws.basicAuth(ws.handleUpload)) // 上传需要认证
 	mux.HandleFunc("/health", ws.handleHealth)
+	ws.mux = mux
 
 	ws.server = &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
@@ -79,10 +67,10 @@ func NewWebServer(cfg *WebConfig) (*WebServer, error) {
 // Start 启动Web服务器
 func (ws *WebServer) Start() error {
 	log.Printf("启动Web服务器，端口: %d，上传目录: %s", ws.config.Port, ws.uploadDir)
-	
+
 	// 创建一个channel来等待服务器启动结果
 	started := make(chan error, 1)
-	
+
 	go func() {
 		if err := ws.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Printf("Web服务器启动失败: %v", err)
@@ -91,7 +79,7 @@ func (ws *WebServer) Start() error {
 			started <- nil
 		}
 	}()
-	
+
 	// 等待一小段时间确保服务器启动
 	select {
 	case err := <-started:
@@ -102,7 +90,7 @@ func (ws *WebServer) Start() error {
 		// 100ms后假设启动成功
 		log.Printf("Web服务器启动完成")
 	}
-	
+
 	return nil
 }
 
@@ -114,6 +102,20 @@ func (ws *WebServer) Stop() error {
 	return nil
 }
 
+// Handle 注册额外的路由（需要认证），需在Start之前调用
+func (ws *WebServer) Handle(pattern string, handler http.HandlerFunc) {
+	ws.mux.HandleFunc(pattern, ws.basicAuth(handler))
+}
+
+// WriteJSON 以JSON格式返回响应
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("写入JSON响应失败: %v", err)
+	}
+}
+
 // basicAuth Basic认证中间件
 func (ws *WebServer) basicAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -254,4 +256,4 @@ func (ws *WebServer) GetUploadDir() string {
 // GetPort 获取服务端口
 func (ws *WebServer) GetPort() int {
 	return ws.config.Port
-}
\ No newline at end of file
+}